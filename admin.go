@@ -0,0 +1,159 @@
+package hashcache
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// AdminStats is the body of the stats endpoint
+type AdminStats struct {
+	Verifier    VerifierStats `json:"verifier"`
+	MinZeroBits uint8         `json:"min_zero_bits"`
+
+	// ControllerZeroBits advertised by the difficulty controller
+	ControllerZeroBits *uint8 `json:"controller_zero_bits,omitempty"`
+
+	// StoreSize is the number of spent stamps of stores able to count them
+	StoreSize *int `json:"store_size,omitempty"`
+
+	// Work done by the clients, when the verifier keeps a WorkHistogram
+	Work *WorkHistogramSnapshot `json:"work,omitempty"`
+}
+
+type AdminConfig struct {
+	Verifier   *Verifier
+	Middleware *Middleware
+	Controller *DifficultyController
+}
+
+type AdminOption func(*AdminConfig)
+
+func WithAdminMiddleware(m *Middleware) AdminOption {
+	return func(cfg *AdminConfig) {
+		cfg.Middleware = m
+	}
+}
+
+func WithAdminController(c *DifficultyController) AdminOption {
+	return func(cfg *AdminConfig) {
+		cfg.Controller = c
+	}
+}
+
+// NewAdminHandler serves the operator endpoints:
+//
+//	GET    /stats            verifier statistics, difficulty and store size
+//	DELETE /stamps/{key}     forgets a spent stamp
+//	DELETE /clients/{key}    resets the escalation and the chain of a client
+//
+// It has no authentication of its own and must be mounted
+// under an operator-only mux, e.g. with http.StripPrefix.
+func NewAdminHandler(v *Verifier, opts ...AdminOption) http.Handler {
+	cfg := AdminConfig{Verifier: v}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	a := &admin{cfg: cfg}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", a.stats)
+	mux.HandleFunc("/stamps/", a.purgeStamp)
+	mux.HandleFunc("/clients/", a.purgeClient)
+	return mux
+}
+
+type admin struct {
+	cfg AdminConfig
+}
+
+func (a *admin) stats(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	stats := AdminStats{
+		Verifier:    a.cfg.Verifier.Stats(),
+		MinZeroBits: a.cfg.Verifier.Policy().MinZeroBits,
+	}
+
+	if a.cfg.Controller != nil {
+		bits := a.cfg.Controller.ZeroBits()
+		stats.ControllerZeroBits = &bits
+	}
+
+	if hist := a.cfg.Verifier.cfg.Histogram; hist != nil {
+		work := hist.Snapshot()
+		stats.Work = &work
+	}
+
+	if s, ok := a.cfg.Verifier.cfg.SpentStore.(interface{ Len() int }); ok {
+		size := s.Len()
+		stats.StoreSize = &size
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(stats)
+}
+
+func (a *admin) purgeStamp(w http.ResponseWriter, r *http.Request) {
+	key, ok := adminKey(w, r, "/stamps/")
+	if !ok {
+		return
+	}
+
+	store := a.cfg.Verifier.cfg.SpentStore
+	if store == nil {
+		writeProblem(w, newProblem(http.StatusNotFound, "no_store", nil))
+		return
+	}
+
+	if err := store.Delete(r.Context(), key); err != nil {
+		writeProblem(w, newProblem(http.StatusInternalServerError, "store_failed", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *admin) purgeClient(w http.ResponseWriter, r *http.Request) {
+	key, ok := adminKey(w, r, "/clients/")
+	if !ok {
+		return
+	}
+
+	if a.cfg.Middleware != nil {
+		a.cfg.Middleware.cfg.Escalation.Success(key)
+	}
+
+	if chain := a.cfg.Verifier.cfg.Chain; chain != nil {
+		chain.Reset(key)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func adminKey(w http.ResponseWriter, r *http.Request, prefix string) (string, bool) {
+	if !allowMethod(w, r, http.MethodDelete) {
+		return "", false
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+	if key == "" {
+		writeProblem(w, newProblem(http.StatusNotFound, "missing_key", nil))
+		return "", false
+	}
+
+	return key, true
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+
+	w.Header().Set("Allow", method)
+	writeProblem(w, newProblem(http.StatusMethodNotAllowed, "method_not_allowed", nil))
+	return false
+}
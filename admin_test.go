@@ -0,0 +1,57 @@
+package hashcache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminHandler(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	h, err := New("my.email@gmail.com", 2, time.Hour)
+	require.NoError(t, err)
+	h, err = Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+
+	store := NewMemoryStore()
+	v := NewVerifier(WithMinZeroBits(2), WithSpentStore(store))
+	require.NoError(t, v.VerifyFor(context.Background(), "client", h))
+	require.ErrorIs(t, v.VerifyFor(context.Background(), "client", h), ErrStampSpent)
+
+	ladder := NewLadderEscalation([]uint8{2, 3}, time.Minute)
+	ladder.Failure("client")
+	handler := NewAdminHandler(v, WithAdminMiddleware(NewMiddleware(WithEscalation(ladder))))
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/stats")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var stats AdminStats
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&stats))
+	assert.Equal(t, VerifierStats{Accepted: 1, Rejected: 1}, stats.Verifier)
+	assert.Equal(t, uint8(2), stats.MinZeroBits)
+	assert.Nil(t, stats.ControllerZeroBits)
+	require.NotNil(t, stats.StoreSize)
+	assert.Equal(t, 1, *stats.StoreSize)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodGet, "/stamps/"+StampKey(h)).Code)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/stamps/"+StampKey(h)).Code)
+	assert.Zero(t, store.Len())
+
+	assert.Equal(t, uint8(3), ladder.Required("client").ZeroBits)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/clients/client").Code)
+	assert.Equal(t, uint8(2), ladder.Required("client").ZeroBits)
+}
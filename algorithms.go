@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"crypto/sha512"
 	"hash"
+	"slices"
 )
 
 const (
@@ -13,11 +14,33 @@ const (
 	algSha512 = "sha-512"
 )
 
-var algorithms = []string{algSha1, algSha256, algSha512}
+// DefaultAlgorithm of the headers minted by New, see WithAlgorithm
+const DefaultAlgorithm = algSha256
+
+// legacyAlgorithms are broken hashes the verifier
+// accepts only when allowed explicitly
+var legacyAlgorithms = []string{algSha1}
+
+func isLegacyAlgorithm(alg string) bool {
+	return slices.Contains(legacyAlgorithms, alg)
+}
+
+// costlyAlgorithms cost as much to verify as to solve,
+// the verifier accepts them only when listed explicitly
+var costlyAlgorithms = []string{algSeqSha256}
+
+func isCostlyAlgorithm(alg string) bool {
+	return slices.Contains(costlyAlgorithms, alg)
+}
+
+func isSupportedAlgorithm(alg string) bool {
+	_, ok := lookupWorkFunction(alg)
+	return ok
+}
 
 func resolveHash(alg string) hash.Hash {
 	switch alg {
-	case algSha256:
+	case algSha256, algSeqSha256:
 		return sha256.New()
 	case algSha512:
 		return sha512.New()
@@ -0,0 +1,91 @@
+package hashcache
+
+import (
+	"context"
+	"time"
+)
+
+type AuditDecision string
+
+const (
+	AuditAccept AuditDecision = "accept"
+	AuditReject AuditDecision = "reject"
+)
+
+// AuditRecord describes a single verification decision
+type AuditRecord struct {
+	Time      time.Time
+	StampKey  string
+	Resource  string
+	ClientKey string
+	Tenant    string
+	Decision  AuditDecision
+
+	// Reason of the rejection, Err is kept for errors.Is
+	Reason string
+	Err    error
+
+	// Latency of the verification, the whole batch for VerifyBatch
+	Latency time.Duration
+
+	// Shadow decisions are not enforced, see WithShadowMode
+	Shadow bool
+}
+
+// Auditor receives a record for every verification made on behalf of
+// a client, e.g. to stream the decisions to a SIEM pipeline. It is called
+// synchronously, so slow sinks should buffer the records.
+type Auditor interface {
+	Audit(rec AuditRecord)
+}
+
+// AuditorFunc adapts a function to the Auditor interface
+type AuditorFunc func(rec AuditRecord)
+
+func (f AuditorFunc) Audit(rec AuditRecord) { f(rec) }
+
+// WithAuditor audits the decisions of VerifyFor, VerifyBatch
+// and of the middleware using the verifier
+func WithAuditor(a Auditor) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.Auditor = a
+	}
+}
+
+// audit counts the decision and passes it to the auditor
+func (v *Verifier) audit(ctx context.Context, start time.Time, clientKey string, h Header, err error) {
+	if err != nil {
+		v.rejected.Add(1)
+	} else {
+		v.accepted.Add(1)
+	}
+
+	if v.cfg.Auditor == nil {
+		return
+	}
+
+	rec := AuditRecord{
+		Time:      start,
+		ClientKey: clientKey,
+		Tenant:    TenantFromContext(ctx),
+		Decision:  AuditAccept,
+		Err:       err,
+		Latency:   time.Since(start),
+		Shadow:    isShadow(ctx),
+	}
+
+	if h.Resource != "" {
+		rec.StampKey = StampKey(h)
+		rec.Resource = h.Resource
+		if raw, decodeErr := h.rawResource(); decodeErr == nil {
+			rec.Resource = raw
+		}
+	}
+
+	if err != nil {
+		rec.Decision = AuditReject
+		rec.Reason = err.Error()
+	}
+
+	v.cfg.Auditor.Audit(rec)
+}
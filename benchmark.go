@@ -0,0 +1,74 @@
+package hashcache
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+const benchmarkCheckEvery = 1 << 10
+
+var ErrInvalidDuration = newError(CodeInvalidDuration, "invalid duration")
+
+// Benchmark measures how many hashes per second this machine computes
+// with the algorithm on a single core, running for about d
+func Benchmark(ctx context.Context, alg string, d time.Duration) (float64, error) {
+	if !isSupportedAlgorithm(alg) {
+		return 0, fmt.Errorf("%w: '%s'", ErrUnsupportedAlgorithm, alg)
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidDuration, d)
+	}
+
+	randEncoded, err := randomizer(defaultRandBytesNum)
+	if err != nil {
+		return 0, err
+	}
+
+	h := Header{
+		Ver:        defaultVersion,
+		ZeroBits:   maxSequentialBits,
+		Resource:   "YmVuY2htYXJr",
+		Algorithm:  alg,
+		Rand:       randEncoded,
+		Expiration: clock().UnixNano(),
+	}
+
+	start := time.Now()
+	deadline := start.Add(d)
+
+	var hashes uint64
+	for ; ; hashes++ {
+		if hashes%benchmarkCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+
+			if time.Now().After(deadline) {
+				break
+			}
+		}
+
+		verify(h.Hash(), h.ZeroBits)
+		h.Counter++
+	}
+
+	return float64(hashes) / time.Since(start).Seconds(), nil
+}
+
+// EstimateSolveTime predicts the average time to solve a header
+// with the number of zero bits at the hash rate measured by Benchmark
+func EstimateSolveTime(zeroBits uint8, hashesPerSec float64) time.Duration {
+	if hashesPerSec <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+
+	seconds := expectedHashes(zeroBits) / hashesPerSec
+	if seconds >= float64(math.MaxInt64)/float64(time.Second) {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Duration(seconds * float64(time.Second))
+}
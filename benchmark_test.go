@@ -0,0 +1,149 @@
+package hashcache
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBenchmark(t *testing.T) {
+	t.Parallel()
+
+	rate, err := Benchmark(context.Background(), algSha256, 50*time.Millisecond)
+	require.NoError(t, err)
+	assert.Greater(t, rate, float64(0))
+
+	_, err = Benchmark(context.Background(), "md5", time.Second)
+	assert.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+
+	assert.Equal(t, 4096*time.Second, EstimateSolveTime(3, 1))
+}
+
+func TestCompute_CheckInterval(t *testing.T) {
+	t.Parallel()
+
+	h, err := New("my.email@gmail.com", 64, time.Hour)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = Compute(ContextWithCheckInterval(ctx, 1<<20), h, 0)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, uint64(maxContextCheckInterval), checkInterval(ContextWithCheckInterval(ctx, 1<<20)))
+	assert.Equal(t, uint64(1), checkInterval(ContextWithCheckInterval(ctx, 0)))
+
+	// the workers stop within an interval of the cancellation
+	_, err = ComputeWithPool(ctx, h, WithCheckInterval(1<<16))
+	var computeErr *ComputeError
+	require.ErrorAs(t, err, &computeErr)
+	assert.ErrorIs(t, computeErr.Limit, context.Canceled)
+	assert.LessOrEqual(t, computeErr.Iterations, uint64(defaultPoolConcurrency)<<16)
+}
+
+func BenchmarkCompute_CheckInterval(b *testing.B) {
+	h, err := New("my.email@gmail.com", 64, time.Hour)
+	require.NoError(b, err)
+
+	for _, n := range []int{1, contextCheckInterval, maxContextCheckInterval} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			ctx := ContextWithCheckInterval(context.Background(), n)
+			_, _ = Compute(ctx, h, b.N)
+		})
+	}
+}
+
+func TestCalibration(t *testing.T) {
+	t.Parallel()
+
+	results, err := RunBenchmarkMatrix(context.Background(), BenchmarkMatrix{
+		Algorithms:  []string{algSha256},
+		ZeroBits:    []uint8{1, 2},
+		Concurrency: []int{1, 2},
+		Solves:      2,
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+	assert.Equal(t, uint8(2), results[3].ZeroBits)
+	assert.Equal(t, 2, results[3].Concurrency)
+	for _, r := range results {
+		assert.Greater(t, r.HashesPerSec, float64(0))
+		assert.LessOrEqual(t, r.P50, r.P95)
+	}
+
+	calibration := NewCalibration(2)
+	srv := httptest.NewServer(calibration)
+	defer srv.Close()
+
+	for _, rate := range []float64{100, 300, 200} {
+		report := CalibrationReport{Results: []BenchmarkCaseResult{
+			{Algorithm: algSha256, Concurrency: 1, HashesPerSec: rate},
+			{Algorithm: algSha256, Concurrency: 4, HashesPerSec: 4 * rate},
+		}}
+		require.NoError(t, UploadCalibration(context.Background(), srv.Client(), srv.URL, report))
+	}
+
+	assert.Equal(t, HashRates{algSha256: 300}, calibration.Rates())
+	assert.Equal(t, 95*time.Millisecond, percentile([]time.Duration{10 * time.Millisecond, 95 * time.Millisecond}, 95))
+}
+
+func TestProbeCapabilities(t *testing.T) {
+	t.Parallel()
+
+	c, err := ProbeCapabilities(context.Background())
+	require.NoError(t, err)
+	assert.Positive(t, c.Cores)
+	assert.Contains(t, c.Rates, algSha256)
+	assert.Positive(t, c.MaxZeroBits[algSha256])
+
+	c = Capabilities{
+		Rates:       HashRates{algSha256: 4096, algSha512: 8192},
+		Cores:       2,
+		MaxZeroBits: map[string]uint8{algSha256: 3, algSha512: 4},
+	}
+	assert.Equal(t, Offer{Resource: "127.0.0.1", Algorithms: []string{algSha512, algSha256}, MaxZeroBits: 4}, c.Offer("127.0.0.1"))
+
+	// a 3 bits solve takes a second, two cores do 20 of them in 10 seconds
+	assert.Equal(t, 20, c.MinerQueue(algSha256, 3, 10*time.Second))
+	assert.Equal(t, 1, c.MinerQueue(algSha256, 8, time.Second))
+	assert.Zero(t, c.MinerQueue("md5", 3, time.Second))
+	assert.Equal(t, uint8(4), practicalZeroBits(8192))
+}
+
+func TestComputeWithPool_PowerState(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, SolvingProfile{Concurrency: 8, DutyCycle: 1}, ProfileFor(PowerState{}, 8))
+	assert.Equal(t, SolvingProfile{Concurrency: 4, DutyCycle: 0.5}, ProfileFor(PowerState{OnBattery: true}, 8))
+	assert.Equal(t, SolvingProfile{Concurrency: 2, DutyCycle: 0.5}, ProfileFor(PowerState{OnBattery: true, Thermal: ThermalFair}, 8))
+	assert.Equal(t, SolvingProfile{Concurrency: 1, DutyCycle: 0.5}, ProfileFor(PowerState{Thermal: ThermalSerious}, 8))
+	assert.Equal(t, SolvingProfile{Concurrency: 1, DutyCycle: 0.25}, ProfileFor(PowerState{OnBattery: true, Thermal: ThermalCritical}, 8))
+
+	h, err := New("my.email@gmail.com", 3, time.Hour)
+	require.NoError(t, err)
+
+	critical := PowerStateFunc(func(context.Context) PowerState {
+		return PowerState{Thermal: ThermalCritical}
+	})
+
+	result, err := ComputeWithPool(context.Background(), h, WithPowerState(critical), WithCheckInterval(64))
+	require.NoError(t, err)
+	assert.True(t, result.Header.Valid())
+
+	// the rest between the checks is interrupted by the cancellation
+	h, err = New("my.email@gmail.com", 64, time.Hour)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(ContextWithDutyCycle(context.Background(), 0.01), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = Compute(ctx, h, 0)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
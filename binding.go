@@ -0,0 +1,56 @@
+package hashcache
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// BindRequest is the resource of a stamp bound to the method and the
+// path of the request, e.g. "POST example.com/orders", so that a stamp
+// solved for a cheap endpoint can not be spent on an expensive one
+func BindRequest(resource, method, urlPath string) string {
+	return strings.ToUpper(method) + " " + resource + CanonicalPath(urlPath)
+}
+
+// CanonicalPath cleans the dot segments and the duplicate and trailing
+// slashes of the path, the empty path is the root
+func CanonicalPath(urlPath string) string {
+	if urlPath == "" {
+		return "/"
+	}
+
+	return path.Clean("/" + urlPath)
+}
+
+// WithRequestBinding requires the stamps to be minted for the resource
+// bound to the method and the path of the request, see BindRequest.
+// The challenge handler issues challenges for the method and the path
+// given by its "method" and "path" query parameters.
+func WithRequestBinding() MiddlewareOption {
+	return func(cfg *MiddlewareConfig) {
+		cfg.BindRequest = true
+	}
+}
+
+// requestResource binds the resource func to the method and the path
+func requestResource(resource func(r *http.Request) string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return BindRequest(resource(r), r.Method, r.URL.Path)
+	}
+}
+
+// challengeRequest is the request the challenge handler issues
+// a challenge for, given by the query of the challenge request
+func challengeRequest(r *http.Request) *http.Request {
+	q := r.URL.Query()
+	method, urlPath := q.Get("method"), q.Get("path")
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	target := r.Clone(r.Context())
+	target.Method = method
+	target.URL.Path = urlPath
+	return target
+}
@@ -0,0 +1,95 @@
+package hashcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	bodyResourceSeparator = "#body="
+	bodyExtName           = "body"
+)
+
+var (
+	ErrBodyMismatch = newError(CodeBodyMismatch, "stamp is bound to a different body")
+	ErrBodyTooLarge = newError(CodeBodyTooLarge, "request body too large")
+)
+
+// DigestBody computes the hex encoded sha-256 of the request body while
+// reading it, and puts back a body replaying the bytes read, so that the
+// handler still gets the whole payload. Bodies over maxBytes are rejected
+// with ErrBodyTooLarge, zero means no limit, the body put back then reads
+// the rest of the payload, e.g. for the requests let through in shadow mode.
+func DigestBody(r *http.Request, maxBytes int64) (string, error) {
+	hash := sha256.New()
+	if r.Body == nil || r.Body == http.NoBody {
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	body := r.Body
+	var read io.Reader = body
+	if maxBytes > 0 {
+		read = io.LimitReader(body, maxBytes+1)
+	}
+
+	var buf bytes.Buffer
+	n, err := io.Copy(hash, io.TeeReader(read, &buf))
+	if err == nil && maxBytes > 0 && n > maxBytes {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(&buf, body), body}
+		return "", fmt.Errorf("%w: over %d bytes", ErrBodyTooLarge, maxBytes)
+	}
+
+	body.Close()
+	r.Body = io.NopCloser(&buf)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// BindBody is the resource of a stamp bound to the body with the digest,
+// to be passed to New instead of the plain resource
+func BindBody(resource, digest string) string {
+	return resource + bodyResourceSeparator + digest
+}
+
+// BodyExt is the extension of a stamp bound to the body with the digest,
+// for stamps which keep the plain resource
+func BodyExt(digest string) string {
+	return withExtValue("", bodyExtName, digest)
+}
+
+// WithBodyBinding requires the stamps to be bound to the body of the
+// request, either by their resource, see BindBody, or by their extension,
+// see BodyExt. Bodies are read up to maxBytes to compute their digest.
+// The challenges issued on rejection are bound to the rejected body.
+func WithBodyBinding(maxBytes int64) MiddlewareOption {
+	return func(cfg *MiddlewareConfig) {
+		cfg.BindBody = true
+		cfg.MaxBodyBytes = maxBytes
+	}
+}
+
+// bodyResource is the resource the stamp must be minted for given
+// the digest of the body, an extension binding the body keeps the
+// resource plain
+func bodyResource(h Header, resource, digest string) (string, error) {
+	bound, ok := extValue(h.Ext, bodyExtName)
+	if !ok {
+		return BindBody(resource, digest), nil
+	}
+
+	if bound != digest {
+		return "", ErrBodyMismatch
+	}
+
+	return resource, nil
+}
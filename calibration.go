@@ -0,0 +1,216 @@
+package hashcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMatrixSolves      = 5
+	defaultCalibrationWindow = 100
+	maxCalibrationBytes      = 1 << 20
+)
+
+var ErrCalibrationFailed = newError(CodeCalibrationFailed, "calibration upload failed")
+
+// BenchmarkMatrix is the cross product of the cases RunBenchmarkMatrix solves
+type BenchmarkMatrix struct {
+	Algorithms  []string
+	ZeroBits    []uint8
+	Concurrency []int
+
+	// Solves per case the solve times percentiles are taken of
+	Solves int
+}
+
+// BenchmarkCaseResult of a case of the matrix. The hash rate counts
+// the counters tried, which is exact for a single worker and close
+// to it for the pool, the workers of which interleave.
+type BenchmarkCaseResult struct {
+	Algorithm    string   `json:"algorithm"`
+	ZeroBits     uint8    `json:"zero_bits"`
+	Concurrency  int      `json:"concurrency"`
+	HashesPerSec float64  `json:"hashes_per_sec"`
+	P50          Duration `json:"p50"`
+	P95          Duration `json:"p95"`
+}
+
+// CalibrationReport is the result of a matrix as uploaded to a Calibration
+type CalibrationReport struct {
+	Host    string                `json:"host,omitempty"`
+	Results []BenchmarkCaseResult `json:"results"`
+}
+
+// RunBenchmarkMatrix solves fresh headers for every case of the matrix
+func RunBenchmarkMatrix(ctx context.Context, m BenchmarkMatrix) ([]BenchmarkCaseResult, error) {
+	if m.Solves <= 0 {
+		m.Solves = defaultMatrixSolves
+	}
+
+	var results []BenchmarkCaseResult
+	for _, alg := range m.Algorithms {
+		for _, bits := range m.ZeroBits {
+			for _, concurrency := range m.Concurrency {
+				result, err := runBenchmarkCase(ctx, alg, bits, max(concurrency, 1), m.Solves)
+				if err != nil {
+					return nil, err
+				}
+				results = append(results, result)
+			}
+		}
+	}
+
+	return results, nil
+}
+
+func runBenchmarkCase(ctx context.Context, alg string, zeroBits uint8, concurrency, solves int) (BenchmarkCaseResult, error) {
+	times := make([]time.Duration, 0, solves)
+	var hashes float64
+	var total time.Duration
+
+	for i := 0; i < solves; i++ {
+		h, err := New("benchmark", zeroBits, time.Hour, WithAlgorithm(alg))
+		if err != nil {
+			return BenchmarkCaseResult{}, err
+		}
+
+		start := time.Now()
+		if concurrency == 1 {
+			h, err = Compute(ctx, h, 0)
+		} else {
+			var result ComputeResult
+			result, err = ComputeWithPool(ctx, h, func(cfg *PoolConfig) { cfg.Concurrency = concurrency })
+			h = result.Header
+		}
+		if err != nil {
+			return BenchmarkCaseResult{}, err
+		}
+
+		elapsed := time.Since(start)
+		times = append(times, elapsed)
+		total += elapsed
+		hashes += float64(h.Counter) + 1
+	}
+
+	slices.Sort(times)
+	return BenchmarkCaseResult{
+		Algorithm:    alg,
+		ZeroBits:     zeroBits,
+		Concurrency:  concurrency,
+		HashesPerSec: hashes / max(total.Seconds(), 1e-9),
+		P50:          Duration(percentile(times, 50)),
+		P95:          Duration(percentile(times, 95)),
+	}, nil
+}
+
+// percentile of the sorted durations by the nearest rank
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := (len(sorted)*p + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// UploadCalibration posts the report as JSON to a Calibration served at the url
+func UploadCalibration(ctx context.Context, client *http.Client, url string, report CalibrationReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Join(ErrCalibrationFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: status %d", ErrCalibrationFailed, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Calibration collects the single worker hash rates uploaded by the
+// clients and serves their medians as the HashRates of the difficulty
+// policy, e.g. of ChooseSolver and EquivalentZeroBits
+type Calibration struct {
+	mu     sync.Mutex
+	window int
+	rates  map[string][]float64
+}
+
+// NewCalibration keeping the last window rates per algorithm
+func NewCalibration(window int) *Calibration {
+	if window <= 0 {
+		window = defaultCalibrationWindow
+	}
+
+	return &Calibration{window: window, rates: make(map[string][]float64)}
+}
+
+// Add the single worker results of the report
+func (c *Calibration) Add(report CalibrationReport) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, r := range report.Results {
+		if r.Concurrency != 1 || r.HashesPerSec <= 0 || !isSupportedAlgorithm(r.Algorithm) {
+			continue
+		}
+
+		rates := append(c.rates[r.Algorithm], r.HashesPerSec)
+		if len(rates) > c.window {
+			rates = rates[len(rates)-c.window:]
+		}
+		c.rates[r.Algorithm] = rates
+	}
+}
+
+// Rates are the medians of the collected rates by algorithm
+func (c *Calibration) Rates() HashRates {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rates := make(HashRates, len(c.rates))
+	for alg, collected := range c.rates {
+		sorted := slices.Clone(collected)
+		slices.Sort(sorted)
+		rates[alg] = sorted[len(sorted)/2]
+	}
+
+	return rates
+}
+
+// ServeHTTP accepts a CalibrationReport posted as JSON
+func (c *Calibration) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var report CalibrationReport
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCalibrationBytes)).Decode(&report); err != nil {
+		http.Error(w, "invalid calibration report", http.StatusBadRequest)
+		return
+	}
+
+	c.Add(report)
+	w.WriteHeader(http.StatusNoContent)
+}
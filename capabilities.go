@@ -0,0 +1,104 @@
+package hashcache
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"slices"
+	"time"
+)
+
+const (
+	defaultProbeDuration = 20 * time.Millisecond
+
+	// practicalSolveTime is the longest solve a client is expected to
+	// put up with, the suggested difficulties are sized on it
+	practicalSolveTime = 10 * time.Second
+)
+
+// Capabilities of the machine as measured by ProbeCapabilities
+type Capabilities struct {
+	// Rates are the single core hash rates by algorithm
+	Rates HashRates `json:"rates"`
+
+	Cores int `json:"cores"`
+
+	// MaxZeroBits by algorithm solved by all the cores in about
+	// 10 seconds on average, the most a client should accept
+	MaxZeroBits map[string]uint8 `json:"max_zero_bits"`
+}
+
+// ProbeCapabilities benchmarks the registered hash algorithms
+// for a few milliseconds each
+func ProbeCapabilities(ctx context.Context) (Capabilities, error) {
+	algs := make([]string, 0, len(defaultAlgorithmsOrder))
+	for _, alg := range defaultAlgorithmsOrder {
+		if isSupportedAlgorithm(alg) {
+			algs = append(algs, alg)
+		}
+	}
+
+	rates, err := MeasureHashRates(ctx, defaultProbeDuration, algs...)
+	if err != nil {
+		return Capabilities{}, err
+	}
+
+	c := Capabilities{Rates: rates, Cores: runtime.NumCPU(), MaxZeroBits: make(map[string]uint8, len(rates))}
+	for alg, rate := range rates {
+		c.MaxZeroBits[alg] = practicalZeroBits(rate * float64(c.Cores))
+	}
+
+	return c, nil
+}
+
+// practicalZeroBits are the most zero bits solved
+// within the practical solve time at the rate
+func practicalZeroBits(rate float64) uint8 {
+	var bits uint8
+	for bits < math.MaxUint8 && EstimateSolveTime(bits+1, rate) <= practicalSolveTime {
+		bits++
+	}
+
+	return bits
+}
+
+// Offer for the negotiation of a challenge, preferring the fastest
+// algorithms and accepting at most the practical difficulty of the
+// fastest one
+func (c Capabilities) Offer(resource string) Offer {
+	algs := make([]string, 0, len(c.Rates))
+	for alg := range c.Rates {
+		algs = append(algs, alg)
+	}
+
+	slices.SortFunc(algs, func(a, b string) int {
+		switch {
+		case c.Rates[a] > c.Rates[b]:
+			return -1
+		case c.Rates[a] < c.Rates[b]:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	offer := Offer{Resource: resource, Algorithms: algs}
+	if len(algs) > 0 {
+		offer.MaxZeroBits = c.MaxZeroBits[algs[0]]
+	}
+
+	return offer
+}
+
+// MinerQueue is the number of jobs of the difficulty all the cores
+// complete on average within the latency, the bound of the queue of
+// a Miner the jobs of which must not wait longer, see WithMaxQueue
+func (c Capabilities) MinerQueue(alg string, zeroBits uint8, latency time.Duration) int {
+	solve, err := c.Rates.Cost(alg, zeroBits)
+	if err != nil || solve <= 0 {
+		return 0
+	}
+
+	jobs := float64(latency) / float64(solve) * float64(max(c.Cores, 1))
+	return max(int(min(jobs, math.MaxInt32)), 1)
+}
@@ -0,0 +1,53 @@
+package hashcache
+
+import (
+	"fmt"
+	"sync"
+)
+
+var ErrBrokenChain = newError(CodeBrokenChain, "broken stamp chain")
+
+// ChainTo links the header to the previously accepted stamp of the session
+// by storing its hash in the extension field. It must be called before
+// the work is computed, since the extension is part of the hashed string.
+func (h Header) ChainTo(prev Header) Header {
+	h.Ext = prev.Hash()
+	h.digest = digestMemo{}
+	return h
+}
+
+// Chain keeps the hash of the last accepted stamp per session, every
+// next stamp of the session must carry that hash in its extension field.
+// The first stamp of a session must have an empty extension.
+// Since each hash can be followed only once, a chained stamp can neither
+// be replayed nor shared between sessions.
+type Chain struct {
+	mu   sync.Mutex
+	last map[string]string
+}
+
+func NewChain() *Chain {
+	return &Chain{last: make(map[string]string)}
+}
+
+// Accept advances the session chain to the header
+// if the header continues it.
+func (c *Chain) Accept(session string, h Header) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if last := c.last[session]; h.Ext != last {
+		return fmt.Errorf("%w: session '%s' expects previous hash '%s'", ErrBrokenChain, session, last)
+	}
+
+	c.last[session] = h.Hash()
+	return nil
+}
+
+// Reset forgets the session, so that it can start a new chain
+func (c *Chain) Reset(session string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.last, session)
+}
@@ -0,0 +1,185 @@
+package hashcache
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const challengeSignatureExtName = "sig"
+
+var ErrInvalidChallengeSignature = newError(CodeInvalidSignature, "invalid challenge signature")
+
+// ChallengeResponse is the body of the challenge handler
+type ChallengeResponse struct {
+	Challenge        string `json:"challenge"`
+	RequiredZeroBits uint8  `json:"required_bits"`
+}
+
+// WithSignedChallenges signs the issued challenges with the key,
+// see WithChallengeKeys
+func WithSignedChallenges(key []byte) MiddlewareOption {
+	return func(cfg *MiddlewareConfig) {
+		cfg.ChallengeKeys = &StaticKeyProvider{keys: []SigningKey{{ID: "default", Secret: key}}}
+	}
+}
+
+// WithChallengeKeys signs the issued challenges with an HMAC stored
+// in the "sig" entry of their extension along with the key ID, and
+// accepts only stamps solving a challenge signed with a key of the
+// provider. Chains and sequential work own the whole extension, so
+// signed challenges do not combine with them.
+func WithChallengeKeys(p KeyProvider) MiddlewareOption {
+	return func(cfg *MiddlewareConfig) {
+		cfg.ChallengeKeys = p
+	}
+}
+
+// ChallengeHandler issues challenges for the resource of the caller
+// with the difficulty required from it, for clients which fetch
+// a challenge before making the protected request, e.g. on GET /challenge
+func (m *Middleware) ChallengeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeProblem(w, newProblem(http.StatusMethodNotAllowed, "method_not_allowed", nil))
+			return
+		}
+
+		r = m.withTenant(r)
+		clientKey := m.cfg.ClientKey(r)
+		esc := m.required(endpointRequest(r), clientKey)
+		if esc.Banned {
+			m.ban(w, esc)
+			return
+		}
+
+		target := r
+		if m.cfg.BindRequest {
+			target = challengeRequest(r)
+		}
+
+		h, err := m.issueChallenge(r.Context(), clientKey, m.cfg.Resource(target), esc.ZeroBits)
+		if err != nil {
+			m.rejectIssue(w, err)
+			return
+		}
+
+		w.Header().Set(m.cfg.ChallengeHeader, h.String())
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(ChallengeResponse{Challenge: h.String(), RequiredZeroBits: esc.ZeroBits})
+	})
+}
+
+func (m *Middleware) issueChallenge(ctx context.Context, clientKey, resource string, zeroBits uint8) (Header, error) {
+	h, queued := m.queuedChallenge(ctx, resource, zeroBits)
+	if !queued {
+		var err error
+		if h, err = m.newChallenge(ctx, resource, zeroBits, m.cfg.Challenge.TTL); err != nil {
+			return Header{}, err
+		}
+	}
+
+	if m.cfg.IssueLimiter != nil {
+		if err := m.cfg.IssueLimiter.Issue(clientKey, h); err != nil {
+			if queued {
+				m.requeueChallenge(ctx, resource, zeroBits, h)
+			}
+			return Header{}, err
+		}
+	}
+
+	// the queued challenges are recorded by Pregenerate
+	if queued {
+		return h, nil
+	}
+
+	if err := m.cfg.Verifier.RecordChallenge(ctx, h); err != nil {
+		return Header{}, err
+	}
+
+	return h, nil
+}
+
+// newChallenge from the template, signed when challenges are signed
+func (m *Middleware) newChallenge(ctx context.Context, resource string, zeroBits uint8, ttl time.Duration) (Header, error) {
+	tmpl := m.cfg.Challenge
+	tmpl.ZeroBits = zeroBits
+	tmpl.TTL = ttl
+	tmpl.Options = append(slices.Clip(tmpl.Options), NormalizeWith(m.cfg.Verifier.cfg.ResourceNormalizer))
+
+	h, err := tmpl.Issue(resource)
+	if err != nil {
+		return Header{}, err
+	}
+
+	if m.cfg.ChallengeKeys != nil {
+		key, err := m.cfg.ChallengeKeys.Current(ctx)
+		if err != nil {
+			return Header{}, err
+		}
+
+		h.Ext = withExtValue(h.Ext, challengeSignatureExtName,
+			key.ID+"."+base64.RawURLEncoding.EncodeToString(challengeSignature(key.Secret, h)))
+	}
+
+	return h, nil
+}
+
+// checkChallengeSignature of the stamp when challenges are signed
+func (m *Middleware) checkChallengeSignature(ctx context.Context, h Header) error {
+	if m.cfg.ChallengeKeys == nil {
+		return nil
+	}
+
+	signed, ok := extValue(h.Ext, challengeSignatureExtName)
+	if !ok {
+		return ErrInvalidChallengeSignature
+	}
+
+	id, sig, ok := strings.Cut(signed, ".")
+	if !ok {
+		return ErrInvalidChallengeSignature
+	}
+
+	key, err := m.cfg.ChallengeKeys.Lookup(ctx, id)
+	if err != nil {
+		return errors.Join(ErrInvalidChallengeSignature, err)
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(decoded, challengeSignature(key.Secret, h)) {
+		return ErrInvalidChallengeSignature
+	}
+
+	return nil
+}
+
+// challengeSignature covers the fields fixed by the issuer,
+// leaving out the counter found by the client
+func challengeSignature(key []byte, h Header) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(challengeFields(h)))
+	return mac.Sum(nil)
+}
+
+// challengeFields are the fields of the challenge fixed by the issuer
+func challengeFields(h Header) string {
+	return strings.Join([]string{
+		strconv.Itoa(int(h.Ver)),
+		strconv.Itoa(int(h.ZeroBits)),
+		strconv.FormatInt(h.Expiration, 10),
+		h.Resource,
+		h.Algorithm,
+		h.Rand,
+	}, ":")
+}
@@ -0,0 +1,85 @@
+// Command hashcash-proxy is a reverse proxy which requires a valid
+// hashcash stamp on every request before forwarding it upstream.
+//
+//	hashcash-proxy -listen :8080 -upstream http://localhost:9000 -config config.json
+//
+// The verifier, store and middleware are configured by the config file
+// and the HASHCASH_ environment variables, see hashcache.Config.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/denismitr/hashcache"
+)
+
+func main() {
+	listen := flag.String("listen", ":8080", "address to listen on")
+	upstream := flag.String("upstream", "", "url of the protected service")
+	configPath := flag.String("config", "", "path of the json config file")
+	flag.Parse()
+
+	if err := run(*listen, *upstream, *configPath); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(listen, upstream, configPath string) error {
+	if upstream == "" {
+		return errors.New("upstream is required")
+	}
+
+	target, err := url.Parse(upstream)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := hashcache.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	sys, err := hashcache.NewSystem(cfg)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:              listen,
+		Handler:           sys.Handler(httputil.NewSingleHostReverseProxy(target)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("proxying %s to %s", listen, target)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err == nil {
+		err = srv.Shutdown(shutdownCtx)
+	}
+
+	return errors.Join(err, sys.Close(shutdownCtx))
+}
@@ -0,0 +1,134 @@
+// Command hashcash is the command line companion of the library.
+//
+//	hashcash inspect <stamp>
+//	hashcash bench [flags]
+//
+// inspect describes a stamp, e.g. one copied from a rejected request,
+// reading it from stdin when it is not given as an argument.
+//
+// bench solves a matrix of algorithms, zero bits and concurrency levels
+// and prints the hash rates and the solve time percentiles as JSON,
+// optionally uploading them to the calibration endpoint of a server.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denismitr/hashcache"
+)
+
+const usage = `usage: hashcash <command> [arguments]
+
+commands:
+  inspect [stamp]   describe a stamp, read from stdin when omitted
+  bench [flags]     benchmark a matrix of cases, see hashcash bench -h
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	switch args[0] {
+	case "inspect":
+		return inspect(args[1:], stdin, stdout)
+	case "bench":
+		return bench(args[1:], stdout)
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", args[0], usage)
+	}
+}
+
+func inspect(args []string, stdin io.Reader, stdout io.Writer) error {
+	var stamp string
+	switch len(args) {
+	case 0:
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		stamp = strings.TrimSpace(line)
+	case 1:
+		stamp = args[0]
+	default:
+		return errors.New(usage)
+	}
+
+	description, err := hashcache.DescribeStamp(stamp)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(stdout, description)
+	return err
+}
+
+func bench(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	algs := fs.String("algs", "sha-256,sha-512", "algorithms, comma separated")
+	bits := fs.String("bits", "3,4", "zero bits, comma separated")
+	concurrency := fs.String("concurrency", "1,4", "concurrency levels, comma separated")
+	solves := fs.Int("solves", 5, "solves per case")
+	upload := fs.String("upload", "", "url of the calibration endpoint to upload the results to")
+	timeout := fs.Duration("timeout", 10*time.Minute, "timeout of the whole benchmark")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	matrix := hashcache.BenchmarkMatrix{Algorithms: strings.Split(*algs, ","), Solves: *solves}
+	for _, item := range strings.Split(*bits, ",") {
+		n, err := strconv.ParseUint(strings.TrimSpace(item), 10, 8)
+		if err != nil {
+			return fmt.Errorf("invalid zero bits %q", item)
+		}
+		matrix.ZeroBits = append(matrix.ZeroBits, uint8(n))
+	}
+	for _, item := range strings.Split(*concurrency, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid concurrency %q", item)
+		}
+		matrix.Concurrency = append(matrix.Concurrency, n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	results, err := hashcache.RunBenchmarkMatrix(ctx, matrix)
+	if err != nil {
+		return err
+	}
+
+	report := hashcache.CalibrationReport{Results: results}
+	report.Host, _ = os.Hostname()
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+
+	if *upload == "" {
+		return nil
+	}
+
+	return hashcache.UploadCalibration(ctx, http.DefaultClient, *upload, report)
+}
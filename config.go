@@ -0,0 +1,470 @@
+package hashcache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	StoreMemory = "memory"
+	StoreLRU    = "lru"
+	StoreNone   = "none"
+
+	// DefaultConfigEnvPrefix of the environment variables read by LoadConfig
+	DefaultConfigEnvPrefix = "HASHCASH"
+)
+
+var ErrInvalidConfig = newError(CodeInvalidConfig, "invalid config")
+
+// Duration is a time.Duration written as "1m30s" in config files
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// Config of the server side components. It is loaded from a JSON file
+// and from environment variables named after the JSON keys, e.g.
+// HASHCASH_VERIFIER_MIN_ZERO_BITS overrides verifier.min_zero_bits.
+type Config struct {
+	Verifier   VerifierSettings   `json:"verifier"`
+	Store      StoreSettings      `json:"store"`
+	Middleware MiddlewareSettings `json:"middleware"`
+	Controller ControllerSettings `json:"controller"`
+}
+
+type VerifierSettings struct {
+	MinZeroBits           uint8    `json:"min_zero_bits"`
+	MinRandBytes          int      `json:"min_rand_bytes"`
+	MaxClockSkew          Duration `json:"max_clock_skew"`
+	MaxTTL                Duration `json:"max_ttl"`
+	AllowLegacyAlgorithms bool     `json:"allow_legacy_algorithms"`
+	ReplayGrace           Duration `json:"replay_grace"`
+	ReplayWindow          Duration `json:"replay_window"`
+
+	// AlgorithmMinZeroBits are written as "sha-1=22,sha-512=20"
+	// in the environment
+	AlgorithmMinZeroBits map[string]uint8 `json:"algorithm_min_zero_bits"`
+
+	// AllowedResources and DeniedResources are the resource patterns,
+	// see WithAllowedResources
+	AllowedResources []string `json:"allowed_resources"`
+	DeniedResources  []string `json:"denied_resources"`
+}
+
+// StoreSettings select the spent stamp store. Stores backed by external
+// services need a client and are configured in code.
+type StoreSettings struct {
+	Kind            string   `json:"kind"`
+	Capacity        int      `json:"capacity"`
+	JanitorInterval Duration `json:"janitor_interval"`
+}
+
+type MiddlewareSettings struct {
+	StampHeader     string   `json:"stamp_header"`
+	ChallengeHeader string   `json:"challenge_header"`
+	ChallengeTTL    Duration `json:"challenge_ttl"`
+
+	// EscalationSteps enable the ladder escalation when not empty,
+	// they are ints since JSON encodes byte slices as base64
+	EscalationSteps []int    `json:"escalation_steps"`
+	BanDuration     Duration `json:"ban_duration"`
+
+	// MaxOutstandingChallenges and ChallengesPerMinute per client,
+	// zero meaning no limit, see WithIssueLimits
+	MaxOutstandingChallenges int `json:"max_outstanding_challenges"`
+	ChallengesPerMinute      int `json:"challenges_per_minute"`
+
+	// EndpointZeroBits by endpoint pattern, see EndpointRoutes, written
+	// as "/search=18,POST /signup=24" in the environment
+	EndpointZeroBits map[string]uint8 `json:"endpoint_zero_bits"`
+
+	// Shadow lets the requests through without enforcing the stamps,
+	// see WithShadowMode
+	Shadow bool `json:"shadow"`
+
+	// CostHeaders report the cost of the accepted stamps,
+	// see WithCostHeaders
+	CostHeaders bool `json:"cost_headers"`
+}
+
+// ControllerSettings of the difficulty controller,
+// which is disabled while the target is zero
+type ControllerSettings struct {
+	Target          Duration `json:"target"`
+	InitialZeroBits uint8    `json:"initial_zero_bits"`
+	MinZeroBits     uint8    `json:"min_zero_bits"`
+	MaxZeroBits     uint8    `json:"max_zero_bits"`
+	Window          int      `json:"window"`
+	Kp              float64  `json:"kp"`
+	Ki              float64  `json:"ki"`
+	Kd              float64  `json:"kd"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Verifier: VerifierSettings{MinRandBytes: MinRandBytes, ReplayGrace: Duration(DefaultReplayGrace)},
+		Store:    StoreSettings{Kind: StoreMemory, JanitorInterval: Duration(time.Minute)},
+		Middleware: MiddlewareSettings{
+			StampHeader:     DefaultStampHeader,
+			ChallengeHeader: DefaultChallengeHeader,
+			ChallengeTTL:    Duration(defaultChallengeTTL),
+		},
+		Controller: ControllerSettings{MaxZeroBits: math.MaxUint8},
+	}
+}
+
+// LoadConfig reads the defaults, overrides them with the file when
+// the path is not empty and then with the environment, and validates
+// the result.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return Config{}, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+	}
+
+	if err := cfg.LoadEnv(DefaultConfigEnvPrefix, os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// LoadEnv overrides the settings with the variables found by lookup
+func (c *Config) LoadEnv(prefix string, lookup func(key string) (string, bool)) error {
+	return loadEnv(reflect.ValueOf(c).Elem(), prefix, lookup)
+}
+
+func loadEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := prefix + "_" + strings.ToUpper(field.Tag.Get("json"))
+
+		if field.Type.Kind() == reflect.Struct {
+			if err := loadEnv(v.Field(i), key, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		raw, ok := lookup(key)
+		if !ok {
+			continue
+		}
+
+		if err := setEnvValue(v.Field(i), raw); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrInvalidConfig, key, err)
+		}
+	}
+
+	return nil
+}
+
+func setEnvValue(v reflect.Value, raw string) error {
+	if u, ok := v.Addr().Interface().(interface{ UnmarshalText([]byte) error }); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.ParseInt(raw, 10, 0)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint8:
+		n, err := strconv.ParseUint(raw, 10, 8)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		if raw != "" {
+			items = strings.Split(raw, ",")
+		}
+
+		s := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setEnvValue(s.Index(i), strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+
+			key, value, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("invalid entry '%s'", item)
+			}
+
+			k, e := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+			if err := setEnvValue(k, strings.TrimSpace(key)); err != nil {
+				return err
+			}
+			if err := setEnvValue(e, strings.TrimSpace(value)); err != nil {
+				return err
+			}
+			m.SetMapIndex(k, e)
+		}
+		v.Set(m)
+	default:
+		return fmt.Errorf("unsupported kind %s", v.Kind())
+	}
+
+	return nil
+}
+
+// Validate catches contradictory settings, all the problems found are joined
+func (c Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]any{ErrInvalidConfig}, args...)...))
+	}
+
+	if c.Verifier.MinRandBytes < MinRandBytes {
+		fail("verifier min rand bytes %d is below %d", c.Verifier.MinRandBytes, MinRandBytes)
+	}
+
+	if c.Verifier.MaxClockSkew < 0 || c.Verifier.MaxTTL < 0 || c.Verifier.ReplayGrace < 0 || c.Verifier.ReplayWindow < 0 {
+		fail("verifier durations must not be negative")
+	}
+
+	if slices.Contains(c.Verifier.AllowedResources, "") || slices.Contains(c.Verifier.DeniedResources, "") {
+		fail("verifier resource patterns must not be empty")
+	}
+
+	switch c.Store.Kind {
+	case StoreMemory, StoreNone:
+	case StoreLRU:
+		if c.Store.Capacity <= 0 {
+			fail("lru store capacity must be positive")
+		}
+	default:
+		fail("unknown store kind '%s'", c.Store.Kind)
+	}
+
+	if c.Middleware.StampHeader == "" || c.Middleware.ChallengeHeader == "" {
+		fail("middleware headers must not be empty")
+	}
+
+	if c.Middleware.ChallengeTTL <= 0 {
+		fail("challenge ttl must be positive")
+	}
+
+	if c.Verifier.MaxTTL > 0 && c.Middleware.ChallengeTTL > c.Verifier.MaxTTL {
+		fail("challenge ttl %s exceeds verifier max ttl %s",
+			time.Duration(c.Middleware.ChallengeTTL), time.Duration(c.Verifier.MaxTTL))
+	}
+
+	for _, step := range c.Middleware.EscalationSteps {
+		if step < 0 || step > math.MaxUint8 {
+			fail("escalation step %d is out of range", step)
+			break
+		}
+
+		if step < int(c.Verifier.MinZeroBits) {
+			fail("escalation step %d is below verifier min zero bits %d", step, c.Verifier.MinZeroBits)
+			break
+		}
+	}
+
+	if len(c.Middleware.EscalationSteps) > 0 && c.Middleware.BanDuration <= 0 {
+		fail("ban duration must be positive with escalation steps")
+	}
+
+	if c.Middleware.MaxOutstandingChallenges < 0 || c.Middleware.ChallengesPerMinute < 0 {
+		fail("challenge issue limits must not be negative")
+	}
+
+	if _, err := c.Middleware.endpointRoutes(); err != nil {
+		fail("%s", err)
+	}
+
+	if ctrl := c.Controller; ctrl.Target > 0 {
+		if ctrl.MinZeroBits > ctrl.MaxZeroBits {
+			fail("controller min zero bits %d exceed max zero bits %d", ctrl.MinZeroBits, ctrl.MaxZeroBits)
+		}
+
+		if ctrl.MinZeroBits < c.Verifier.MinZeroBits {
+			fail("controller min zero bits %d are below verifier min zero bits %d",
+				ctrl.MinZeroBits, c.Verifier.MinZeroBits)
+		}
+
+		if ctrl.Window < 0 || ctrl.Kp < 0 || ctrl.Ki < 0 || ctrl.Kd < 0 {
+			fail("controller window and gains must not be negative")
+		}
+	} else if ctrl.Target < 0 {
+		fail("controller target must not be negative")
+	}
+
+	return errors.Join(errs...)
+}
+
+// NewStore of the configured kind, nil for StoreNone
+func (c Config) NewStore() SpentStampStore {
+	switch c.Store.Kind {
+	case StoreLRU:
+		return NewLRUStore(c.Store.Capacity)
+	case StoreNone:
+		return nil
+	default:
+		return NewMemoryStore(WithJanitorInterval(time.Duration(c.Store.JanitorInterval)))
+	}
+}
+
+func (c Config) NewVerifier(store SpentStampStore, extra ...VerifierOption) *Verifier {
+	opts := []VerifierOption{
+		WithMinZeroBits(c.Verifier.MinZeroBits),
+		WithMinRandBytes(c.Verifier.MinRandBytes),
+		WithMaxClockSkew(time.Duration(c.Verifier.MaxClockSkew)),
+		WithMaxTTL(time.Duration(c.Verifier.MaxTTL)),
+		WithReplayGrace(time.Duration(c.Verifier.ReplayGrace)),
+		WithReplayWindow(time.Duration(c.Verifier.ReplayWindow)),
+	}
+
+	for alg, bits := range c.Verifier.AlgorithmMinZeroBits {
+		opts = append(opts, WithAlgorithmMinZeroBits(alg, bits))
+	}
+
+	if store != nil {
+		opts = append(opts, WithSpentStore(store))
+	}
+
+	if c.Verifier.AllowLegacyAlgorithms {
+		opts = append(opts, AllowLegacyAlgorithms())
+	}
+
+	if len(c.Verifier.AllowedResources) > 0 {
+		opts = append(opts, WithAllowedResources(c.Verifier.AllowedResources...))
+	}
+
+	if len(c.Verifier.DeniedResources) > 0 {
+		opts = append(opts, WithDeniedResources(c.Verifier.DeniedResources...))
+	}
+
+	return NewVerifier(append(opts, extra...)...)
+}
+
+func (c Config) NewMiddleware(v *Verifier, opts ...MiddlewareOption) *Middleware {
+	mw := c.Middleware
+	base := []MiddlewareOption{
+		WithMiddlewareVerifier(v),
+		WithChallengeTTL(time.Duration(mw.ChallengeTTL)),
+		func(cfg *MiddlewareConfig) {
+			cfg.StampHeader = mw.StampHeader
+			cfg.ChallengeHeader = mw.ChallengeHeader
+		},
+	}
+
+	if len(mw.EscalationSteps) > 0 {
+		steps := make([]uint8, len(mw.EscalationSteps))
+		for i, step := range mw.EscalationSteps {
+			steps[i] = uint8(step)
+		}
+		base = append(base, WithEscalation(NewLadderEscalation(steps, time.Duration(mw.BanDuration))))
+	}
+
+	if mw.Shadow {
+		base = append(base, WithShadowMode())
+	}
+
+	if mw.CostHeaders {
+		base = append(base, WithCostHeaders())
+	}
+
+	if routes, err := mw.endpointRoutes(); err == nil && routes != nil {
+		base = append(base, WithEndpointRoutes(routes))
+	}
+
+	if mw.MaxOutstandingChallenges > 0 || mw.ChallengesPerMinute > 0 {
+		base = append(base, WithIssueLimits(IssueLimits{
+			MaxOutstanding: mw.MaxOutstandingChallenges,
+			PerMinute:      mw.ChallengesPerMinute,
+		}))
+	}
+
+	return NewMiddleware(append(base, opts...)...)
+}
+
+// endpointRoutes compiles the endpoint difficulties, nil when there are none
+func (mw MiddlewareSettings) endpointRoutes() (*EndpointRoutes, error) {
+	if len(mw.EndpointZeroBits) == 0 {
+		return nil, nil
+	}
+
+	routes := make([]EndpointRoute, 0, len(mw.EndpointZeroBits))
+	for pattern, zeroBits := range mw.EndpointZeroBits {
+		routes = append(routes, EndpointRoute{Pattern: pattern, ZeroBits: zeroBits})
+	}
+
+	return NewEndpointRoutes(routes...)
+}
+
+// NewDifficultyController or nil when the controller is disabled
+func (c Config) NewDifficultyController() *DifficultyController {
+	ctrl := c.Controller
+	if ctrl.Target <= 0 {
+		return nil
+	}
+
+	return NewDifficultyController(DifficultyControllerConfig{
+		Target:          time.Duration(ctrl.Target),
+		InitialZeroBits: ctrl.InitialZeroBits,
+		MinZeroBits:     ctrl.MinZeroBits,
+		MaxZeroBits:     ctrl.MaxZeroBits,
+		Window:          ctrl.Window,
+		Kp:              ctrl.Kp,
+		Ki:              ctrl.Ki,
+		Kd:              ctrl.Kd,
+	})
+}
@@ -0,0 +1,151 @@
+package hashcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"verifier": {"min_zero_bits": 3, "max_ttl": "10m"},
+		"store": {"kind": "lru", "capacity": 100},
+		"middleware": {"escalation_steps": [3, 4], "ban_duration": "1m"}
+	}`), 0o600))
+
+	t.Setenv("HASHCASH_VERIFIER_MAX_CLOCK_SKEW", "5s")
+	t.Setenv("HASHCASH_MIDDLEWARE_ESCALATION_STEPS", "3,4,5")
+	t.Setenv("HASHCASH_VERIFIER_ALLOW_LEGACY_ALGORITHMS", "true")
+	t.Setenv("HASHCASH_VERIFIER_ALGORITHM_MIN_ZERO_BITS", "sha-1=5, sha-512=2")
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint8(3), cfg.Verifier.MinZeroBits)
+	assert.Equal(t, Duration(10*time.Minute), cfg.Verifier.MaxTTL)
+	assert.Equal(t, Duration(5*time.Second), cfg.Verifier.MaxClockSkew)
+	assert.Equal(t, MinRandBytes, cfg.Verifier.MinRandBytes)
+	assert.Equal(t, []int{3, 4, 5}, cfg.Middleware.EscalationSteps)
+	assert.True(t, cfg.Verifier.AllowLegacyAlgorithms)
+	assert.Equal(t, map[string]uint8{algSha1: 5, algSha512: 2}, cfg.Verifier.AlgorithmMinZeroBits)
+	policy := cfg.NewVerifier(nil).Policy()
+	assert.Equal(t, uint8(5), policy.MinZeroBitsFor(algSha1))
+	assert.IsType(t, &LRUStore{}, cfg.NewStore())
+	assert.Nil(t, cfg.NewDifficultyController())
+}
+
+func TestConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name   string
+		modify func(cfg *Config)
+		valid  bool
+	}{
+		{name: "defaults", modify: func(cfg *Config) {}, valid: true},
+		{name: "controller min above max", modify: func(cfg *Config) {
+			cfg.Controller = ControllerSettings{Target: Duration(time.Second), MinZeroBits: 5, MaxZeroBits: 4}
+		}},
+		{name: "controller min below verifier min", modify: func(cfg *Config) {
+			cfg.Verifier.MinZeroBits = 3
+			cfg.Controller = ControllerSettings{Target: Duration(time.Second), MinZeroBits: 2, MaxZeroBits: 4}
+		}},
+		{name: "challenge ttl above max ttl", modify: func(cfg *Config) {
+			cfg.Verifier.MaxTTL = Duration(time.Second)
+		}},
+		{name: "escalation step below min", modify: func(cfg *Config) {
+			cfg.Verifier.MinZeroBits = 3
+			cfg.Middleware.EscalationSteps = []int{2, 3}
+			cfg.Middleware.BanDuration = Duration(time.Minute)
+		}},
+		{name: "invalid endpoint pattern", modify: func(cfg *Config) {
+			cfg.Middleware.EndpointZeroBits = map[string]uint8{"search": 18}
+		}},
+		{name: "empty resource pattern", modify: func(cfg *Config) { cfg.Verifier.DeniedResources = []string{""} }},
+		{name: "negative issue limit", modify: func(cfg *Config) { cfg.Middleware.ChallengesPerMinute = -1 }},
+		{name: "unknown store", modify: func(cfg *Config) { cfg.Store.Kind = "etcd" }},
+		{name: "lru without capacity", modify: func(cfg *Config) { cfg.Store.Kind = StoreLRU }},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := DefaultConfig()
+			tc.modify(&cfg)
+
+			err := cfg.Validate()
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidConfig)
+			}
+		})
+	}
+}
+
+func TestNewSystem(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	cfg := DefaultConfig()
+	cfg.Verifier.MinZeroBits = 1
+	cfg.Controller = ControllerSettings{Target: Duration(time.Second), InitialZeroBits: 2, MinZeroBits: 1, MaxZeroBits: 4}
+
+	var logs bytes.Buffer
+	sys, err := NewSystem(cfg, WithSystemLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	require.NoError(t, err)
+	defer sys.Close(context.Background())
+
+	rec := httptest.NewRecorder()
+	sys.ChallengeHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/challenge", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp ChallengeResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, uint8(2), resp.RequiredZeroBits, "the controller sets the difficulty")
+
+	stamp, err := SolveChallenge(context.Background(), resp.Challenge, 0)
+	require.NoError(t, err)
+
+	protected := sys.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	do := func(stamp string) int {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.Header.Set(DefaultStampHeader, stamp)
+		rec := httptest.NewRecorder()
+		protected.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, do(stamp))
+	assert.Equal(t, http.StatusForbidden, do(stamp), "the store rejects replays")
+	assert.Contains(t, logs.String(), "stamp already spent")
+
+	rec = httptest.NewRecorder()
+	sys.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var stats AdminStats
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&stats))
+	assert.Equal(t, VerifierStats{Accepted: 1, Rejected: 1}, stats.Verifier)
+	require.NotNil(t, stats.Work)
+
+	cfg.Middleware.ChallengeTTL = 0
+	_, err = NewSystem(cfg)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
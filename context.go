@@ -0,0 +1,32 @@
+package hashcache
+
+import "context"
+
+// VerifiedStamp is attached to the request context by the middleware
+// once the stamp of the request is accepted
+type VerifiedStamp struct {
+	Header Header
+
+	// RequiredZeroBits is the difficulty the client was asked for,
+	// the stamp may carry more
+	RequiredZeroBits uint8
+
+	// Score of the stamp by the default scorer
+	Score float64
+
+	// Grade of the stamp against RequiredZeroBits
+	Grade Grade
+}
+
+type stampContextKey struct{}
+
+func ContextWithStamp(ctx context.Context, s VerifiedStamp) context.Context {
+	return context.WithValue(ctx, stampContextKey{}, s)
+}
+
+// StampFromContext returns the stamp verified for the request,
+// false if the request was let through without one
+func StampFromContext(ctx context.Context) (VerifiedStamp, bool) {
+	s, ok := ctx.Value(stampContextKey{}).(VerifiedStamp)
+	return s, ok
+}
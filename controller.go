@@ -0,0 +1,114 @@
+package hashcache
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultControllerWindow = 31
+	defaultControllerKp     = 0.5
+	defaultControllerKi     = 0.05
+	defaultControllerKd     = 0.1
+
+	// each zero bit multiplies the expected work by 16
+	workPerZeroBit = 16
+)
+
+type DifficultyControllerConfig struct {
+	// Target median solve time
+	Target time.Duration
+
+	InitialZeroBits uint8
+	MinZeroBits     uint8
+	MaxZeroBits     uint8
+
+	// Window is the number of most recent solve times the median is taken of
+	Window int
+
+	// Gains of the proportional, integral and derivative terms
+	Kp, Ki, Kd float64
+}
+
+// DifficultyController adjusts the advertised zero bits so that the median
+// of solve times reported by clients tracks the target, compensating for
+// the drift of client hardware over time. The error is measured in zero
+// bits: log16 of the ratio between the target and the median solve time.
+type DifficultyController struct {
+	mu       sync.Mutex
+	cfg      DifficultyControllerConfig
+	samples  []time.Duration
+	next     int
+	bits     float64
+	integral float64
+	prevErr  float64
+}
+
+func NewDifficultyController(cfg DifficultyControllerConfig) *DifficultyController {
+	if cfg.Window <= 0 {
+		cfg.Window = defaultControllerWindow
+	}
+
+	if cfg.Kp == 0 && cfg.Ki == 0 && cfg.Kd == 0 {
+		cfg.Kp, cfg.Ki, cfg.Kd = defaultControllerKp, defaultControllerKi, defaultControllerKd
+	}
+
+	if cfg.MaxZeroBits == 0 {
+		cfg.MaxZeroBits = math.MaxUint8
+	}
+
+	// an inverted range is taken for the range of its bounds
+	if cfg.MinZeroBits > cfg.MaxZeroBits {
+		cfg.MinZeroBits, cfg.MaxZeroBits = cfg.MaxZeroBits, cfg.MinZeroBits
+	}
+
+	return &DifficultyController{
+		cfg:     cfg,
+		samples: make([]time.Duration, 0, cfg.Window),
+		bits:    float64(min(max(cfg.InitialZeroBits, cfg.MinZeroBits), cfg.MaxZeroBits)),
+	}
+}
+
+// Observe a solve time reported by a client and adjust the difficulty
+func (c *DifficultyController) Observe(solveTime time.Duration) {
+	if solveTime <= 0 || c.cfg.Target <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.samples) < c.cfg.Window {
+		c.samples = append(c.samples, solveTime)
+	} else {
+		c.samples[c.next] = solveTime
+		c.next = (c.next + 1) % c.cfg.Window
+	}
+
+	err := math.Log(float64(c.cfg.Target)/float64(c.median())) / math.Log(workPerZeroBit)
+
+	// clamping the integral prevents windup while the bits are saturated
+	bound := float64(c.cfg.MaxZeroBits) - float64(c.cfg.MinZeroBits)
+	c.integral = min(max(c.integral+err, -bound), bound)
+	derivative := err - c.prevErr
+	c.prevErr = err
+
+	output := c.cfg.Kp*err + c.cfg.Ki*c.integral + c.cfg.Kd*derivative
+	c.bits = min(max(c.bits+output, float64(c.cfg.MinZeroBits)), float64(c.cfg.MaxZeroBits))
+}
+
+// ZeroBits to advertise to clients
+func (c *DifficultyController) ZeroBits() uint8 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return uint8(math.Round(c.bits))
+}
+
+func (c *DifficultyController) median() time.Duration {
+	sorted := slices.Clone(c.samples)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
@@ -0,0 +1,84 @@
+package hashcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDifficultyController(t *testing.T) {
+	t.Parallel()
+
+	c := NewDifficultyController(DifficultyControllerConfig{
+		Target:          2 * time.Second,
+		InitialZeroBits: 5,
+		MinZeroBits:     2,
+		MaxZeroBits:     8,
+	})
+
+	// clients solving in 1/256 of the target need two more zero bits
+	solveTime := func(bits uint8) time.Duration {
+		return 2 * time.Second * time.Duration(expectedHashes(bits)) / time.Duration(expectedHashes(7))
+	}
+
+	for i := 0; i < 200; i++ {
+		c.Observe(solveTime(c.ZeroBits()))
+	}
+
+	assert.Equal(t, uint8(7), c.ZeroBits())
+
+	// an inverted range is swapped, the bits stay within it
+	c = NewDifficultyController(DifficultyControllerConfig{
+		Target:          2 * time.Second,
+		InitialZeroBits: 5,
+		MinZeroBits:     8,
+		MaxZeroBits:     2,
+	})
+
+	for i := 0; i < 200; i++ {
+		c.Observe(time.Millisecond)
+	}
+	assert.Equal(t, uint8(8), c.ZeroBits())
+
+	// the integral is bounded, so that the bits leave the bound
+	// as soon as the solve times are over the target
+	for i := 0; i < defaultControllerWindow; i++ {
+		c.Observe(time.Hour)
+	}
+	assert.Equal(t, uint8(2), c.ZeroBits())
+}
+
+func TestVerifier_SolveReports(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	mint := func(r SolveReport) Header {
+		h, err := New("my.email@gmail.com", 2, time.Hour)
+		require.NoError(t, err)
+		h, err = Compute(context.Background(), h.WithSolveReport(r), 0)
+		require.NoError(t, err)
+		return h
+	}
+
+	c := NewDifficultyController(DifficultyControllerConfig{Target: time.Second, InitialZeroBits: 2, Window: 1})
+	hist := NewWorkHistogram()
+	v := NewVerifier(WithSolveReports(c), WithWorkHistogram(hist))
+
+	h := mint(SolveReport{Time: 20 * time.Millisecond, Iterations: 300})
+	report, ok := SolveReportOf(h)
+	require.True(t, ok)
+	assert.Equal(t, SolveReport{Time: 20 * time.Millisecond, Iterations: 300}, report)
+
+	require.NoError(t, v.VerifyFor(context.Background(), "client", h))
+	assert.Greater(t, c.ZeroBits(), uint8(2))
+	assert.Equal(t, uint64(1), hist.Snapshot().SolveTimes[1])
+
+	assert.ErrorIs(t, v.Verify(mint(SolveReport{Time: time.Second})), ErrImplausibleReport)
+	assert.ErrorIs(t, v.Verify(mint(SolveReport{Time: time.Second, Iterations: 1 << 20})), ErrImplausibleReport)
+	fast := Header{ZeroBits: 10}.WithSolveReport(SolveReport{Time: time.Millisecond, Iterations: 1 << 30})
+	assert.ErrorIs(t, v.checkReport(fast), ErrImplausibleReport)
+	require.NoError(t, v.Verify(mint(SolveReport{Time: 2 * time.Second, Iterations: 10000})))
+}
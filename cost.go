@@ -0,0 +1,43 @@
+package hashcache
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Headers of the responses to the requests with an accepted stamp,
+// see WithCostHeaders
+const (
+	CostBitsHeader     = "X-Hashcash-Bits"
+	CostCreditHeader   = "X-Hashcash-Credit"
+	CostNextBitsHeader = "X-Hashcash-Next-Bits"
+)
+
+// WithCostHeaders reports the cost of the accepted stamps in the response
+// headers: the zero bits of the stamp, the credit left in the ledger of
+// the verifier if any, and the zero bits the next request of the client
+// will need, so that well-behaved clients mint ahead the right stamps
+func WithCostHeaders() MiddlewareOption {
+	return func(cfg *MiddlewareConfig) {
+		cfg.CostHeaders = true
+	}
+}
+
+// writeCostHeaders of the accepted stamp once the outcome is recorded
+func (m *Middleware) writeCostHeaders(w http.ResponseWriter, r *http.Request, clientKey string, h Header) {
+	w.Header().Set(CostBitsHeader, strconv.Itoa(int(h.ZeroBits)))
+
+	if ledger := m.cfg.Verifier.cfg.Ledger; ledger != nil {
+		if balance, err := ledger.Balance(clientKey); err == nil {
+			w.Header().Set(CostCreditHeader, strconv.FormatFloat(balance, 'f', 0, 64))
+		}
+	}
+
+	next := m.required(r, clientKey)
+	switch {
+	case next.Waived:
+		w.Header().Set(CostNextBitsHeader, "0")
+	case !next.Banned:
+		w.Header().Set(CostNextBitsHeader, strconv.Itoa(int(next.ZeroBits)))
+	}
+}
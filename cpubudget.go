@@ -0,0 +1,63 @@
+package hashcache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const cpuBudgetSampleInterval = 10 * time.Millisecond
+
+var ErrCPUBudgetExceeded = newError(CodeCPUBudgetExceeded, "cpu budget exceeded")
+
+// WithCPUBudget aborts the computation with ErrCPUBudgetExceeded once
+// the workers have used the CPU time d, whatever the wall time. The CPU
+// time is sampled for the whole process, so that work done concurrently
+// by the process counts against the budget too; where the CPU time of
+// the process is not available, the wall time of every worker counts.
+func WithCPUBudget(d time.Duration) PoolOption {
+	return func(cfg *PoolConfig) {
+		cfg.CPUBudget = d
+	}
+}
+
+// withCPUBudget cancels the context with ErrCPUBudgetExceeded as its
+// cause once the budget is used, the returned stop releases the monitor
+func withCPUBudget(ctx context.Context, budget time.Duration, workers int) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	used := cpuUsage(workers)
+
+	go func() {
+		ticker := time.NewTicker(cpuBudgetSampleInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if d := used(); d > budget {
+					cancel(fmt.Errorf("%w: used %s of %s", ErrCPUBudgetExceeded, d, budget))
+					return
+				}
+			}
+		}
+	}()
+
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// cpuUsage measures the CPU time used since it was called
+func cpuUsage(workers int) func() time.Duration {
+	if start, ok := processCPUTime(); ok {
+		return func() time.Duration {
+			now, _ := processCPUTime()
+			return now - start
+		}
+	}
+
+	start := time.Now()
+	return func() time.Duration {
+		return time.Since(start) * time.Duration(workers)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package hashcache
+
+import "time"
+
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package hashcache
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPUTime is the user and system CPU time used by the process
+func processCPUTime() (time.Duration, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, false
+	}
+
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), true
+}
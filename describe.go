@@ -0,0 +1,71 @@
+package hashcache
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Describe breaks the header down for humans, e.g. to debug a rejected
+// stamp: the decoded resource, the algorithm, the difficulty with the
+// work it takes on average, the expiration in local time with the time
+// remaining, and whether the proof holds. The header is expected in the
+// form produced by New, see DescribeStamp for received stamp strings.
+func (h Header) Describe() string {
+	resource, err := h.rawResource()
+	if err != nil {
+		resource = h.Resource + " (invalid base64)"
+	}
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 1, ' ', 0)
+	line := func(name, format string, args ...any) {
+		fmt.Fprintf(w, "%s:\t%s\n", name, fmt.Sprintf(format, args...))
+	}
+
+	hash := h.Hash()
+	leading := len(hash) - len(strings.TrimLeft(hash, "0"))
+
+	line("format", "%s", h.Format)
+	line("version", "%d", h.Ver)
+	line("resource", "%s", resource)
+	line("algorithm", "%s", h.Algorithm)
+	line("zero bits", "%d (%.0f hashes on average)", h.ZeroBits, expectedHashes(h.ZeroBits))
+	line("expires", "%s (%s)", time.Unix(0, h.Expiration).Local().Format(time.RFC1123), describeRemaining(h.Expiration))
+	line("rand", "%s", h.Rand)
+	line("counter", "%d", h.Counter)
+	if h.Ext != "" {
+		line("ext", "%s", h.Ext)
+	}
+	line("hash", "%s", hash)
+
+	if h.Valid() {
+		line("proof", "valid")
+	} else {
+		line("proof", "invalid (%d leading zeros)", leading)
+	}
+
+	_ = w.Flush()
+	return b.String()
+}
+
+// DescribeStamp parses the stamp string as received from a client
+// and describes it
+func DescribeStamp(raw string) (string, error) {
+	h, err := parseWire(raw)
+	if err != nil {
+		return "", err
+	}
+
+	return h.Describe(), nil
+}
+
+func describeRemaining(expiration int64) string {
+	remaining := time.Unix(0, expiration).Sub(clock()).Round(time.Second)
+	if remaining < 0 {
+		return "expired " + (-remaining).String() + " ago"
+	}
+
+	return remaining.String() + " remaining"
+}
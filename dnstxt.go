@@ -0,0 +1,114 @@
+package hashcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+const (
+	// TXTPrefix tags the TXT records carrying a stamp
+	// among the other records of the name, e.g. SPF
+	TXTPrefix = "hashcash="
+
+	// maxTXTStringLength is the length of a character string of a TXT record
+	maxTXTStringLength = 255
+)
+
+var ErrInvalidTXT = newError(CodeInvalidTXT, "invalid TXT record")
+
+// EncodeTXT splits the stamp into the character strings of a TXT record
+// of at most 255 bytes each, tagged with TXTPrefix. The bytes besides
+// letters, digits and the "+/=:._-" punctuation of the base64 and the
+// separators are percent encoded, so that the strings need no quoting
+// in zone files and survive the DNS provider APIs.
+func EncodeTXT(h Header) []string {
+	encoded := TXTPrefix + escapeTXT(h.String())
+
+	chunks := make([]string, 0, len(encoded)/maxTXTStringLength+1)
+	for len(encoded) > maxTXTStringLength {
+		chunks = append(chunks, encoded[:maxTXTStringLength])
+		encoded = encoded[maxTXTStringLength:]
+	}
+
+	return append(chunks, encoded)
+}
+
+// DecodeTXT parses the stamp of the character strings of a TXT record,
+// which net.LookupTXT returns already joined
+func DecodeTXT(chunks []string) (Header, error) {
+	joined := strings.Join(chunks, "")
+	if len(joined) > len(TXTPrefix)+3*MaxStampLength {
+		return Header{}, fmt.Errorf("%w: %d bytes", ErrInvalidTXT, len(joined))
+	}
+
+	encoded, ok := strings.CutPrefix(joined, TXTPrefix)
+	if !ok {
+		return Header{}, fmt.Errorf("%w: missing %q prefix", ErrInvalidTXT, TXTPrefix)
+	}
+
+	raw, err := url.PathUnescape(encoded)
+	if err != nil {
+		return Header{}, errors.Join(ErrInvalidTXT, err)
+	}
+
+	return parseWire(raw)
+}
+
+// LookupTXT resolves the stamps published in the TXT records of the name,
+// skipping the records without TXTPrefix, e.g. for dynamic DNS updates
+// or domain verification gated by proof of work
+func LookupTXT(ctx context.Context, resolver *net.Resolver, name string) ([]Header, error) {
+	records, err := resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var stamps []Header
+	for _, record := range records {
+		if !strings.HasPrefix(record, TXTPrefix) {
+			continue
+		}
+
+		h, err := DecodeTXT([]string{record})
+		if err != nil {
+			return nil, err
+		}
+
+		stamps = append(stamps, h)
+	}
+
+	return stamps, nil
+}
+
+func escapeTXT(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if txtSafe(c) {
+			b.WriteByte(c)
+			continue
+		}
+
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0xf])
+	}
+
+	return b.String()
+}
+
+func txtSafe(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+
+	return strings.IndexByte("+/=:._-", c) >= 0
+}
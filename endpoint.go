@@ -0,0 +1,160 @@
+package hashcache
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidEndpointPattern = newError(CodeInvalidEndpointPattern, "invalid endpoint pattern")
+
+// EndpointRoute requires ZeroBits from the requests matching the pattern
+type EndpointRoute struct {
+	Pattern  string
+	ZeroBits uint8
+}
+
+type endpointMatcher struct {
+	method   string
+	segments []string
+	prefix   bool
+	zeroBits uint8
+}
+
+// EndpointRoutes is the compiled table of the endpoint difficulties.
+// Patterns are paths optionally preceded by a method, e.g. "/search" or
+// "POST /signup". A "*" segment matches any single segment, and a trailing
+// slash matches the whole subtree as in http.ServeMux, e.g. "/users/*/" or
+// "/api/". The most specific pattern matching a request wins: the longest,
+// then the one with fewer wildcards, then the exact one, then the one with
+// a method.
+type EndpointRoutes struct {
+	matchers []endpointMatcher
+}
+
+func NewEndpointRoutes(routes ...EndpointRoute) (*EndpointRoutes, error) {
+	e := &EndpointRoutes{matchers: make([]endpointMatcher, 0, len(routes))}
+	for _, route := range routes {
+		m, err := compileEndpoint(route.Pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		m.zeroBits = route.ZeroBits
+		e.matchers = append(e.matchers, m)
+	}
+
+	sort.SliceStable(e.matchers, func(i, j int) bool {
+		return e.matchers[i].moreSpecific(e.matchers[j])
+	})
+
+	return e, nil
+}
+
+// WithEndpointRoutes raises the difficulty required from the requests
+// matching a route of the table, see EndpointRoutes
+func WithEndpointRoutes(routes *EndpointRoutes) MiddlewareOption {
+	return func(cfg *MiddlewareConfig) {
+		cfg.Endpoints = routes
+	}
+}
+
+// Match returns the zero bits of the most specific route of the request
+func (e *EndpointRoutes) Match(method, path string) (uint8, bool) {
+	segments := splitPath(path)
+	for _, m := range e.matchers {
+		if m.match(method, segments) {
+			return m.zeroBits, true
+		}
+	}
+
+	return 0, false
+}
+
+func compileEndpoint(pattern string) (endpointMatcher, error) {
+	var m endpointMatcher
+
+	path := pattern
+	if method, rest, ok := strings.Cut(pattern, " "); ok {
+		m.method, path = method, strings.TrimLeft(rest, " ")
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		return m, fmt.Errorf("%w: '%s' must start with a slash", ErrInvalidEndpointPattern, pattern)
+	}
+
+	m.prefix = strings.HasSuffix(path, "/")
+	m.segments = splitPath(path)
+	for _, segment := range m.segments {
+		if segment == "" {
+			return m, fmt.Errorf("%w: '%s' has an empty segment", ErrInvalidEndpointPattern, pattern)
+		}
+	}
+
+	return m, nil
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+
+	return strings.Split(path, "/")
+}
+
+func (m endpointMatcher) match(method string, segments []string) bool {
+	if m.method != "" && m.method != method {
+		return false
+	}
+
+	if len(segments) < len(m.segments) || !m.prefix && len(segments) != len(m.segments) {
+		return false
+	}
+
+	for i, segment := range m.segments {
+		if segment != "*" && segment != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m endpointMatcher) moreSpecific(other endpointMatcher) bool {
+	if len(m.segments) != len(other.segments) {
+		return len(m.segments) > len(other.segments)
+	}
+
+	if w, ow := m.wildcards(), other.wildcards(); w != ow {
+		return w < ow
+	}
+
+	if m.prefix != other.prefix {
+		return !m.prefix
+	}
+
+	return m.method != "" && other.method == ""
+}
+
+func (m endpointMatcher) wildcards() int {
+	var n int
+	for _, segment := range m.segments {
+		if segment == "*" {
+			n++
+		}
+	}
+
+	return n
+}
+
+// endpointRequest is the request the difficulty of which is routed,
+// the one named by the method and path query of a challenge request
+func endpointRequest(r *http.Request) *http.Request {
+	if r.URL.Query().Has("path") {
+		return challengeRequest(r)
+	}
+
+	return r
+}
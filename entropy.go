@@ -0,0 +1,214 @@
+package hashcache
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const defaultRandHistory = 64
+
+// RandSource of the random bytes of the stamps, see WithRandSource
+type RandSource interface {
+	// Read fills b with random bytes
+	Read(b []byte) (int, error)
+}
+
+// CryptoRandSource reads crypto/rand, the default source
+var CryptoRandSource RandSource = cryptoRandSource{}
+
+type cryptoRandSource struct{}
+
+func (cryptoRandSource) Read(b []byte) (int, error) {
+	return rand.Read(b)
+}
+
+// WithRandSource mints the header with the random bytes of the source,
+// e.g. a CheckedRandSource
+func WithRandSource(src RandSource) HeaderOption {
+	return func(cfg *HeaderConfig) {
+		cfg.RandSource = src
+	}
+}
+
+type RandHealthConfig struct {
+	// History is the number of the last outputs checked for repeats
+	History int
+
+	// Fallback is read when the source fails a check,
+	// the read fails without it
+	Fallback RandSource
+
+	// OnFailure is called with the failed checks
+	OnFailure func(error)
+}
+
+type RandHealthOption func(*RandHealthConfig)
+
+func WithRandHistory(n int) RandHealthOption {
+	return func(cfg *RandHealthConfig) {
+		cfg.History = n
+	}
+}
+
+// WithRandFallback reads the fallback when the source fails a check
+// instead of failing the minting
+func WithRandFallback(src RandSource) RandHealthOption {
+	return func(cfg *RandHealthConfig) {
+		cfg.Fallback = src
+	}
+}
+
+func WithRandFailureHandler(fn func(error)) RandHealthOption {
+	return func(cfg *RandHealthConfig) {
+		cfg.OnFailure = fn
+	}
+}
+
+// RandHealth of a CheckedRandSource
+type RandHealth struct {
+	Reads      uint64
+	Failures   uint64
+	ShortReads uint64
+	Repeats    uint64
+	Fallbacks  uint64
+
+	// Healthy is whether the last read of the source passed the checks
+	Healthy bool
+	LastErr error
+}
+
+// CheckedRandSource checks the outputs of a source, failing the short
+// reads and the outputs repeating one of the recent ones or made of
+// a single byte, so that the quality of the nonces of long-running
+// minting services is monitored
+type CheckedRandSource struct {
+	src RandSource
+	cfg RandHealthConfig
+
+	mu     sync.Mutex
+	recent map[string]struct{}
+	ring   []string
+	next   int
+	health RandHealth
+}
+
+func NewCheckedRandSource(src RandSource, opts ...RandHealthOption) *CheckedRandSource {
+	cfg := RandHealthConfig{History: defaultRandHistory}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &CheckedRandSource{
+		src:    src,
+		cfg:    cfg,
+		recent: make(map[string]struct{}, cfg.History),
+		health: RandHealth{Healthy: true},
+	}
+}
+
+func (s *CheckedRandSource) Read(b []byte) (int, error) {
+	n, err := s.src.Read(b)
+
+	s.mu.Lock()
+	s.health.Reads++
+	checkErr := s.check(b, n, err)
+	if checkErr == nil {
+		s.health.Healthy = true
+		s.mu.Unlock()
+		return n, nil
+	}
+
+	s.health.Failures++
+	s.health.Healthy = false
+	s.health.LastErr = checkErr
+	if s.cfg.Fallback != nil {
+		s.health.Fallbacks++
+	}
+	s.mu.Unlock()
+
+	if s.cfg.OnFailure != nil {
+		s.cfg.OnFailure(checkErr)
+	}
+
+	if s.cfg.Fallback == nil {
+		return n, checkErr
+	}
+
+	return s.cfg.Fallback.Read(b)
+}
+
+// Health of the source so far
+func (s *CheckedRandSource) Health() RandHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.health
+}
+
+func (s *CheckedRandSource) check(b []byte, n int, err error) error {
+	if err != nil {
+		return errors.Join(ErrRandomFailed, err)
+	}
+
+	if n < len(b) {
+		s.health.ShortReads++
+		return fmt.Errorf("%w: short read of %d bytes, %d wanted", ErrRandomFailed, n, len(b))
+	}
+
+	// shorter outputs repeat by chance
+	if len(b) < MinRandBytes {
+		return nil
+	}
+
+	if constantBytes(b) {
+		s.health.Repeats++
+		return fmt.Errorf("%w: constant output of %d bytes", ErrRandomFailed, len(b))
+	}
+
+	if s.cfg.History <= 0 {
+		return nil
+	}
+
+	out := string(b)
+	if _, ok := s.recent[out]; ok {
+		s.health.Repeats++
+		return fmt.Errorf("%w: repeated output of %d bytes", ErrRandomFailed, len(b))
+	}
+
+	if len(s.ring) < s.cfg.History {
+		s.ring = append(s.ring, out)
+	} else {
+		delete(s.recent, s.ring[s.next])
+		s.ring[s.next] = out
+		s.next = (s.next + 1) % s.cfg.History
+	}
+	s.recent[out] = struct{}{}
+
+	return nil
+}
+
+func constantBytes(b []byte) bool {
+	for _, c := range b[1:] {
+		if c != b[0] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func randBase64From(src RandSource, n int) (string, error) {
+	buf := make([]byte, n)
+
+	if read, err := src.Read(buf); err != nil {
+		return "", errors.Join(ErrRandomFailed, err)
+	} else if read < n {
+		return "", fmt.Errorf("%w: short read of %d bytes, %d wanted", ErrRandomFailed, read, n)
+	}
+
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,64 @@
+package hashcache
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+var ErrUnknownHashRate = newError(CodeUnknownHashRate, "unknown hash rate")
+
+// HashRates are hashes per second by algorithm, as measured by Benchmark
+type HashRates map[string]float64
+
+// MeasureHashRates benchmarks every algorithm for the duration d
+func MeasureHashRates(ctx context.Context, d time.Duration, algs ...string) (HashRates, error) {
+	rates := make(HashRates, len(algs))
+	for _, alg := range algs {
+		rate, err := Benchmark(ctx, alg, d)
+		if err != nil {
+			return nil, err
+		}
+		rates[alg] = rate
+	}
+
+	return rates, nil
+}
+
+// Cost is the expected time to solve zero bits of the algorithm
+func (r HashRates) Cost(alg string, zeroBits uint8) (time.Duration, error) {
+	rate, err := r.rate(alg)
+	if err != nil {
+		return 0, err
+	}
+
+	return EstimateSolveTime(zeroBits, rate), nil
+}
+
+// EquivalentZeroBits expresses the difficulty of zero bits of one algorithm
+// in zero bits of another one of about the same cost, so that a server
+// accepting several algorithms demands fair work from each of them.
+func (r HashRates) EquivalentZeroBits(fromAlg string, zeroBits uint8, toAlg string) (uint8, error) {
+	fromRate, err := r.rate(fromAlg)
+	if err != nil {
+		return 0, err
+	}
+
+	toRate, err := r.rate(toAlg)
+	if err != nil {
+		return 0, err
+	}
+
+	bits := float64(zeroBits) + math.Log(toRate/fromRate)/math.Log(workPerZeroBit)
+	return uint8(min(max(math.Round(bits), 0), math.MaxUint8)), nil
+}
+
+func (r HashRates) rate(alg string) (float64, error) {
+	rate, ok := r[alg]
+	if !ok || rate <= 0 {
+		return 0, fmt.Errorf("%w: '%s'", ErrUnknownHashRate, alg)
+	}
+
+	return rate, nil
+}
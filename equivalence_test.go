@@ -0,0 +1,25 @@
+package hashcache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashRates_EquivalentZeroBits(t *testing.T) {
+	t.Parallel()
+
+	rates := HashRates{algSha1: 16e6, algSha512: 1e6}
+
+	bits, err := rates.EquivalentZeroBits(algSha1, 6, algSha512)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(5), bits)
+
+	bits, err = rates.EquivalentZeroBits(algSha512, 5, algSha1)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(6), bits)
+
+	_, err = rates.EquivalentZeroBits(algSha1, 6, algSha256)
+	assert.ErrorIs(t, err, ErrUnknownHashRate)
+}
@@ -0,0 +1,113 @@
+package hashcache
+
+import "errors"
+
+// ErrorCode is the stable machine readable code of an error of the
+// package, e.g. for API gateways translating the failures into public
+// error codes without matching their messages, see CodeOf
+type ErrorCode string
+
+// CodeUnknown is the code of the errors not coming from the package
+const CodeUnknown ErrorCode = "unknown"
+
+// Codes of the malformed input and invalid arguments
+const (
+	CodeMalformedStamp         ErrorCode = "malformed_stamp"
+	CodeInvalidZeroBits        ErrorCode = "invalid_zero_bits"
+	CodeInvalidTTL             ErrorCode = "invalid_ttl"
+	CodeEmptyResource          ErrorCode = "empty_resource"
+	CodeInvalidResource        ErrorCode = "invalid_resource"
+	CodeInvalidTXT             ErrorCode = "invalid_txt"
+	CodeInvalidUDPPacket       ErrorCode = "invalid_udp_packet"
+	CodeInvalidToken           ErrorCode = "invalid_token"
+	CodeMissingStampClaim      ErrorCode = "missing_stamp_claim"
+	CodeInvalidDuration        ErrorCode = "invalid_duration"
+	CodeInvalidConfig          ErrorCode = "invalid_config"
+	CodeInvalidEndpointPattern ErrorCode = "invalid_endpoint_pattern"
+	CodeInvalidSequentialBits  ErrorCode = "invalid_sequential_bits"
+)
+
+// Codes of the stamps and requests rejected by the policy
+const (
+	CodeMissingStamp         ErrorCode = "missing_stamp"
+	CodeResourceMismatch     ErrorCode = "resource_mismatch"
+	CodeResourceNotAllowed   ErrorCode = "resource_not_allowed"
+	CodeInsufficientBits     ErrorCode = "insufficient_bits"
+	CodeUnsupportedAlgorithm ErrorCode = "unsupported_algorithm"
+	CodeRandTooShort         ErrorCode = "rand_too_short"
+	CodeStampExpired         ErrorCode = "stamp_expired"
+	CodeExpirationTooFar     ErrorCode = "expiration_too_far"
+	CodeInvalidProof         ErrorCode = "invalid_proof"
+	CodeRevoked              ErrorCode = "revoked"
+	CodeBrokenChain          ErrorCode = "broken_chain"
+	CodeInvalidSignature     ErrorCode = "invalid_signature"
+	CodeBodyMismatch         ErrorCode = "body_mismatch"
+	CodeBodyTooLarge         ErrorCode = "body_too_large"
+	CodeUnknownChallenge     ErrorCode = "unknown_challenge"
+	CodeImplausibleReport    ErrorCode = "implausible_report"
+	CodeBanned               ErrorCode = "banned"
+	CodeIssueLimited         ErrorCode = "issue_limited"
+	CodeUnknownKey           ErrorCode = "unknown_key"
+	CodeInvalidKey           ErrorCode = "invalid_key"
+	CodeNoCommonFormat       ErrorCode = "no_common_format"
+	CodeNoCommonAlgorithm    ErrorCode = "no_common_algorithm"
+	CodeDifficultyTooLow     ErrorCode = "difficulty_too_low"
+	CodeNegotiationFailed    ErrorCode = "negotiation_failed"
+	CodeHandshakeFailed      ErrorCode = "handshake_failed"
+	CodeHandshakeRejected    ErrorCode = "handshake_rejected"
+	CodeInsufficientBalance  ErrorCode = "insufficient_balance"
+	CodeInvalidAmount        ErrorCode = "invalid_amount"
+)
+
+// Codes of the stores, sinks and recorded state
+const (
+	CodeStampSpent               ErrorCode = "stamp_spent"
+	CodeRevocationWindowTooLarge ErrorCode = "revocation_window_too_large"
+	CodeWebhookFailed            ErrorCode = "webhook_failed"
+	CodeCalibrationFailed        ErrorCode = "calibration_failed"
+	CodeReplayMismatch           ErrorCode = "replay_mismatch"
+)
+
+// Codes of the computing the work
+const (
+	CodeRandomFailed      ErrorCode = "random_failed"
+	CodeTooManyIterations ErrorCode = "too_many_iterations"
+	CodeCounterExhausted  ErrorCode = "counter_exhausted"
+	CodeCPUBudgetExceeded ErrorCode = "cpu_budget_exceeded"
+	CodeFallbackExhausted ErrorCode = "fallback_exhausted"
+	CodeMinerClosed       ErrorCode = "miner_closed"
+	CodeMinerSaturated    ErrorCode = "miner_saturated"
+	CodeUnknownHashRate   ErrorCode = "unknown_hash_rate"
+	CodeEmptyBatch        ErrorCode = "empty_batch"
+)
+
+// Error is the type of the errors of the package, the wrapped and joined
+// errors carry it too:
+//
+//	var coded *hashcache.Error
+//	if errors.As(err, &coded) {
+//		status := publicStatus[coded.Code]
+//	}
+type Error struct {
+	Code ErrorCode
+	msg  string
+}
+
+func newError(code ErrorCode, msg string) *Error {
+	return &Error{Code: code, msg: msg}
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+// CodeOf the first error of the package in the chain of err,
+// CodeUnknown when there is none
+func CodeOf(err error) ErrorCode {
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+
+	return CodeUnknown
+}
@@ -0,0 +1,157 @@
+package hashcache
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Escalation is the requirement the middleware imposes on a client
+type Escalation struct {
+	ZeroBits uint8
+
+	// Banned clients are rejected without a challenge until RetryAfter passes
+	Banned     bool
+	RetryAfter time.Duration
+
+	// Waived clients are let through without a stamp
+	Waived bool
+}
+
+// EscalationPolicy decides how much work is required from a client
+// given its history of failed and successful attempts
+type EscalationPolicy interface {
+	Required(clientKey string) Escalation
+	Failure(clientKey string)
+	Success(clientKey string)
+}
+
+type fixedEscalation uint8
+
+func (f fixedEscalation) Required(string) Escalation { return Escalation{ZeroBits: uint8(f)} }
+func (fixedEscalation) Failure(string)               {}
+func (fixedEscalation) Success(string)               {}
+
+// policyEscalation requires the minimum of the current verifier policy
+type policyEscalation struct {
+	v *Verifier
+}
+
+func (p policyEscalation) Required(string) Escalation {
+	return Escalation{ZeroBits: p.v.Policy().MinZeroBits}
+}
+
+func (policyEscalation) Failure(string) {}
+func (policyEscalation) Success(string) {}
+
+type ladderState struct {
+	failures    int
+	bannedUntil time.Time
+}
+
+// LadderEscalation raises the required zero bits one step per consecutive
+// failure of a client, and bans the client for BanDuration once it fails
+// past the last step. A success resets the client back to the first step.
+type LadderEscalation struct {
+	mu          sync.Mutex
+	steps       []uint8
+	banDuration time.Duration
+	clients     map[string]*ladderState
+}
+
+func NewLadderEscalation(steps []uint8, banDuration time.Duration) *LadderEscalation {
+	return &LadderEscalation{
+		steps:       steps,
+		banDuration: banDuration,
+		clients:     make(map[string]*ladderState),
+	}
+}
+
+func (l *LadderEscalation) Required(clientKey string) Escalation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.steps) == 0 {
+		return Escalation{}
+	}
+
+	state, ok := l.clients[clientKey]
+	if !ok {
+		return Escalation{ZeroBits: l.steps[0]}
+	}
+
+	if now := clock(); now.Before(state.bannedUntil) {
+		return Escalation{Banned: true, RetryAfter: state.bannedUntil.Sub(now)}
+	}
+
+	return Escalation{ZeroBits: l.steps[min(state.failures, len(l.steps)-1)]}
+}
+
+func (l *LadderEscalation) Failure(clientKey string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state, ok := l.clients[clientKey]
+	if !ok {
+		state = &ladderState{}
+		l.clients[clientKey] = state
+	}
+
+	state.failures++
+	if state.failures >= len(l.steps) {
+		state.bannedUntil = clock().Add(l.banDuration)
+		state.failures = 0
+	}
+}
+
+func (l *LadderEscalation) Success(clientKey string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.clients, clientKey)
+}
+
+// Reputation of a client as known to an external system
+type Reputation struct {
+	// Allowlisted clients are not required to do any work
+	Allowlisted bool
+
+	// ExtraZeroBits are added to the bits required by the policy
+	ExtraZeroBits uint8
+}
+
+// ReputationProvider looks up the reputation of a client,
+// e.g. in a fail2ban feed or an abuse database
+type ReputationProvider interface {
+	Reputation(clientKey string) Reputation
+}
+
+// ReputationFunc adapts a function to the ReputationProvider interface
+type ReputationFunc func(clientKey string) Reputation
+
+func (f ReputationFunc) Reputation(clientKey string) Reputation { return f(clientKey) }
+
+// ReputationEscalation adjusts the requirement of the policy
+// by the reputation of the client
+type ReputationEscalation struct {
+	policy   EscalationPolicy
+	provider ReputationProvider
+}
+
+func NewReputationEscalation(policy EscalationPolicy, provider ReputationProvider) *ReputationEscalation {
+	return &ReputationEscalation{policy: policy, provider: provider}
+}
+
+func (r *ReputationEscalation) Required(clientKey string) Escalation {
+	rep := r.provider.Reputation(clientKey)
+	if rep.Allowlisted {
+		return Escalation{Waived: true}
+	}
+
+	esc := r.policy.Required(clientKey)
+	esc.ZeroBits = uint8(min(int(esc.ZeroBits)+int(rep.ExtraZeroBits), math.MaxUint8))
+	return esc
+}
+
+func (r *ReputationEscalation) Failure(clientKey string) { r.policy.Failure(clientKey) }
+func (r *ReputationEscalation) Success(clientKey string) { r.policy.Success(clientKey) }
@@ -0,0 +1,32 @@
+package hashcache
+
+import "strings"
+
+const extSeparator = ";"
+
+// extValue of the named entry of the extension, which is a list of
+// name=value entries separated by semicolons as in the specification
+func extValue(ext, name string) (string, bool) {
+	for _, entry := range strings.Split(ext, extSeparator) {
+		if value, ok := strings.CutPrefix(entry, name+"="); ok {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// withExtValue sets the named entry of the extension,
+// replacing the entry of the same name
+func withExtValue(ext, name, value string) string {
+	var entries []string
+	if ext != "" {
+		for _, entry := range strings.Split(ext, extSeparator) {
+			if !strings.HasPrefix(entry, name+"=") {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	return strings.Join(append(entries, name+"="+value), extSeparator)
+}
@@ -0,0 +1,75 @@
+package hashcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var ErrFallbackExhausted = newError(CodeFallbackExhausted, "fallback ladder exhausted")
+
+// ChallengeFunc fetches a challenge for the offer, see NegotiatorChallenges
+type ChallengeFunc func(ctx context.Context, offer Offer) (Header, error)
+
+// NegotiatorChallenges fetches the challenges from a Negotiator served at the url
+func NegotiatorChallenges(client *http.Client, url string) ChallengeFunc {
+	return func(ctx context.Context, offer Offer) (Header, error) {
+		return RequestChallenge(ctx, client, url, offer)
+	}
+}
+
+// FallbackStep is a rung of the fallback ladder, the challenge offered
+// with its limits must be solved within its budget
+type FallbackStep struct {
+	// MaxZeroBits offered to the server, zero asks for the server default
+	MaxZeroBits uint8
+
+	// MaxTTL offered to the server, zero keeps the server ttl
+	MaxTTL time.Duration
+
+	// Budget of the solve, zero leaves it to the context
+	Budget time.Duration
+}
+
+// SolveWithFallback climbs down the ladder until a challenge is solved
+// within the budget of its step, so that weak devices settle on a lower
+// difficulty instead of timing out. The offer limits are replaced by
+// the ones of each step. Challenges which can not be fetched end the
+// climb, as the server refuses to go lower.
+func SolveWithFallback(ctx context.Context, offer Offer, fetch ChallengeFunc, ladder []FallbackStep) (Header, error) {
+	var lastErr error
+	for i, step := range ladder {
+		offer.MaxZeroBits = step.MaxZeroBits
+		offer.MaxTTL = Duration(step.MaxTTL)
+
+		challenge, err := fetch(ctx, offer)
+		if err != nil {
+			return Header{}, errors.Join(fmt.Errorf("%w: at step %d", ErrFallbackExhausted, i), lastErr, err)
+		}
+
+		solved, err := solveWithin(ctx, challenge, step.Budget)
+		if err == nil {
+			return solved, nil
+		}
+
+		if ctx.Err() != nil {
+			return Header{}, ctx.Err()
+		}
+
+		lastErr = err
+	}
+
+	return Header{}, errors.Join(ErrFallbackExhausted, lastErr)
+}
+
+func solveWithin(ctx context.Context, h Header, budget time.Duration) (Header, error) {
+	if budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, budget)
+		defer cancel()
+	}
+
+	return Compute(ctx, h, 0)
+}
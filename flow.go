@@ -0,0 +1,144 @@
+package hashcache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// FlowPhase of CallWithStamp
+type FlowPhase string
+
+const (
+	FlowFetch FlowPhase = "fetch"
+	FlowSolve FlowPhase = "solve"
+	FlowCall  FlowPhase = "call"
+)
+
+// DefaultDeadlineSplit gives most of the deadline to the solve
+var DefaultDeadlineSplit = DeadlineSplit{Fetch: 0.2, Solve: 0.5, Call: 0.3}
+
+// DeadlineSplit are the shares of the deadline of the phases of
+// CallWithStamp, normalized by their sum
+type DeadlineSplit struct {
+	Fetch float64
+	Solve float64
+	Call  float64
+}
+
+type FlowConfig struct {
+	Split DeadlineSplit
+
+	// Offer to the challenge issuer
+	Offer Offer
+
+	// MaxIterations of the solve, zero meaning no limit
+	MaxIterations int
+}
+
+type FlowOption func(*FlowConfig)
+
+func WithDeadlineSplit(split DeadlineSplit) FlowOption {
+	return func(cfg *FlowConfig) {
+		cfg.Split = split
+	}
+}
+
+func WithFlowOffer(offer Offer) FlowOption {
+	return func(cfg *FlowConfig) {
+		cfg.Offer = offer
+	}
+}
+
+func WithFlowMaxIterations(n int) FlowOption {
+	return func(cfg *FlowConfig) {
+		cfg.MaxIterations = n
+	}
+}
+
+// FlowError tells the phase of CallWithStamp which failed
+// and how much of the deadline was left to it
+type FlowError struct {
+	Phase FlowPhase
+	// Budget of the phase, zero without a deadline
+	Budget time.Duration
+	Err    error
+}
+
+func (e *FlowError) Error() string {
+	if e.Budget > 0 {
+		return fmt.Sprintf("%s within %s: %s", e.Phase, e.Budget, e.Err)
+	}
+
+	return fmt.Sprintf("%s: %s", e.Phase, e.Err)
+}
+
+func (e *FlowError) Unwrap() error {
+	return e.Err
+}
+
+// StampedCall makes the actual API call with the solved stamp
+type StampedCall func(ctx context.Context, stamp Header) error
+
+// CallWithStamp fetches a challenge, solves it and makes the call with
+// the stamp, splitting the deadline of ctx between the phases by the
+// shares of the split. The time a phase leaves unused is shared by the
+// following ones, and the call gets whatever is left, so that a slow
+// solve is aborted early enough for the call to still be made or a
+// FlowError of the solve to be returned in time.
+func CallWithStamp(ctx context.Context, fetch ChallengeFunc, call StampedCall, opts ...FlowOption) error {
+	cfg := FlowConfig{Split: DefaultDeadlineSplit}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	shares := []float64{cfg.Split.Fetch, cfg.Split.Solve, cfg.Split.Call}
+
+	fetchCtx, budget, cancel := phaseContext(ctx, shares[0:])
+	challenge, err := fetch(fetchCtx, cfg.Offer)
+	cancel()
+	if err != nil {
+		return &FlowError{Phase: FlowFetch, Budget: budget, Err: err}
+	}
+
+	solveCtx, budget, cancel := phaseContext(ctx, shares[1:])
+	solved, err := solveHinted(solveCtx, challenge, cfg.MaxIterations)
+	cancel()
+	if err != nil {
+		return &FlowError{Phase: FlowSolve, Budget: budget, Err: err}
+	}
+
+	budget = 0
+	if deadline, ok := ctx.Deadline(); ok {
+		budget = time.Until(deadline)
+	}
+
+	if err := call(ctx, solved); err != nil {
+		return &FlowError{Phase: FlowCall, Budget: budget, Err: err}
+	}
+
+	return nil
+}
+
+// phaseContext bounds the first of the remaining phases by its share
+// of the time left, the context is left alone without a deadline
+func phaseContext(ctx context.Context, shares []float64) (context.Context, time.Duration, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return ctx, 0, func() {}
+	}
+
+	var total float64
+	for _, share := range shares {
+		total += max(share, 0)
+	}
+
+	left := time.Until(deadline)
+	budget := left
+	if total > 0 {
+		budget = time.Duration(float64(left) * max(shares[0], 0) / total)
+	}
+
+	phaseCtx, cancel := context.WithTimeout(ctx, budget)
+	return phaseCtx, budget, cancel
+}
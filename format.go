@@ -0,0 +1,264 @@
+package hashcache
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HeaderFormat is the string form of a header. The hashed string is
+// the emitted one, so the format is fixed before the work is computed.
+type HeaderFormat uint8
+
+const (
+	// FormatLibrary is the format of this library:
+	// 1:bits:expiration(unix nano):base64(resource):alg:rand:counter[:ext]
+	FormatLibrary HeaderFormat = iota
+
+	// FormatSpec is the version 1 of the hashcash specification:
+	// 1:bits:date:resource:ext:rand:counter, always with sha-1, the bits
+	// being binary and the counter any base64 string
+	FormatSpec
+
+	// FormatV0 is the version 0 of the hashcash specification:
+	// 0:date:resource:rand[.counter], the bits are implied by the hash
+	FormatV0
+)
+
+// specBitsPerZeroBit is the number of the binary zero bits of the
+// specification per zero hex digit, which the library counts
+const specBitsPerZeroBit = 4
+
+// specDateLayout is the YYMMDDhhmmss date of the specification, the
+// library keeps the expiration in it, with the precision of a second
+const specDateLayout = "060102150405"
+
+var headerFormatNames = map[HeaderFormat]string{
+	FormatLibrary: "v1",
+	FormatSpec:    "v1-spec",
+	FormatV0:      "v0",
+}
+
+func (f HeaderFormat) String() string {
+	if name, ok := headerFormatNames[f]; ok {
+		return name
+	}
+
+	return "format(" + strconv.Itoa(int(f)) + ")"
+}
+
+func (f HeaderFormat) MarshalText() ([]byte, error) {
+	if _, ok := headerFormatNames[f]; !ok {
+		return nil, fmt.Errorf("%w: unknown format %d", ErrInvalidHeaderString, f)
+	}
+
+	return []byte(f.String()), nil
+}
+
+func (f *HeaderFormat) UnmarshalText(text []byte) error {
+	parsed, err := ParseHeaderFormat(string(text))
+	if err != nil {
+		return err
+	}
+
+	*f = parsed
+	return nil
+}
+
+func ParseHeaderFormat(name string) (HeaderFormat, error) {
+	for f, n := range headerFormatNames {
+		if n == name {
+			return f, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: unknown format '%s'", ErrInvalidHeaderString, name)
+}
+
+// WithFormat mints the header in the format. The formats of the
+// specification carry the resource as is and use sha-1 only, which
+// verifiers accept with AllowLegacyAlgorithms.
+func WithFormat(f HeaderFormat) HeaderOption {
+	return func(cfg *HeaderConfig) {
+		cfg.Format = f
+	}
+}
+
+// applyFormat converts a header minted by New to the format
+func (h Header) applyFormat(f HeaderFormat) (Header, error) {
+	h.Format = f
+	if f == FormatLibrary {
+		return h, nil
+	}
+
+	resource, err := base64.StdEncoding.DecodeString(h.Resource)
+	if err != nil {
+		return Header{}, err
+	}
+
+	if strings.Contains(string(resource), headerStringSeparator) {
+		return Header{}, fmt.Errorf("%w: resource of format %s can not contain '%s'",
+			ErrInvalidResource, f, headerStringSeparator)
+	}
+
+	h.Resource = string(resource)
+	h.Algorithm = algSha1
+	h.Expiration = time.Unix(0, h.Expiration).Truncate(time.Second).UnixNano()
+	if f == FormatV0 {
+		h.Ver = 0
+	}
+
+	return h, nil
+}
+
+// rawResource is the resource of the header with the base64
+// encoding of the library format removed
+func (h Header) rawResource() (string, error) {
+	if h.Format != FormatLibrary || h.decoded {
+		return h.Resource, nil
+	}
+
+	resource, err := base64.StdEncoding.DecodeString(h.Resource)
+	return string(resource), err
+}
+
+func (h Header) specString() string {
+	return strings.Join([]string{
+		"1",
+		strconv.Itoa(int(h.ZeroBits) * specBitsPerZeroBit),
+		formatSpecDate(h.Expiration),
+		h.Resource,
+		h.Ext,
+		h.Rand,
+		h.specCounterToken(),
+	}, headerStringSeparator)
+}
+
+// specCounterToken is the counter token of the parsed stamp while the
+// counter is unchanged, the base64 little endian counter otherwise
+func (h Header) specCounterToken() string {
+	if h.specCounter.token != "" && h.specCounter.of == h.Counter {
+		return h.specCounter.token
+	}
+
+	var counter [8]byte
+	binary.LittleEndian.PutUint64(counter[:], h.Counter)
+	return base64.StdEncoding.EncodeToString(counter[:])
+}
+
+func (h Header) v0String() string {
+	suffix := h.Rand
+	if h.Counter > 0 {
+		suffix += "." + strconv.FormatUint(h.Counter, 10)
+	}
+
+	return strings.Join([]string{"0", formatSpecDate(h.Expiration), h.Resource, suffix}, headerStringSeparator)
+}
+
+func formatSpecDate(unixNano int64) string {
+	return time.Unix(0, unixNano).UTC().Format(specDateLayout)
+}
+
+// parseSpecDate accepts the YYMMDD, YYMMDDhhmm and YYMMDDhhmmss dates
+func parseSpecDate(token string) (int64, bool) {
+	if _, err := strconv.ParseUint(token, 10, 64); err != nil {
+		return 0, false
+	}
+
+	layout := map[int]string{6: "060102", 10: "0601021504", 12: specDateLayout}[len(token)]
+	if layout == "" {
+		return 0, false
+	}
+
+	t, err := time.Parse(layout, token)
+	if err != nil {
+		return 0, false
+	}
+
+	return t.UnixNano(), true
+}
+
+// isSpecFormat tells the version 1 of the specification from the format
+// of the library by the date in place of the expiration and by the
+// extension in place of the algorithm
+func isSpecFormat(tokens []string) bool {
+	if len(tokens) != 7 || tokens[0] != "1" || isSupportedAlgorithm(tokens[4]) {
+		return false
+	}
+
+	_, ok := parseSpecDate(tokens[2])
+	return ok
+}
+
+func parseSpec(tokens []string) (Header, error) {
+	zeroBits, err := strconv.ParseUint(tokens[1], 10, 8)
+	if err != nil {
+		return Header{}, fmt.Errorf("%w: invalid zero bits '%s'", ErrInvalidHeaderString, tokens[1])
+	}
+
+	expiration, _ := parseSpecDate(tokens[2])
+
+	// the counter is any base64 string, the hashed one is kept as is
+	token := tokens[6]
+	if token == "" || strings.Trim(token, base64Alphabet) != "" {
+		return Header{}, fmt.Errorf("%w: invalid counter '%s'", ErrInvalidHeaderString, token)
+	}
+
+	var counter uint64
+	if raw, err := base64.StdEncoding.DecodeString(token); err == nil && len(raw) == 8 {
+		counter = binary.LittleEndian.Uint64(raw)
+	}
+
+	return Header{
+		Resource:    tokens[3],
+		Algorithm:   algSha1,
+		Rand:        tokens[5],
+		Expiration:  expiration,
+		Counter:     counter,
+		Ver:         1,
+		ZeroBits:    uint8(zeroBits / specBitsPerZeroBit),
+		Ext:         tokens[4],
+		Format:      FormatSpec,
+		specCounter: specCounter{of: counter, token: token},
+	}, nil
+}
+
+const base64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/="
+
+// parseV0 takes the zero bits of the stamp from the hash
+// of the header, since the version 0 does not state them
+func parseV0(header string, tokens []string) (Header, error) {
+	if len(tokens) != 4 {
+		return Header{}, ErrInvalidHeaderString
+	}
+
+	expiration, ok := parseSpecDate(tokens[1])
+	if !ok {
+		return Header{}, fmt.Errorf("%w: invalid date '%s'", ErrInvalidHeaderString, tokens[1])
+	}
+
+	h := Header{
+		Resource:   tokens[2],
+		Algorithm:  algSha1,
+		Rand:       tokens[3],
+		Expiration: expiration,
+		Format:     FormatV0,
+	}
+
+	if i := strings.LastIndex(tokens[3], "."); i >= 0 {
+		counter := tokens[3][i+1:]
+		if n, err := strconv.ParseUint(counter, 10, 64); err == nil && n > 0 && !strings.HasPrefix(counter, "0") {
+			h.Rand, h.Counter = tokens[3][:i], n
+		}
+	}
+
+	hasher := resolveHash(algSha1)
+	hasher.Write([]byte(header))
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	h.ZeroBits = uint8(len(hash) - len(strings.TrimLeft(hash, "0")))
+	return h, nil
+}
@@ -2,11 +2,13 @@ module github.com/denismitr/hashcache
 
 go 1.21.4
 
-require github.com/stretchr/testify v1.8.4
+require (
+	github.com/google/go-cmp v0.6.0
+	github.com/stretchr/testify v1.8.4
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/google/go-cmp v0.6.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
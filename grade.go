@@ -0,0 +1,78 @@
+package hashcache
+
+import "strings"
+
+// strongExcessZeroBits is the excess over the required difficulty of
+// the strong stamps, a zero bit being a hex digit sixteen times the work
+const strongExcessZeroBits = 1
+
+// Grade is the tier of a stamp by how far its digest exceeds
+// the difficulty required by the policy
+type Grade int
+
+const (
+	// GradeWeak stamps do not meet the required difficulty
+	GradeWeak Grade = iota
+	// GradeStandard stamps meet it
+	GradeStandard
+	// GradeStrong stamps exceed it, e.g. to be granted larger quotas
+	GradeStrong
+)
+
+func (g Grade) String() string {
+	switch g {
+	case GradeStandard:
+		return "standard"
+	case GradeStrong:
+		return "strong"
+	default:
+		return "weak"
+	}
+}
+
+// GradeStamp grades the stamp against the minimum zero bits of the
+// policy for its algorithm. The zero bits of the digest count, not the
+// claimed ones, so that a client lucky or willing to over-prove is told
+// apart. It checks the proof only, the stamp should be verified first.
+func GradeStamp(h Header, policy VerifierPolicy) Grade {
+	if !h.Valid() {
+		return GradeWeak
+	}
+
+	return gradeZeroBits(h, policy.MinZeroBitsFor(h.Algorithm))
+}
+
+// gradeZeroBits of the verified stamp, its proof is not checked again
+func gradeZeroBits(h Header, required uint8) Grade {
+	achieved := digestZeroBits(h)
+
+	switch {
+	case achieved < required:
+		return GradeWeak
+	case achieved-required >= strongExcessZeroBits:
+		return GradeStrong
+	default:
+		return GradeStandard
+	}
+}
+
+// DigestZeroBits is the number of leading zero hex digits of the digest
+// of a valid stamp, at least its claimed zero bits. The work functions
+// besides hashcash prove the claimed zero bits only.
+func DigestZeroBits(h Header) (uint8, bool) {
+	if !h.Valid() {
+		return 0, false
+	}
+
+	return digestZeroBits(h), true
+}
+
+// digestZeroBits of the verified stamp
+func digestZeroBits(h Header) uint8 {
+	if _, ok := resolveWorkFunction(h.Algorithm).(hashcashWork); !ok {
+		return h.ZeroBits
+	}
+
+	hash := h.Hash()
+	return uint8(len(hash) - len(strings.TrimLeft(hash, "0")))
+}
@@ -0,0 +1,219 @@
+package hashcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	handshakeBanner = "HASHCASH-1 "
+	handshakeOK     = "OK"
+	handshakeErr    = "ERR "
+
+	defaultHandshakeTimeout = 30 * time.Second
+)
+
+var (
+	ErrHandshakeFailed   = newError(CodeHandshakeFailed, "handshake failed")
+	ErrHandshakeRejected = newError(CodeHandshakeRejected, "handshake rejected")
+)
+
+type HandshakeRole int
+
+const (
+	// HandshakeServer issues the challenge and verifies the stamp
+	HandshakeServer HandshakeRole = iota
+	// HandshakeClient solves the challenge
+	HandshakeClient
+)
+
+// HandshakePolicy of either side of the handshake
+type HandshakePolicy struct {
+	// Resource of the challenges issued by the server, the local address
+	// of the connection by default. When set on the client the challenges
+	// must be issued for it.
+	Resource string
+
+	// ZeroBits required by the server
+	ZeroBits uint8
+
+	// Timeout of the whole exchange, 30 seconds by default
+	Timeout time.Duration
+
+	// Verifier of the server, a verifier requiring ZeroBits by default
+	Verifier *Verifier
+
+	// MaxZeroBits the client is willing to solve, zero meaning any
+	MaxZeroBits uint8
+
+	// MaxIterations of the client, zero meaning no limit
+	MaxIterations int
+}
+
+// Handshake exchanges a proof of work over the connection before the
+// application data flows, for stream protocols without a framing of
+// their own. Like an SSH banner the exchange is line based:
+//
+//	server: HASHCASH-1 <challenge>\r\n
+//	client: <stamp>\r\n
+//	server: OK\r\n or ERR <code>\r\n
+//
+// The lines are read byte by byte up to MaxStampLength, so that nothing
+// past the handshake is consumed from the connection. The deadline of
+// the connection is cleared once the handshake is done.
+func Handshake(conn net.Conn, role HandshakeRole, policy HandshakePolicy) error {
+	if policy.Timeout <= 0 {
+		policy.Timeout = defaultHandshakeTimeout
+	}
+
+	deadline := time.Now().Add(policy.Timeout)
+	if err := conn.SetDeadline(deadline); err != nil {
+		return errors.Join(ErrHandshakeFailed, err)
+	}
+	defer conn.SetDeadline(time.Time{})
+
+	if role == HandshakeClient {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		return clientHandshake(ctx, conn, policy)
+	}
+
+	return serverHandshake(conn, policy)
+}
+
+func serverHandshake(conn net.Conn, policy HandshakePolicy) error {
+	v := policy.Verifier
+	if v == nil {
+		v = NewVerifier(WithMinZeroBits(policy.ZeroBits))
+	}
+
+	resource := policy.Resource
+	if resource == "" {
+		resource = conn.LocalAddr().String()
+	}
+
+	tmpl := ChallengeTemplate{ZeroBits: max(policy.ZeroBits, 1), TTL: policy.Timeout}
+	challenge, err := tmpl.Issue(resource)
+	if err != nil {
+		return errors.Join(ErrHandshakeFailed, err)
+	}
+
+	if err := writeHandshakeLine(conn, handshakeBanner+challenge.String()); err != nil {
+		return err
+	}
+
+	line, err := readHandshakeLine(conn)
+	if err != nil {
+		return err
+	}
+
+	err = verifyHandshake(v, conn.RemoteAddr(), challenge, line)
+	if err != nil {
+		_ = writeHandshakeLine(conn, handshakeErr+problemCode(err))
+		return fmt.Errorf("%w: %w", ErrHandshakeRejected, err)
+	}
+
+	return writeHandshakeLine(conn, handshakeOK)
+}
+
+// verifyHandshake checks that the stamp answers the challenge
+// of the connection before verifying its proof
+func verifyHandshake(v *Verifier, addr net.Addr, challenge Header, line string) error {
+	h, err := parseWire(line)
+	if err != nil {
+		return err
+	}
+
+	if challengeFields(h) != challengeFields(challenge) {
+		return ErrUnknownChallenge
+	}
+
+	return v.VerifyFor(context.Background(), addrHost(addr), h)
+}
+
+func clientHandshake(ctx context.Context, conn net.Conn, policy HandshakePolicy) error {
+	line, err := readHandshakeLine(conn)
+	if err != nil {
+		return err
+	}
+
+	raw, ok := strings.CutPrefix(line, handshakeBanner)
+	if !ok {
+		return fmt.Errorf("%w: unexpected banner", ErrHandshakeFailed)
+	}
+
+	h, err := parseWire(raw)
+	if err != nil {
+		return errors.Join(ErrHandshakeFailed, err)
+	}
+
+	if policy.Resource != "" {
+		if resource, err := h.rawResource(); err != nil || resource != policy.Resource {
+			return fmt.Errorf("%w: challenge for another resource", ErrHandshakeFailed)
+		}
+	}
+
+	if policy.MaxZeroBits > 0 && h.ZeroBits > policy.MaxZeroBits {
+		return fmt.Errorf("%w: challenge of %d bits exceeds %d", ErrHandshakeFailed, h.ZeroBits, policy.MaxZeroBits)
+	}
+
+	solved, err := solveHinted(ctx, h, policy.MaxIterations)
+	if err != nil {
+		return errors.Join(ErrHandshakeFailed, err)
+	}
+
+	if err := writeHandshakeLine(conn, solved.String()); err != nil {
+		return err
+	}
+
+	line, err = readHandshakeLine(conn)
+	if err != nil {
+		return err
+	}
+
+	if code, rejected := strings.CutPrefix(line, handshakeErr); rejected {
+		return fmt.Errorf("%w: %s", ErrHandshakeRejected, code)
+	}
+
+	if line != handshakeOK {
+		return fmt.Errorf("%w: unexpected response", ErrHandshakeFailed)
+	}
+
+	return nil
+}
+
+func writeHandshakeLine(conn net.Conn, line string) error {
+	if _, err := io.WriteString(conn, line+"\r\n"); err != nil {
+		return errors.Join(ErrHandshakeFailed, err)
+	}
+
+	return nil
+}
+
+// readHandshakeLine reads a CRLF or LF terminated line without
+// reading ahead, failing on lines longer than a stamp can be
+func readHandshakeLine(conn net.Conn) (string, error) {
+	line := make([]byte, 0, 256)
+
+	var b [1]byte
+	for {
+		if _, err := io.ReadFull(conn, b[:]); err != nil {
+			return "", errors.Join(ErrHandshakeFailed, err)
+		}
+
+		if b[0] == '\n' {
+			return strings.TrimSuffix(string(line), "\r"), nil
+		}
+
+		if len(line) >= len(handshakeBanner)+MaxStampLength {
+			return "", fmt.Errorf("%w: line too long", ErrHandshakeFailed)
+		}
+
+		line = append(line, b[0])
+	}
+}
@@ -0,0 +1,91 @@
+package hashcache
+
+import (
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandshake(t *testing.T) {
+	t.Parallel()
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- Handshake(server, HandshakeServer, HandshakePolicy{Resource: "tcp.example.com", ZeroBits: 2})
+		_, _ = io.WriteString(server, "application data\n")
+	}()
+
+	require.NoError(t, Handshake(client, HandshakeClient, HandshakePolicy{Resource: "tcp.example.com", MaxZeroBits: 4}))
+	require.NoError(t, <-serverErr)
+
+	line, err := readHandshakeLine(client)
+	require.NoError(t, err)
+	assert.Equal(t, "application data", line, "the handshake does not read ahead")
+}
+
+func TestHandshake_Rejected(t *testing.T) {
+	t.Parallel()
+
+	policy := HandshakePolicy{Resource: "tcp.example.com", ZeroBits: 2, Timeout: time.Second}
+
+	t.Run("too hard for the client", func(t *testing.T) {
+		t.Parallel()
+
+		server, client := net.Pipe()
+		defer server.Close()
+		defer client.Close()
+
+		go func() { _ = Handshake(server, HandshakeServer, policy) }()
+
+		err := Handshake(client, HandshakeClient, HandshakePolicy{MaxZeroBits: 1})
+		assert.ErrorIs(t, err, ErrHandshakeFailed)
+	})
+
+	t.Run("stamp of another challenge", func(t *testing.T) {
+		t.Parallel()
+
+		server, client := net.Pipe()
+		defer server.Close()
+		defer client.Close()
+
+		serverErr := make(chan error, 1)
+		go func() { serverErr <- Handshake(server, HandshakeServer, policy) }()
+
+		banner, err := readHandshakeLine(client)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(banner, handshakeBanner))
+
+		other, err := New("tcp.example.com", 2, time.Minute)
+		require.NoError(t, err)
+		require.NoError(t, writeHandshakeLine(client, other.String()))
+
+		response, err := readHandshakeLine(client)
+		require.NoError(t, err)
+		assert.Equal(t, "ERR unknown_challenge", response)
+		assert.ErrorIs(t, <-serverErr, ErrUnknownChallenge)
+	})
+
+	t.Run("silent client times out", func(t *testing.T) {
+		t.Parallel()
+
+		server, client := net.Pipe()
+		defer server.Close()
+		defer client.Close()
+
+		go func() { _, _ = io.Copy(io.Discard, client) }()
+
+		err := Handshake(server, HandshakeServer, HandshakePolicy{ZeroBits: 2, Timeout: 50 * time.Millisecond})
+		assert.ErrorIs(t, err, ErrHandshakeFailed)
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	})
+}
@@ -2,16 +2,16 @@ package hashcache
 
 import (
 	"context"
-	"crypto/rand"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
-	"errors"
 	"fmt"
+	"io"
 	"math"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,13 +19,31 @@ const (
 	defaultVersion      = 1
 	defaultRandBytesNum = 10
 
+	// MinRandBytes is the least number of random bytes accepted,
+	// shorter nonces make precomputation and collisions feasible
+	MinRandBytes = 8
+
+	// MaxResourceLength is the longest resource accepted by New
+	MaxResourceLength = 1024
+
+	// DefaultReplayGrace the spent stamps are kept past their expiration
+	DefaultReplayGrace = time.Second
+
 	headerStringSeparator = ":"
+
+	// maxHeaderTokens of any format
+	maxHeaderTokens = 8
 )
 
 var (
-	ErrRandomFailed        = errors.New("random generation failed")
-	ErrTooManyIterations   = errors.New("too many iterations")
-	ErrInvalidHeaderString = errors.New("invalid header string")
+	ErrRandomFailed        = newError(CodeRandomFailed, "random generation failed")
+	ErrTooManyIterations   = newError(CodeTooManyIterations, "too many iterations")
+	ErrCounterExhausted    = newError(CodeCounterExhausted, "counter space exhausted")
+	ErrInvalidHeaderString = newError(CodeMalformedStamp, "invalid header string")
+	ErrRandTooShort        = newError(CodeRandTooShort, "rand is too short")
+	ErrEmptyResource       = newError(CodeEmptyResource, "empty resource")
+	ErrInvalidZeroBits     = newError(CodeInvalidZeroBits, "invalid zero bits")
+	ErrInvalidTTL          = newError(CodeInvalidTTL, "invalid ttl")
 )
 
 var (
@@ -58,42 +76,306 @@ type Header struct {
 
 	// Number of "partial pre-image" (zero) bits in the hashed code.
 	ZeroBits uint8
+
+	// Optional extension data, must not contain the header separator.
+	// It is omitted from the string form when empty.
+	Ext string
+
+	// Format of the string form, the format of this library by default
+	Format HeaderFormat
+
+	// digest memoized by the solvers, ignored once any field changes
+	digest digestMemo
+
+	// raw string the header was parsed from, it is the string hashed
+	// until any field changes
+	raw rawForm
+
+	// decoded is set by Parse, which decodes the base64 resource
+	// of the format of this library
+	decoded bool
+
+	// counter token of a parsed stamp of the specification
+	specCounter specCounter
+}
+
+type headerFields struct {
+	Resource   string
+	Algorithm  string
+	Rand       string
+	Ext        string
+	Expiration int64
+	Counter    uint64
+	Ver        uint8
+	ZeroBits   uint8
+	Format     HeaderFormat
+	decoded    bool
+}
+
+type digestMemo struct {
+	of   headerFields
+	hash string
+}
+
+type specCounter struct {
+	of    uint64
+	token string
+}
+
+type rawForm struct {
+	of headerFields
+	s  string
+}
+
+type HeaderConfig struct {
+	RandBytes          int
+	ResourceNormalizer ResourceNormalizer
+	Format             HeaderFormat
+	Algorithm          string
+
+	// RandSource of the random bytes, crypto/rand when nil
+	RandSource RandSource
 }
 
-func New(resource string, zeroBits uint8, ttl time.Duration) (Header, error) {
-	randEncoded, err := randomizer(defaultRandBytesNum)
+type HeaderOption func(*HeaderConfig)
+
+// WithRandBytes sets the number of random bytes of the header,
+// it can not be less than MinRandBytes
+func WithRandBytes(n int) HeaderOption {
+	return func(cfg *HeaderConfig) {
+		cfg.RandBytes = n
+	}
+}
+
+// WithAlgorithm mints the header with the algorithm instead of
+// DefaultAlgorithm, e.g. sha-1 for legacy verifiers
+func WithAlgorithm(alg string) HeaderOption {
+	return func(cfg *HeaderConfig) {
+		cfg.Algorithm = alg
+	}
+}
+
+// NormalizeWith applies the normalizer to the resource before minting
+func NormalizeWith(n ResourceNormalizer) HeaderOption {
+	return func(cfg *HeaderConfig) {
+		cfg.ResourceNormalizer = n
+	}
+}
+
+func New(resource string, zeroBits uint8, ttl time.Duration, opts ...HeaderOption) (Header, error) {
+	cfg := HeaderConfig{RandBytes: defaultRandBytesNum, Algorithm: DefaultAlgorithm}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if !isSupportedAlgorithm(cfg.Algorithm) {
+		return Header{}, fmt.Errorf("%w: '%s'", ErrUnsupportedAlgorithm, cfg.Algorithm)
+	}
+
+	if cfg.RandBytes < MinRandBytes {
+		return Header{}, fmt.Errorf("%w: %d bytes, at least %d required", ErrRandTooShort, cfg.RandBytes, MinRandBytes)
+	}
+
+	if cfg.ResourceNormalizer != nil {
+		normalized, err := cfg.ResourceNormalizer(resource)
+		if err != nil {
+			return Header{}, err
+		}
+		resource = normalized
+	}
+
+	if err := validateNew(resource, zeroBits, ttl, cfg.Algorithm); err != nil {
+		return Header{}, err
+	}
+
+	gen := randomizer
+	if cfg.RandSource != nil {
+		gen = func(n int) (string, error) { return randBase64From(cfg.RandSource, n) }
+	}
+
+	randEncoded, err := gen(cfg.RandBytes)
 	if err != nil {
 		return Header{}, err
 	}
 
-	return Header{
+	h := Header{
 		Ver:        defaultVersion,
 		ZeroBits:   zeroBits,
 		Resource:   base64.StdEncoding.EncodeToString([]byte(resource)),
 		Rand:       randEncoded,
-		Algorithm:  algSha1,
+		Algorithm:  cfg.Algorithm,
 		Expiration: clock().Add(ttl).UnixNano(),
 		Counter:    0,
-	}, nil
+	}
+
+	return h.applyFormat(cfg.Format)
+}
+
+// validateNew catches the malformed challenges at mint time
+func validateNew(resource string, zeroBits uint8, ttl time.Duration, alg string) error {
+	if resource == "" {
+		return ErrEmptyResource
+	}
+
+	if len(resource) > MaxResourceLength {
+		return fmt.Errorf("%w: %d bytes, at most %d allowed", ErrInvalidResource, len(resource), MaxResourceLength)
+	}
+
+	if zeroBits == 0 {
+		return fmt.Errorf("%w: at least 1 required", ErrInvalidZeroBits)
+	}
+
+	switch resolveWorkFunction(alg).(type) {
+	case hashcashWork:
+		// the zero bits are counted in hex digits of the hash
+		if digits := resolveHash(alg).Size() * 2; int(zeroBits) > digits {
+			return fmt.Errorf("%w: %d, the %s hash has %d digits", ErrInvalidZeroBits, zeroBits, alg, digits)
+		}
+	case sequentialWork:
+		if zeroBits > maxSequentialBits {
+			return fmt.Errorf("%w: %d, at most %d for %s", ErrInvalidZeroBits, zeroBits, maxSequentialBits, alg)
+		}
+	}
+
+	if ttl < 0 {
+		return fmt.Errorf("%w: %s is negative", ErrInvalidTTL, ttl)
+	}
+
+	return nil
 }
 
+// String is the string the work is computed on: the raw string of a
+// parsed header until any of its fields changes, the canonical form
+// of the header otherwise, see Canonicalize
 func (h Header) String() string {
-	return fmt.Sprintf(
-		"%d:%d:%d:%s:%s:%s:%d",
-		h.Ver, h.ZeroBits, h.Expiration, h.Resource, h.Algorithm, h.Rand, h.Counter,
-	)
+	if h.raw.s != "" && h.raw.of == h.fields() {
+		return h.raw.s
+	}
+
+	switch h.Format {
+	case FormatSpec:
+		return h.specString()
+	case FormatV0:
+		return h.v0String()
+	}
+
+	return string(h.appendCanonical(nil))
+}
+
+// AppendString appends the String of the header to dst,
+// serializing the stamp without the intermediate string
+func (h Header) AppendString(dst []byte) []byte {
+	if h.raw.s != "" && h.raw.of == h.fields() {
+		return append(dst, h.raw.s...)
+	}
+
+	switch h.Format {
+	case FormatSpec:
+		return append(dst, h.specString()...)
+	case FormatV0:
+		return append(dst, h.v0String()...)
+	}
+
+	return h.appendCanonical(dst)
+}
+
+// WriteTo writes the String of the header to w through a pooled buffer
+func (h Header) WriteTo(w io.Writer) (int64, error) {
+	if h.raw.s != "" && h.raw.of == h.fields() {
+		n, err := io.WriteString(w, h.raw.s)
+		return int64(n), err
+	}
+
+	buf := stringBufPool.Get().(*[]byte)
+	defer stringBufPool.Put(buf)
+
+	*buf = h.AppendString((*buf)[:0])
+	n, err := w.Write(*buf)
+	return int64(n), err
+}
+
+var stringBufPool = sync.Pool{New: func() any { return new([]byte) }}
+
+func (h Header) appendCanonical(dst []byte) []byte {
+	dst = strconv.AppendUint(dst, uint64(h.Ver), 10)
+	dst = append(dst, headerStringSeparator...)
+	dst = strconv.AppendUint(dst, uint64(h.ZeroBits), 10)
+	dst = append(dst, headerStringSeparator...)
+	dst = strconv.AppendInt(dst, h.Expiration, 10)
+	dst = append(dst, headerStringSeparator...)
+
+	if h.decoded {
+		n := base64.StdEncoding.EncodedLen(len(h.Resource))
+		dst = slices.Grow(dst, n)
+		base64.StdEncoding.Encode(dst[len(dst):len(dst)+n], []byte(h.Resource))
+		dst = dst[:len(dst)+n]
+	} else {
+		dst = append(dst, h.Resource...)
+	}
+
+	dst = append(dst, headerStringSeparator...)
+	dst = append(dst, h.Algorithm...)
+	dst = append(dst, headerStringSeparator...)
+	dst = append(dst, h.Rand...)
+	dst = append(dst, headerStringSeparator...)
+	dst = strconv.AppendUint(dst, h.Counter, 10)
+
+	if h.Ext != "" {
+		dst = append(dst, headerStringSeparator...)
+		dst = append(dst, h.Ext...)
+	}
+
+	return dst
 }
 
 func (h Header) Valid() bool {
-	return verify(h.Hash(), h.ZeroBits)
+	return resolveWorkFunction(h.Algorithm).Verify(h)
+}
+
+// validContext is Valid giving up once ctx is done
+// for the work functions which support it
+func (h Header) validContext(ctx context.Context) bool {
+	wf := resolveWorkFunction(h.Algorithm)
+	if cv, ok := wf.(ContextVerifier); ok {
+		return cv.VerifyContext(ctx, h)
+	}
+
+	return wf.Verify(h)
 }
 
 func (h Header) Hash() string {
+	if h.digest.hash != "" && h.digest.of == h.fields() {
+		return h.digest.hash
+	}
+
 	hasher := resolveHash(h.Algorithm)
 	hasher.Write([]byte(h.String()))
 	return hex.EncodeToString(hasher.Sum(nil))
 }
 
+// memoized returns the header carrying its digest, so that following
+// Hash and Valid calls on it do not compute the digest again
+func (h Header) memoized() Header {
+	h.digest = digestMemo{of: h.fields(), hash: h.Hash()}
+	return h
+}
+
+func (h Header) fields() headerFields {
+	return headerFields{
+		Resource:   h.Resource,
+		Algorithm:  h.Algorithm,
+		Rand:       h.Rand,
+		Ext:        h.Ext,
+		Expiration: h.Expiration,
+		Counter:    h.Counter,
+		Ver:        h.Ver,
+		ZeroBits:   h.ZeroBits,
+		Format:     h.Format,
+		decoded:    h.decoded,
+	}
+}
+
 func verify(hash string, zeroBits uint8) bool {
 	if int(zeroBits) > len(hash) {
 		return false
@@ -108,28 +390,182 @@ func verify(hash string, zeroBits uint8) bool {
 	return true
 }
 
+// VerifyDigest reports whether the raw digest has the leading zero bits,
+// counted in hex digits as everywhere in the library, i.e. the first
+// zeroBits nibbles of the digest are zero
+func VerifyDigest(digest []byte, zeroBits uint8) bool {
+	if int(zeroBits) > len(digest)*2 {
+		return false
+	}
+
+	full := zeroBits / 2
+	for _, b := range digest[:full] {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return zeroBits%2 == 0 || digest[full]>>4 == 0
+}
+
 // Compute the useful work according to the header
 func Compute(ctx context.Context, h Header, maxIterations int) (Header, error) {
-	for counter := int(h.Counter); counter <= maxIterations || maxIterations <= 0; counter++ {
-		if ctx.Err() != nil {
-			return Header{}, ctx.Err()
+	return resolveWorkFunction(h.Algorithm).Solve(ctx, h, maxIterations)
+}
+
+// searchCounter checks the context every checkInterval hashes
+func searchCounter(ctx context.Context, h Header, maxIterations int) (Header, error) {
+	interval, pace := checkInterval(ctx), newPacer(ctx)
+	for done := uint64(0); maxIterations <= 0 || h.Counter <= uint64(maxIterations); done++ {
+		if done%interval == 0 {
+			if err := pace.checkpoint(ctx); err != nil {
+				return Header{}, err
+			}
 		}
 
-		if h.Valid() {
+		if h = h.memoized(); h.Valid() {
 			return h, nil
 		}
 
+		if h.Counter == math.MaxUint64 {
+			return Header{}, ErrCounterExhausted
+		}
+
 		h.Counter++
 	}
 
 	return Header{}, ErrTooManyIterations
 }
 
+// Reroll replaces the random string of the header and resets the counter,
+// giving a fresh search space e.g. after ErrCounterExhausted. The random
+// string keeps its length, the RandSource of the options, e.g. the one
+// the header was minted with, is read for it.
+func (h Header) Reroll(opts ...HeaderOption) (Header, error) {
+	var cfg HeaderConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	n := defaultRandBytesNum
+	if raw, err := base64.StdEncoding.DecodeString(h.Rand); err == nil && len(raw) >= MinRandBytes {
+		n = len(raw)
+	}
+
+	gen := randomizer
+	if cfg.RandSource != nil {
+		gen = func(n int) (string, error) { return randBase64From(cfg.RandSource, n) }
+	}
+
+	randEncoded, err := gen(n)
+	if err != nil {
+		return Header{}, err
+	}
+
+	h.Rand = randEncoded
+	h.Counter = 0
+	h.digest = digestMemo{}
+	return h, nil
+}
+
+// Parse the header string of any of the formats. The resource of the
+// format of this library is decoded. The parsed header keeps the string,
+// so that it is hashed as received even when it is not in the canonical
+// form, e.g. with a base64 counter.
 func Parse(header string) (Header, error) {
+	h, err := parseTokens(header)
+	if err != nil {
+		return Header{}, err
+	}
+
+	h.raw = rawForm{of: h.fields(), s: header}
+	return h, nil
+}
+
+// ParseInto parses the header string into h like Parse does, for the
+// verifiers handling many stamps per second: the header can be taken
+// from AcquireHeader and reused, and h is left untouched on errors
+func ParseInto(raw string, h *Header) error {
+	parsed, err := Parse(raw)
+	if err != nil {
+		return err
+	}
+
+	*h = parsed
+	return nil
+}
+
+var headerPool = sync.Pool{New: func() any { return new(Header) }}
+
+// AcquireHeader from the pool of headers, for ParseInto
+func AcquireHeader() *Header {
+	return headerPool.Get().(*Header)
+}
+
+// ReleaseHeader back to the pool, h must not be used afterwards
+func ReleaseHeader(h *Header) {
+	*h = Header{}
+	headerPool.Put(h)
+}
+
+// splitHeader splits the header string into the tokens without
+// allocating, failing when there are more tokens than any format has
+func splitHeader(header string, tokens *[maxHeaderTokens]string) (int, bool) {
+	n := 0
+	for {
+		if n == maxHeaderTokens {
+			return 0, false
+		}
+
+		token, rest, more := strings.Cut(header, headerStringSeparator)
+		tokens[n] = token
+		n++
+		if !more {
+			return n, true
+		}
+		header = rest
+	}
+}
+
+// decodeResource decodes the base64 resource
+// through a pooled buffer, allocating the string only
+func decodeResource(token string) (string, error) {
+	buf := resourceBufPool.Get().(*[]byte)
+	defer resourceBufPool.Put(buf)
+
+	if n := base64.StdEncoding.DecodedLen(len(token)); cap(*buf) < n {
+		*buf = make([]byte, n)
+	}
+
+	n, err := base64.StdEncoding.Decode((*buf)[:cap(*buf)], []byte(token))
+	if err != nil {
+		return "", err
+	}
+
+	return string((*buf)[:n]), nil
+}
+
+var resourceBufPool = sync.Pool{New: func() any { return new([]byte) }}
+
+func parseTokens(header string) (Header, error) {
 	var h Header
 
-	tokens := strings.Split(header, headerStringSeparator)
-	if len(tokens) < 7 {
+	var buf [maxHeaderTokens]string
+	n, ok := splitHeader(header, &buf)
+	if !ok {
+		return h, ErrInvalidHeaderString
+	}
+
+	tokens := buf[:n]
+	if tokens[0] == "0" {
+		return parseV0(header, tokens)
+	}
+
+	if isSpecFormat(tokens) {
+		return parseSpec(tokens)
+	}
+
+	if len(tokens) < 7 || len(tokens) > 8 {
 		return h, ErrInvalidHeaderString
 	}
 
@@ -156,42 +592,77 @@ func Parse(header string) (Header, error) {
 		return h, fmt.Errorf("%w: invalid expiration '%s'", ErrInvalidHeaderString, tokens[2])
 	}
 
-	resource, err := base64.StdEncoding.DecodeString(tokens[3])
+	resource, err := decodeResource(tokens[3])
 	if err != nil {
 		return h, fmt.Errorf("%w: invalid base64 encoded resource '%s'", ErrInvalidHeaderString, tokens[3])
 	}
 
-	alg := tokens[4]
-	if !slices.Contains(algorithms, alg) {
+	alg := strings.ToLower(tokens[4])
+	if !isSupportedAlgorithm(alg) {
 		return h, fmt.Errorf("%w: unsupported algorithm '%s'", ErrInvalidHeaderString, alg)
 	}
 
 	randEncoded := tokens[5]
 
-	counterByt, err := base64.StdEncoding.DecodeString(tokens[6])
+	counter, err := parseCounter(tokens[6])
 	if err != nil {
-		return h, fmt.Errorf("%w: invalid counter: %s", ErrInvalidHeaderString, err.Error())
+		return h, err
+	}
+
+	var ext string
+	if len(tokens) == 8 {
+		ext = tokens[7]
 	}
-	counter := binary.LittleEndian.Uint64(counterByt)
 
 	return Header{
-		Resource:   string(resource),
+		Resource:   resource,
 		Algorithm:  alg,
 		Rand:       randEncoded,
 		Expiration: expiration,
 		Counter:    counter,
 		Ver:        uint8(version),
 		ZeroBits:   uint8(zeroBits),
+		Ext:        ext,
+		decoded:    true,
 	}, nil
 }
 
-func randBase64(n int) (string, error) {
-	buf := make([]byte, n)
+// Canonicalize the header into the form minted by New: the resource
+// base64 encoded with padding, the algorithm in lower case and the
+// counter in decimal. The raw string of a parsed header is dropped, so
+// that String gives the canonical form, which is the one to hash when
+// the header is recomputed or signed.
+func (h Header) Canonicalize() Header {
+	if h.decoded {
+		h.Resource = base64.StdEncoding.EncodeToString([]byte(h.Resource))
+		h.decoded = false
+	}
 
-	if _, err := rand.Read(buf); err != nil {
-		return "", errors.Join(ErrRandomFailed, err)
+	h.Algorithm = strings.ToLower(h.Algorithm)
+	h.raw = rawForm{}
+	h.digest = digestMemo{}
+	return h
+}
+
+// parseCounter accepts both the decimal counter produced by String
+// and the base64 encoded little endian binary counter
+func parseCounter(token string) (uint64, error) {
+	if counter, err := strconv.ParseUint(token, 10, 64); err == nil {
+		return counter, nil
+	}
+
+	counterByt, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid counter: %s", ErrInvalidHeaderString, err.Error())
 	}
 
-	encoded := base64.StdEncoding.EncodeToString(buf)
-	return encoded, nil
+	if len(counterByt) != 8 {
+		return 0, fmt.Errorf("%w: invalid counter length %d", ErrInvalidHeaderString, len(counterByt))
+	}
+
+	return binary.LittleEndian.Uint64(counterByt), nil
+}
+
+func randBase64(n int) (string, error) {
+	return randBase64From(CryptoRandSource, n)
 }
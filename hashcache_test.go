@@ -1,12 +1,16 @@
 package hashcache
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/binary"
 	"fmt"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"io"
 	"strings"
 	"testing"
 	"time"
@@ -29,11 +33,11 @@ func TestHeader_String(t *testing.T) {
 	t.Run("default", func(t *testing.T) {
 		h, err := New("my.email@gmail.com", 3, 90*time.Second)
 		require.NoError(t, err)
-		assert.Equal(t, "1:3:1704207935000000000:bXkuZW1haWxAZ21haWwuY29t:sha-1:YWFhYWFhYWFhYQ==:0", h.String())
+		assert.Equal(t, "1:3:1704207935000000000:bXkuZW1haWxAZ21haWwuY29t:sha-256:YWFhYWFhYWFhYQ==:0", h.String())
 	})
 
-	t.Run("default with ip address and days of expiration", func(t *testing.T) {
-		h, err := New("127.0.0.1:9983", 3, 90*time.Hour)
+	t.Run("legacy algorithm with ip address and days of expiration", func(t *testing.T) {
+		h, err := New("127.0.0.1:9983", 3, 90*time.Hour, WithAlgorithm(algSha1))
 		require.NoError(t, err)
 		assert.Equal(t, "1:3:1704531845000000000:MTI3LjAuMC4xOjk5ODM=:sha-1:YWFhYWFhYWFhYQ==:0", h.String())
 	})
@@ -59,6 +63,19 @@ func TestParse(t *testing.T) {
 				Rand:       "vZOxuoIgixP+hw==",
 			},
 		},
+		{
+			in: "1:20:1665396610:bG9jYWxob3N0:sha-256:vZOxuoIgixP+hw==:AAAAAAAAAAA=:prev",
+			out: Header{
+				Ver:        1,
+				ZeroBits:   20,
+				Expiration: 1665396610,
+				Resource:   "localhost",
+				Algorithm:  algSha256,
+				Counter:    0,
+				Rand:       "vZOxuoIgixP+hw==",
+				Ext:        "prev",
+			},
+		},
 	}
 
 	for i, tc := range tt {
@@ -70,7 +87,7 @@ func TestParse(t *testing.T) {
 				t.Fatalf("expected an error %v but got nil", tc.err)
 			}
 
-			if diff := cmp.Diff(tc.out, h); diff != "" {
+			if diff := cmp.Diff(tc.out, h, cmpopts.IgnoreUnexported(Header{})); diff != "" {
 				t.Fatalf("mismatch (-want, +got):\n%s", diff)
 			}
 		})
@@ -100,12 +117,12 @@ func TestHeader_Compute(t *testing.T) {
 		{
 			header:        "1:5:1665396610:bG9jYWxob3N0:sha-256:vZOxuoIgixP+hw==:AAAAAAAAAAA=",
 			maxIterations: 1 << 22,
-			resultHash:    "00000f3a78cd2ebd62aba2542c5c02975b28e41653804097d6e84672d8f8d9e9",
+			resultHash:    "0000019fbcf587a9273bc275aa05ee19187301aa23b96f8accbd69aad6a3ff4d",
 		},
 		{
-			header:        "1:6:1665396610:bG9jYWxob3N0:sha-512:vZOxuoIgixP+hw==:AAAAAAAAAAA=",
+			header:        "1:6:1665396610:bG9jYWxob3N0:sha-512:aGFzaGNhc2gwMw==:AAAAAAAAAAA=",
 			maxIterations: 1 << 22,
-			resultHash:    "000000df7fc0cbaddb2a9c150e5a52c298409c7c86bd1d51b63b38aeca54f74ff20a84e62d6a445cd4a6a9cb45db1ea5b9f001a27839e65963402f21387147c6",
+			resultHash:    "0000007c34d87b2b99af737241a55c8de8113a58c69a0818b8e9052d9374f1f8a03175a5f5c7b57f1f725677b2bab6c441ccc88b5ad79b44795c40e3ab3e1343",
 		},
 	}
 
@@ -130,3 +147,500 @@ func TestHeader_Compute(t *testing.T) {
 		})
 	}
 }
+
+func TestHeader_ComputeSequential(t *testing.T) {
+	t.Parallel()
+
+	h, err := Parse("1:12:1665396610:bG9jYWxob3N0:seq-sha-256:vZOxuoIgixP+hw==:AAAAAAAAAAA=")
+	require.NoError(t, err)
+	assert.False(t, h.Valid())
+
+	computed, err := Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+	assert.True(t, computed.Valid())
+	assert.Len(t, strings.Split(computed.Ext, checkpointSeparator), sequentialCheckpoints)
+
+	tampered := computed
+	tampered.Resource = "b3RoZXJob3N0"
+	assert.False(t, tampered.Valid())
+}
+
+func TestHeader_ComputeCounterExhausted(t *testing.T) {
+	t.Parallel()
+
+	h, err := Parse("1:20:1665396610:bG9jYWxob3N0:sha-256:vZOxuoIgixP+hw==:18446744073709551613")
+	require.NoError(t, err)
+
+	_, err = Compute(context.Background(), h, 0)
+	assert.ErrorIs(t, err, ErrCounterExhausted)
+
+	rerolled, err := h.Reroll()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), rerolled.Counter)
+	assert.NotEqual(t, h.Rand, rerolled.Rand)
+
+	// the rand keeps its length and is read from the source
+	src := stuckRandSource{out: bytes.Repeat([]byte{0xab}, 24), n: 24}
+	h, err = New("127.0.0.1", 1, time.Hour, WithRandBytes(24))
+	require.NoError(t, err)
+	rerolled, err = h.Reroll(WithRandSource(src))
+	require.NoError(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(src.out), rerolled.Rand)
+}
+
+func TestComputeWithPool_RandomSearch(t *testing.T) {
+	t.Parallel()
+
+	h, err := Parse("1:3:1665396610:bG9jYWxob3N0:sha-256:vZOxuoIgixP+hw==:AAAAAAAAAAA=")
+	require.NoError(t, err)
+
+	result, err := ComputeWithPool(context.Background(), h, WithRandomSearch(), func(cfg *PoolConfig) {
+		cfg.Timeout = 3 * time.Second
+	})
+	require.NoError(t, err)
+	assert.True(t, result.Header.Valid())
+}
+
+func TestComputeWithPool_CounterOffsetRandomized(t *testing.T) {
+	t.Parallel()
+
+	h, err := Parse("1:3:1665396610:bG9jYWxob3N0:sha-256:vZOxuoIgixP+hw==:AAAAAAAAAAA=")
+	require.NoError(t, err)
+
+	result, err := ComputeWithPool(context.Background(), h, WithCounterOffsetRandomized(), func(cfg *PoolConfig) {
+		cfg.MaxIterations = 1 << 20
+		cfg.Timeout = 3 * time.Second
+	})
+	require.NoError(t, err)
+	assert.True(t, result.Header.Valid())
+	assert.Greater(t, result.Header.Counter, uint64(1<<20))
+}
+
+func TestComputeWithPool_CPUBudget(t *testing.T) {
+	t.Parallel()
+
+	h, err := Parse("1:40:1665396610:bG9jYWxob3N0:sha-256:vZOxuoIgixP+hw==:AAAAAAAAAAA=")
+	require.NoError(t, err)
+
+	_, err = ComputeWithPool(context.Background(), h, WithRandomSearch(), WithCPUBudget(50*time.Millisecond), func(cfg *PoolConfig) {
+		cfg.Timeout = 10 * time.Second
+	})
+	assert.ErrorIs(t, err, ErrCPUBudgetExceeded)
+}
+
+func TestComputeWithPool_Limits(t *testing.T) {
+	t.Parallel()
+
+	h, err := Parse("1:40:1665396610:bG9jYWxob3N0:sha-256:vZOxuoIgixP+hw==:AAAAAAAAAAA=")
+	require.NoError(t, err)
+
+	_, err = ComputeWithPool(context.Background(), h, func(cfg *PoolConfig) {
+		cfg.MaxIterations = 1000
+	})
+	var computeErr *ComputeError
+	require.ErrorAs(t, err, &computeErr)
+	assert.ErrorIs(t, err, ErrTooManyIterations)
+	assert.Equal(t, uint64(1001), computeErr.Iterations)
+	assert.Equal(t, uint64(1000), computeErr.Counter)
+
+	_, err = ComputeWithPool(context.Background(), h, func(cfg *PoolConfig) {
+		cfg.Timeout = 20 * time.Millisecond
+	})
+	require.ErrorAs(t, err, &computeErr)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NotErrorIs(t, err, ErrTooManyIterations)
+	assert.Positive(t, computeErr.Iterations)
+	assert.Positive(t, computeErr.Counter)
+}
+
+func TestHeader_HashMemoization(t *testing.T) {
+	t.Parallel()
+
+	h, err := Parse("1:3:1665396610:bG9jYWxob3N0:sha-256:vZOxuoIgixP+hw==:AAAAAAAAAAA=")
+	require.NoError(t, err)
+
+	computed, err := Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+	assert.NotEmpty(t, computed.digest.hash)
+
+	fresh := computed
+	fresh.digest = digestMemo{}
+	assert.Equal(t, fresh.Hash(), computed.Hash())
+
+	computed.Counter++
+	fresh.Counter++
+	assert.Equal(t, fresh.Hash(), computed.Hash())
+}
+
+func TestHeader_Formats(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	tt := []struct {
+		format HeaderFormat
+		prefix string
+	}{
+		{format: FormatLibrary, prefix: "1:2:1704207845000000000:MTI3LjAuMC4x:sha-256:"},
+		{format: FormatSpec, prefix: "1:8:240102150405:127.0.0.1::"},
+		{format: FormatV0, prefix: "0:240102150405:127.0.0.1:"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.format.String(), func(t *testing.T) {
+			h, err := New("127.0.0.1", 2, 0, WithFormat(tc.format))
+			require.NoError(t, err)
+			h, err = Compute(context.Background(), h, 0)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(h.String(), tc.prefix), h.String())
+
+			parsed, err := parseWire(h.String())
+			require.NoError(t, err)
+			assert.Equal(t, tc.format, parsed.Format)
+			assert.Equal(t, h.String(), parsed.String())
+			assert.True(t, parsed.Valid())
+		})
+	}
+
+	_, err := New("host:8080", 2, time.Minute, WithFormat(FormatSpec))
+	assert.ErrorIs(t, err, ErrInvalidResource)
+}
+
+func TestParse_SpecStamp(t *testing.T) {
+	clock = func() time.Time { return time.Date(2013, 3, 3, 0, 0, 0, 0, time.UTC) }
+	defer func() { clock = time.Now }()
+
+	// a stamp of the hashcash tool, 20 zero bits are 5 zero hex digits
+	raw := "1:20:1303030600:adam@cypherspace.org::McMybZIhxKXu57jd:ckvi"
+	require.NoError(t, (&VerifierPolicy{AllowLegacy: true}).prevalidate(raw, 5, nil))
+
+	h, err := Parse(raw)
+	require.NoError(t, err)
+	assert.Equal(t, FormatSpec, h.Format)
+	assert.Equal(t, uint8(5), h.ZeroBits)
+	assert.True(t, h.Valid())
+
+	v := NewVerifier(WithMinZeroBits(5), AllowLegacyAlgorithms())
+	require.NoError(t, v.Verify(h))
+
+	// the counter token is emitted as received
+	h.Ext = "v=1"
+	assert.Equal(t, "1:20:130303060000:adam@cypherspace.org:v=1:McMybZIhxKXu57jd:ckvi", h.String())
+
+	_, err = Parse("1:20:1303030600:adam@cypherspace.org::McMybZIhxKXu57jd:ck.i")
+	assert.ErrorIs(t, err, ErrInvalidHeaderString)
+}
+
+func TestParse_RawString(t *testing.T) {
+	t.Parallel()
+
+	h, err := New("localhost", 1, time.Hour)
+	require.NoError(t, err)
+	h, err = Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+
+	// the same stamp with a base64 counter and an upper case algorithm
+	var counter [8]byte
+	binary.LittleEndian.PutUint64(counter[:], h.Counter)
+	tokens := strings.Split(h.String(), ":")
+	tokens[4] = strings.ToUpper(tokens[4])
+	tokens[6] = base64.StdEncoding.EncodeToString(counter[:])
+	raw := strings.Join(tokens, ":")
+
+	parsed, err := Parse(raw)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost", parsed.Resource)
+	assert.Equal(t, raw, parsed.String())
+
+	canonical := parsed.Canonicalize()
+	assert.Equal(t, h.String(), canonical.String())
+	assert.True(t, canonical.Valid())
+
+	parsed.Counter++
+	assert.Equal(t, canonical.Resource, strings.Split(parsed.String(), ":")[3])
+
+	wire, err := parseWire(h.String())
+	require.NoError(t, err)
+	assert.Equal(t, h.String(), wire.String())
+	assert.True(t, wire.Valid())
+}
+
+func TestHeader_Describe(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	h, err := New("example.com", 2, time.Minute)
+	require.NoError(t, err)
+	h, err = Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+
+	described, err := DescribeStamp(h.String())
+	require.NoError(t, err)
+	assert.Equal(t, h.Describe(), described)
+	assert.Contains(t, described, "resource:  example.com\n")
+	assert.Contains(t, described, "zero bits: 2 (256 hashes on average)\n")
+	assert.Contains(t, described, "(1m0s remaining)\n")
+	assert.Contains(t, described, "proof:     valid\n")
+
+	now = now.Add(time.Hour)
+	for h.Valid() {
+		h.Counter++
+	}
+	described = h.Describe()
+	assert.Contains(t, described, "(expired 59m0s ago)\n")
+	assert.Contains(t, described, "proof:     invalid")
+}
+
+func TestNew_Validation(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name     string
+		resource string
+		zeroBits uint8
+		ttl      time.Duration
+		opts     []HeaderOption
+		err      error
+	}{
+		{name: "empty resource", resource: "", zeroBits: 1, ttl: time.Minute, err: ErrEmptyResource},
+		{name: "resource too long", resource: strings.Repeat("a", MaxResourceLength+1), zeroBits: 1, ttl: time.Minute, err: ErrInvalidResource},
+		{name: "zero bits", resource: "127.0.0.1", zeroBits: 0, ttl: time.Minute, err: ErrInvalidZeroBits},
+		{name: "more bits than hash digits", resource: "127.0.0.1", zeroBits: 41, ttl: time.Minute, opts: []HeaderOption{WithAlgorithm(algSha1)}, err: ErrInvalidZeroBits},
+		{name: "negative ttl", resource: "127.0.0.1", zeroBits: 1, ttl: -time.Second, err: ErrInvalidTTL},
+		{name: "valid", resource: strings.Repeat("a", MaxResourceLength), zeroBits: 64, ttl: time.Minute},
+	}
+
+	for _, tc := range tt {
+		_, err := New(tc.resource, tc.zeroBits, tc.ttl, tc.opts...)
+		if tc.err == nil {
+			assert.NoError(t, err, tc.name)
+		} else {
+			assert.ErrorIs(t, err, tc.err, tc.name)
+		}
+	}
+}
+
+func TestComputeAsync(t *testing.T) {
+	t.Parallel()
+
+	easy, err := Parse("1:3:1665396610:bG9jYWxob3N0:sha-256:vZOxuoIgixP+hw==:AAAAAAAAAAA=")
+	require.NoError(t, err)
+	hard, err := Parse("1:40:1665396610:bG9jYWxob3N0:sha-256:vZOxuoIgixP+hw==:AAAAAAAAAAA=")
+	require.NoError(t, err)
+
+	easyJob := ComputeAsync(context.Background(), easy)
+	hardJob := ComputeAsync(context.Background(), hard)
+
+	select {
+	case <-easyJob.Done():
+	case <-hardJob.Done():
+		t.Fatal("the hard job finished first")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	result, err := easyJob.Result()
+	require.NoError(t, err)
+	assert.True(t, result.Header.Valid())
+
+	hardJob.Cancel()
+	_, err = hardJob.Result()
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestComputeWithPool_Recording(t *testing.T) {
+	t.Parallel()
+
+	h, err := New("localhost", 2, time.Hour)
+	require.NoError(t, err)
+
+	var recording bytes.Buffer
+	result, err := ComputeWithPool(context.Background(), h, WithRecording(&recording))
+	require.NoError(t, err)
+
+	replayed, err := Replay(bytes.NewReader(recording.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, int(result.Header.Counter)+1, replayed.Decisions)
+	assert.True(t, replayed.Valid)
+	assert.Equal(t, result.Header.String(), replayed.Header.String())
+
+	tampered := strings.Replace(recording.String(), `"counter":0,"hash":"`, `"counter":0,"hash":"f`, 1)
+	_, err = Replay(strings.NewReader(tampered))
+	assert.ErrorIs(t, err, ErrReplayMismatch)
+}
+
+func TestVerifyDigest(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		digest   []byte
+		zeroBits uint8
+		want     bool
+	}{
+		{name: "no zero bits", digest: []byte{0xff}, zeroBits: 0, want: true},
+		{name: "odd nibbles", digest: []byte{0x00, 0x0f, 0xff}, zeroBits: 3, want: true},
+		{name: "odd nibbles missing", digest: []byte{0x00, 0x10, 0xff}, zeroBits: 3, want: false},
+		{name: "even nibbles", digest: []byte{0x00, 0x00, 0xff}, zeroBits: 4, want: true},
+		{name: "even nibbles missing", digest: []byte{0x00, 0x01, 0xff}, zeroBits: 4, want: false},
+		{name: "whole digest", digest: []byte{0x00, 0x00}, zeroBits: 4, want: true},
+		{name: "over the digest", digest: []byte{0x00, 0x00}, zeroBits: 5, want: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, VerifyDigest(tc.digest, tc.zeroBits))
+			assert.Equal(t, verify(fmt.Sprintf("%x", tc.digest), tc.zeroBits), VerifyDigest(tc.digest, tc.zeroBits))
+		})
+	}
+}
+
+func TestParseInto(t *testing.T) {
+	raw := "1:20:1704207845000000000:MTI3LjAuMC4x:sha-256:vZOxuoIgixP+hw==:12345:v=1"
+	want, err := Parse(raw)
+	require.NoError(t, err)
+
+	h := AcquireHeader()
+	defer ReleaseHeader(h)
+
+	require.NoError(t, ParseInto(raw, h))
+	assert.Equal(t, want, *h)
+	assert.Equal(t, "127.0.0.1", h.Resource)
+
+	assert.ErrorIs(t, ParseInto(raw+":extra", h), ErrInvalidHeaderString)
+	assert.Equal(t, want, *h)
+
+	// only the decoded resource is allocated
+	if !raceEnabled {
+		allocs := testing.AllocsPerRun(100, func() { _ = ParseInto(raw, h) })
+		assert.LessOrEqual(t, allocs, float64(1))
+	}
+}
+
+func TestHeader_AppendString(t *testing.T) {
+	raw := "1:20:1704207845000000000:MTI3LjAuMC4x:sha-256:vZOxuoIgixP+hw==:12345:v=1"
+	parsed, err := Parse(raw)
+	require.NoError(t, err)
+
+	changed := parsed
+	changed.Counter++
+
+	spec := parsed
+	spec.Format = FormatSpec
+
+	created, err := New("127.0.0.1", 4, time.Hour)
+	require.NoError(t, err)
+
+	for name, h := range map[string]Header{"parsed": parsed, "changed": changed, "spec": spec, "created": created} {
+		assert.Equal(t, h.String(), string(h.AppendString([]byte{})), name)
+		assert.Equal(t, "X-Hashcash: "+h.String(), string(h.AppendString([]byte("X-Hashcash: "))), name)
+
+		var buf bytes.Buffer
+		n, err := h.WriteTo(&buf)
+		require.NoError(t, err)
+		assert.Equal(t, h.String(), buf.String(), name)
+		assert.Equal(t, int64(buf.Len()), n, name)
+	}
+
+	if raceEnabled {
+		return
+	}
+
+	dst := make([]byte, 0, 256)
+	allocs := testing.AllocsPerRun(100, func() { dst = changed.AppendString(dst[:0]) })
+	assert.Zero(t, allocs)
+
+	allocs = testing.AllocsPerRun(100, func() { _, _ = changed.WriteTo(io.Discard) })
+	assert.Zero(t, allocs)
+}
+
+func TestEncodeTXT(t *testing.T) {
+	t.Parallel()
+
+	h, err := New(strings.Repeat("sub.", 60)+"example.com", 1, time.Hour)
+	require.NoError(t, err)
+	h.Ext = "conc=4;note=dynamic dns"
+	h, err = Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+
+	chunks := EncodeTXT(h)
+	require.Len(t, chunks, 2)
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, len(chunk), 255)
+		assert.NotContains(t, chunk, ";")
+		assert.NotContains(t, chunk, " ")
+	}
+
+	decoded, err := DecodeTXT(chunks)
+	require.NoError(t, err)
+	assert.Equal(t, h.String(), decoded.String())
+	assert.True(t, decoded.Valid())
+
+	_, err = DecodeTXT([]string{"v=spf1 -all"})
+	assert.ErrorIs(t, err, ErrInvalidTXT)
+
+	_, err = DecodeTXT([]string{TXTPrefix + "%zz"})
+	assert.ErrorIs(t, err, ErrInvalidTXT)
+}
+
+type stuckRandSource struct {
+	out []byte
+	n   int
+}
+
+func (s stuckRandSource) Read(b []byte) (int, error) {
+	return copy(b[:min(len(b), s.n)], s.out), nil
+}
+
+func TestCheckedRandSource(t *testing.T) {
+	t.Parallel()
+
+	t.Run("healthy", func(t *testing.T) {
+		src := NewCheckedRandSource(CryptoRandSource)
+		for i := 0; i < 100; i++ {
+			_, err := New("127.0.0.1", 1, time.Hour, WithRandSource(src))
+			require.NoError(t, err)
+		}
+
+		health := src.Health()
+		assert.Equal(t, uint64(100), health.Reads)
+		assert.Zero(t, health.Failures)
+		assert.True(t, health.Healthy)
+	})
+
+	t.Run("repeated output", func(t *testing.T) {
+		var failures []error
+		src := NewCheckedRandSource(
+			stuckRandSource{out: []byte("0123456789"), n: 10},
+			WithRandFailureHandler(func(err error) { failures = append(failures, err) }),
+		)
+
+		_, err := New("127.0.0.1", 1, time.Hour, WithRandSource(src))
+		require.NoError(t, err)
+		_, err = New("127.0.0.1", 1, time.Hour, WithRandSource(src))
+		assert.ErrorIs(t, err, ErrRandomFailed)
+		assert.Equal(t, CodeRandomFailed, CodeOf(err))
+
+		health := src.Health()
+		assert.Equal(t, uint64(1), health.Repeats)
+		assert.False(t, health.Healthy)
+		assert.Len(t, failures, 1)
+	})
+
+	t.Run("constant output", func(t *testing.T) {
+		src := NewCheckedRandSource(stuckRandSource{out: make([]byte, 10), n: 10}, WithRandHistory(0))
+		_, err := New("127.0.0.1", 1, time.Hour, WithRandSource(src))
+		assert.ErrorIs(t, err, ErrRandomFailed)
+	})
+
+	t.Run("short read falls back", func(t *testing.T) {
+		src := NewCheckedRandSource(stuckRandSource{out: []byte("0123456789"), n: 4}, WithRandFallback(CryptoRandSource))
+		h, err := New("127.0.0.1", 1, time.Hour, WithRandSource(src))
+		require.NoError(t, err)
+		assert.NotEqual(t, "MDEyMwAAAAAAAA==", h.Rand)
+
+		health := src.Health()
+		assert.Equal(t, uint64(1), health.ShortReads)
+		assert.Equal(t, uint64(1), health.Fallbacks)
+		assert.ErrorIs(t, health.LastErr, ErrRandomFailed)
+	})
+}
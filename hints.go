@@ -0,0 +1,114 @@
+package hashcache
+
+import (
+	"context"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	hintConcurrencyExtName = "conc"
+	hintIterationsExtName  = "iter"
+	hintAlgorithmsExtName  = "algs"
+
+	// hintPoolMinIterations below which a hinted concurrency is not
+	// worth the overhead of the pool
+	hintPoolMinIterations = 1 << 16
+)
+
+// ChallengeHints are embedded by the server in the extension of its
+// challenges, so that a heterogeneous client base solves them in a
+// predictable time. SolveChallenge honors them.
+type ChallengeHints struct {
+	// Concurrency suggested for the solve
+	Concurrency int
+
+	// ExpectedIterations of the solve, ChallengeTemplate fills it
+	// from the zero bits of the challenge
+	ExpectedIterations uint64
+
+	// Algorithms preferred by the server in order,
+	// for the offers of the client, see PreferredOrder
+	Algorithms []string
+}
+
+// ParseHints from the extension of a challenge, the malformed ones are ignored
+func ParseHints(ext string) ChallengeHints {
+	var hints ChallengeHints
+
+	if v, ok := extValue(ext, hintConcurrencyExtName); ok {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			hints.Concurrency = n
+		}
+	}
+
+	if v, ok := extValue(ext, hintIterationsExtName); ok {
+		if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+			hints.ExpectedIterations = n
+		}
+	}
+
+	if v, ok := extValue(ext, hintAlgorithmsExtName); ok && v != "" {
+		hints.Algorithms = strings.Split(v, ",")
+	}
+
+	return hints
+}
+
+// withExt adds the hints to the extension
+func (hints ChallengeHints) withExt(ext string) string {
+	if hints.Concurrency > 0 {
+		ext = withExtValue(ext, hintConcurrencyExtName, strconv.Itoa(hints.Concurrency))
+	}
+
+	if hints.ExpectedIterations > 0 {
+		ext = withExtValue(ext, hintIterationsExtName, strconv.FormatUint(hints.ExpectedIterations, 10))
+	}
+
+	if len(hints.Algorithms) > 0 {
+		ext = withExtValue(ext, hintAlgorithmsExtName, strings.Join(hints.Algorithms, ","))
+	}
+
+	return ext
+}
+
+// PreferredOrder sorts the algorithms of the client by the preference
+// of the server, keeping the order of the client for the others
+func (hints ChallengeHints) PreferredOrder(algs []string) []string {
+	rank := func(alg string) int {
+		if i := slices.Index(hints.Algorithms, alg); i >= 0 {
+			return i
+		}
+		return len(hints.Algorithms)
+	}
+
+	sorted := slices.Clone(algs)
+	slices.SortStableFunc(sorted, func(a, b string) int {
+		return rank(a) - rank(b)
+	})
+	return sorted
+}
+
+// concurrency to solve with, the hint of the server bounded
+// by the cores of the client
+func (hints ChallengeHints) concurrency() int {
+	return max(min(hints.Concurrency, runtime.NumCPU()), 0)
+}
+
+// solveHinted solves the challenge with the pool when its hints
+// suggest a concurrency and enough iterations to be worth it
+func solveHinted(ctx context.Context, h Header, maxIterations int) (Header, error) {
+	hints := ParseHints(h.Ext)
+	concurrency := hints.concurrency()
+	if concurrency <= 1 || hints.ExpectedIterations < hintPoolMinIterations {
+		return Compute(ctx, h, maxIterations)
+	}
+
+	result, err := ComputeWithPool(ctx, h, func(cfg *PoolConfig) {
+		cfg.Concurrency = concurrency
+		cfg.MaxIterations = maxIterations
+	})
+	return result.Header, err
+}
@@ -0,0 +1,129 @@
+package hashcache
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultSolveTimeHeader carries the milliseconds the client spent
+// solving the stamp of the request, when it reports them
+const DefaultSolveTimeHeader = "X-Hashcash-Solve-Time"
+
+var defaultSolveTimeBuckets = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	time.Minute,
+}
+
+// WorkHistogram records the zero bits of the accepted stamps and the
+// solve times reported by the clients, showing the work clients really
+// do. A distribution piled up on the minimum reveals clients gaming it.
+type WorkHistogram struct {
+	mu         sync.Mutex
+	buckets    []time.Duration
+	zeroBits   [256]uint64
+	solveTimes []uint64
+	reported   uint64
+}
+
+// WorkHistogramSnapshot is a copy of the histogram. SolveTimes counts
+// the reports by the upper bounds of the buckets, the last counter being
+// for solve times above all the bounds.
+type WorkHistogramSnapshot struct {
+	ZeroBits         map[uint8]uint64 `json:"zero_bits"`
+	SolveTimeBuckets []Duration       `json:"solve_time_buckets"`
+	SolveTimes       []uint64         `json:"solve_times"`
+}
+
+// NewWorkHistogram with solve time buckets given as upper bounds
+// in ascending order, defaults are used when none are given
+func NewWorkHistogram(buckets ...time.Duration) *WorkHistogram {
+	if len(buckets) == 0 {
+		buckets = defaultSolveTimeBuckets
+	}
+
+	return &WorkHistogram{buckets: buckets, solveTimes: make([]uint64, len(buckets)+1)}
+}
+
+// WithWorkHistogram records the stamps accepted by VerifyFor and VerifyBatch
+func WithWorkHistogram(hist *WorkHistogram) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.Histogram = hist
+	}
+}
+
+func (hist *WorkHistogram) ObserveZeroBits(zeroBits uint8) {
+	hist.mu.Lock()
+	defer hist.mu.Unlock()
+
+	hist.zeroBits[zeroBits]++
+}
+
+func (hist *WorkHistogram) ObserveSolveTime(d time.Duration) {
+	hist.mu.Lock()
+	defer hist.mu.Unlock()
+
+	bucket := len(hist.buckets)
+	for i, bound := range hist.buckets {
+		if d <= bound {
+			bucket = i
+			break
+		}
+	}
+	hist.solveTimes[bucket]++
+}
+
+func (hist *WorkHistogram) Snapshot() WorkHistogramSnapshot {
+	hist.mu.Lock()
+	defer hist.mu.Unlock()
+
+	s := WorkHistogramSnapshot{
+		ZeroBits:         make(map[uint8]uint64),
+		SolveTimeBuckets: make([]Duration, len(hist.buckets)),
+		SolveTimes:       append([]uint64(nil), hist.solveTimes...),
+	}
+
+	for bits, n := range hist.zeroBits {
+		if n > 0 {
+			s.ZeroBits[uint8(bits)] = n
+		}
+	}
+
+	for i, bound := range hist.buckets {
+		s.SolveTimeBuckets[i] = Duration(bound)
+	}
+
+	return s
+}
+
+// ShareAt is the fraction of the accepted stamps with exactly the zero bits
+func (s WorkHistogramSnapshot) ShareAt(zeroBits uint8) float64 {
+	var total uint64
+	for _, n := range s.ZeroBits {
+		total += n
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	return float64(s.ZeroBits[zeroBits]) / float64(total)
+}
+
+// observeSolveTime records the solve time reported by the request,
+// malformed reports are ignored
+func (hist *WorkHistogram) observeSolveTime(r *http.Request) {
+	ms, err := strconv.ParseUint(r.Header.Get(DefaultSolveTimeHeader), 10, 32)
+	if err != nil {
+		return
+	}
+
+	hist.ObserveSolveTime(time.Duration(ms) * time.Millisecond)
+}
@@ -0,0 +1,137 @@
+package hashcache
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrIssueLimited = newError(CodeIssueLimited, "challenge issuance limited")
+
+// IssueLimits cap the challenges issued to a client, so that attackers
+// can not farm cheap challenges to solve offline in bulk. Zero means
+// no limit.
+type IssueLimits struct {
+	// MaxOutstanding challenges neither redeemed nor expired
+	MaxOutstanding int
+
+	// PerMinute challenges over a sliding minute
+	PerMinute int
+}
+
+// IssueLimitError rejects an issuance, RetryAfter is when
+// the client is expected to be under the limits again
+type IssueLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *IssueLimitError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrIssueLimited, e.RetryAfter)
+}
+
+func (e *IssueLimitError) Unwrap() error {
+	return ErrIssueLimited
+}
+
+type issueState struct {
+	// issued times within the last minute, oldest first
+	issued []time.Time
+
+	// outstanding challenge keys by their expiration
+	outstanding map[string]time.Time
+}
+
+// IssueLimiter enforces the IssueLimits per client key
+type IssueLimiter struct {
+	mu         sync.Mutex
+	limits     IssueLimits
+	clients    map[string]*issueState
+	lastPruned time.Time
+}
+
+func NewIssueLimiter(limits IssueLimits) *IssueLimiter {
+	return &IssueLimiter{limits: limits, clients: make(map[string]*issueState)}
+}
+
+// WithIssueLimits caps the challenges issued per client key
+func WithIssueLimits(limits IssueLimits) MiddlewareOption {
+	return func(cfg *MiddlewareConfig) {
+		cfg.IssueLimiter = NewIssueLimiter(limits)
+	}
+}
+
+// Issue records the challenge issued to the client,
+// failing with an IssueLimitError when over the limits
+func (l *IssueLimiter) Issue(clientKey string, h Header) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := clock()
+	if now.Sub(l.lastPruned) >= time.Minute {
+		l.prune(now)
+	}
+
+	state, ok := l.clients[clientKey]
+	if !ok {
+		state = &issueState{outstanding: make(map[string]time.Time)}
+		l.clients[clientKey] = state
+	}
+	state.prune(now)
+
+	var retryAfter time.Duration
+	if n := l.limits.PerMinute; n > 0 && len(state.issued) >= n {
+		retryAfter = state.issued[len(state.issued)-n].Add(time.Minute).Sub(now)
+	}
+
+	if n := l.limits.MaxOutstanding; n > 0 && len(state.outstanding) >= n {
+		var first time.Time
+		for _, expiresAt := range state.outstanding {
+			if first.IsZero() || expiresAt.Before(first) {
+				first = expiresAt
+			}
+		}
+		retryAfter = max(retryAfter, first.Sub(now))
+	}
+
+	if retryAfter > 0 {
+		return &IssueLimitError{RetryAfter: retryAfter}
+	}
+
+	state.issued = append(state.issued, now)
+	state.outstanding[ChallengeKey(h)] = time.Unix(0, h.Expiration)
+	return nil
+}
+
+// Redeem frees the outstanding challenge solved by the stamp of the client
+func (l *IssueLimiter) Redeem(clientKey string, h Header) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if state, ok := l.clients[clientKey]; ok {
+		delete(state.outstanding, ChallengeKey(h))
+	}
+}
+
+// prune forgets the clients without recent or outstanding challenges
+func (l *IssueLimiter) prune(now time.Time) {
+	l.lastPruned = now
+	for key, state := range l.clients {
+		if state.prune(now); len(state.issued) == 0 && len(state.outstanding) == 0 {
+			delete(l.clients, key)
+		}
+	}
+}
+
+func (s *issueState) prune(now time.Time) {
+	i := 0
+	for i < len(s.issued) && now.Sub(s.issued[i]) >= time.Minute {
+		i++
+	}
+	s.issued = s.issued[i:]
+
+	for key, expiresAt := range s.outstanding {
+		if !expiresAt.After(now) {
+			delete(s.outstanding, key)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package hashcache
+
+import (
+	"context"
+	"sync"
+)
+
+// Job is a handle of a solve running in the background
+type Job struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+	once   sync.Once
+	result ComputeResult
+	err    error
+}
+
+// ComputeAsync solves the header with ComputeWithPool in the background,
+// so that callers can fan out several solves and select over their Done
+// channels. Cancelling the job or ctx stops the solve.
+func ComputeAsync(ctx context.Context, h Header, opts ...PoolOption) *Job {
+	ctx, cancel := context.WithCancel(ctx)
+	job := newJob(cancel)
+
+	go func() {
+		job.finish(ComputeWithPool(ctx, h, opts...))
+	}()
+
+	return job
+}
+
+func newJob(cancel context.CancelFunc) *Job {
+	return &Job{done: make(chan struct{}), cancel: cancel}
+}
+
+// Done is closed once the result is available
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Result waits for the job to finish
+func (j *Job) Result() (ComputeResult, error) {
+	<-j.done
+	return j.result, j.err
+}
+
+// Cancel the job, Result returns the context error
+// unless the job is already done
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+func (j *Job) finish(result ComputeResult, err error) {
+	j.once.Do(func() {
+		j.result, j.err = result, err
+		j.cancel()
+		close(j.done)
+	})
+}
@@ -0,0 +1,191 @@
+package hashcache
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StampClaimName is the JWT claim carrying the StampClaim
+const StampClaimName = "pow"
+
+var (
+	ErrInvalidToken      = newError(CodeInvalidToken, "invalid token")
+	ErrMissingStampClaim = newError(CodeMissingStampClaim, "missing stamp claim")
+)
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// StampClaim embeds proof of work in a JWT. It carries either the whole
+// stamp, which is verified again, or only its digest and difficulty,
+// which are trusted on behalf of the token signature.
+type StampClaim struct {
+	Stamp    string `json:"stamp,omitempty"`
+	Digest   string `json:"digest,omitempty"`
+	ZeroBits uint8  `json:"bits"`
+
+	// Algorithm of the digest, DefaultAlgorithm when empty
+	Algorithm string `json:"alg,omitempty"`
+}
+
+func NewStampClaim(h Header) StampClaim {
+	return StampClaim{Stamp: h.String(), Digest: h.Hash(), ZeroBits: h.ZeroBits}
+}
+
+// NewDigestClaim embeds only the digest of the stamp, for tokens issued
+// after the stamp was verified by the issuer
+func NewDigestClaim(h Header) StampClaim {
+	return StampClaim{Digest: h.Hash(), ZeroBits: h.ZeroBits, Algorithm: h.Algorithm}
+}
+
+// VerifyClaim checks the claim against the verifier policy
+func (v *Verifier) VerifyClaim(c StampClaim) error {
+	if c.Stamp == "" {
+		if c.Digest == "" {
+			return ErrMissingStampClaim
+		}
+
+		return v.verifyDigestClaim(c)
+	}
+
+	h, err := parseWire(c.Stamp)
+	if err != nil {
+		return err
+	}
+
+	if c.Digest != "" && c.Digest != h.Hash() {
+		return fmt.Errorf("%w: digest does not match the stamp", ErrInvalidProof)
+	}
+
+	return v.Verify(h)
+}
+
+// verifyDigestClaim checks that the digest has the claimed zero bits,
+// which only the counter search proves by its digest
+func (v *Verifier) verifyDigestClaim(c StampClaim) error {
+	alg := c.Algorithm
+	if alg == "" {
+		alg = DefaultAlgorithm
+	}
+
+	p := v.Policy()
+	if _, ok := resolveWorkFunction(alg).(hashcashWork); !ok || !p.AcceptsAlgorithm(alg) {
+		return fmt.Errorf("%w: '%s'", ErrUnsupportedAlgorithm, alg)
+	}
+
+	if minBits := p.MinZeroBitsFor(alg); c.ZeroBits < minBits {
+		return fmt.Errorf("%w: got %d, want at least %d", ErrInsufficientBits, c.ZeroBits, minBits)
+	}
+
+	if len(c.Digest) != resolveHash(alg).Size()*2 || !verify(c.Digest, c.ZeroBits) {
+		return fmt.Errorf("%w: digest does not have the claimed zero bits", ErrInvalidProof)
+	}
+
+	return nil
+}
+
+// SignJWT sets the stamp claim and signs the claims with HS256
+func SignJWT(claims map[string]any, c StampClaim, key []byte) (string, error) {
+	withStamp := make(map[string]any, len(claims)+1)
+	for k, v := range claims {
+		withStamp[k] = v
+	}
+	withStamp[StampClaimName] = c
+
+	payload, err := json.Marshal(withStamp)
+	if err != nil {
+		return "", err
+	}
+
+	signed := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(jwtSignature(signed, key)), nil
+}
+
+// VerifyJWT validates the HS256 signature and the expiration of the token,
+// then verifies its stamp claim. The claims are returned once all checks pass.
+func (v *Verifier) VerifyJWT(token string, key []byte) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: expected 3 parts, got %d", ErrInvalidToken, len(parts))
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("%w: unsupported alg '%s'", ErrInvalidToken, header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+
+	if !hmac.Equal(sig, jwtSignature(parts[0]+"."+parts[1], key)) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+	}
+
+	var claims map[string]json.RawMessage
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	if raw, ok := claims["exp"]; ok {
+		var exp float64
+		if err := json.Unmarshal(raw, &exp); err != nil {
+			return nil, fmt.Errorf("%w: malformed exp", ErrInvalidToken)
+		}
+
+		if clock().After(time.Unix(int64(exp), 0).Add(v.Policy().MaxClockSkew)) {
+			return nil, fmt.Errorf("%w: token expired", ErrInvalidToken)
+		}
+	}
+
+	raw, ok := claims[StampClaimName]
+	if !ok {
+		return nil, ErrMissingStampClaim
+	}
+
+	var c StampClaim
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, fmt.Errorf("%w: malformed stamp claim", ErrInvalidToken)
+	}
+
+	if err := v.VerifyClaim(c); err != nil {
+		return nil, err
+	}
+
+	var out map[string]any
+	if err := decodeJWTPart(parts[1], &out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func jwtSignature(signed string, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+func decodeJWTPart(part string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("%w: malformed base64", ErrInvalidToken)
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%w: malformed json", ErrInvalidToken)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package hashcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifier_VerifyJWT(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	h, err := New("my.email@gmail.com", 2, time.Hour)
+	require.NoError(t, err)
+	h, err = Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+
+	key := []byte("secret")
+	v := NewVerifier(WithMinZeroBits(2))
+
+	t.Run("accepts a signed stamp claim", func(t *testing.T) {
+		token, err := SignJWT(map[string]any{"sub": "user"}, NewStampClaim(h), key)
+		require.NoError(t, err)
+
+		claims, err := v.VerifyJWT(token, key)
+		require.NoError(t, err)
+		assert.Equal(t, "user", claims["sub"])
+	})
+
+	t.Run("accepts a signed digest claim", func(t *testing.T) {
+		token, err := SignJWT(nil, NewDigestClaim(h), key)
+		require.NoError(t, err)
+
+		_, err = v.VerifyJWT(token, key)
+		require.NoError(t, err)
+
+		_, err = NewVerifier(WithMinZeroBits(3)).VerifyJWT(token, key)
+		assert.ErrorIs(t, err, ErrInsufficientBits)
+
+		_, err = NewVerifier(WithMinZeroBits(1), WithAlgorithmMinZeroBits(algSha256, 3)).VerifyJWT(token, key)
+		assert.ErrorIs(t, err, ErrInsufficientBits, "the minimum of the algorithm applies")
+	})
+
+	t.Run("rejects a digest without the claimed zero bits", func(t *testing.T) {
+		c := NewDigestClaim(h)
+		c.Digest = "f" + c.Digest[1:]
+		token, err := SignJWT(nil, c, key)
+		require.NoError(t, err)
+
+		_, err = v.VerifyJWT(token, key)
+		assert.ErrorIs(t, err, ErrInvalidProof)
+
+		c = NewDigestClaim(h)
+		c.Algorithm = algSeqSha256
+		token, err = SignJWT(nil, c, key)
+		require.NoError(t, err)
+
+		_, err = NewVerifier(WithAlgorithms(algSeqSha256)).VerifyJWT(token, key)
+		assert.ErrorIs(t, err, ErrUnsupportedAlgorithm, "only the counter search is proven by the digest")
+	})
+
+	t.Run("rejects a wrong signature", func(t *testing.T) {
+		token, err := SignJWT(nil, NewStampClaim(h), key)
+		require.NoError(t, err)
+
+		_, err = v.VerifyJWT(token, []byte("other"))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("rejects an expired token", func(t *testing.T) {
+		token, err := SignJWT(map[string]any{"exp": now.Add(-time.Second).Unix()}, NewStampClaim(h), key)
+		require.NoError(t, err)
+
+		_, err = v.VerifyJWT(token, key)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("rejects a stamp not matching the digest", func(t *testing.T) {
+		c := NewStampClaim(h)
+		c.Digest = "00"
+		token, err := SignJWT(nil, c, key)
+		require.NoError(t, err)
+
+		_, err = v.VerifyJWT(token, key)
+		assert.ErrorIs(t, err, ErrInvalidProof)
+	})
+}
@@ -0,0 +1,203 @@
+package hashcache
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSigningKeysEnv is the variable read by NewEnvKeyProvider
+const DefaultSigningKeysEnv = "HASHCASH_SIGNING_KEYS"
+
+var (
+	ErrUnknownKey = newError(CodeUnknownKey, "unknown signing key")
+	ErrInvalidKey = newError(CodeInvalidKey, "invalid signing key")
+)
+
+// SigningKey is an HMAC key, its ID is carried by the signed
+// challenges so that the key can be found after a rotation
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+// KeyProvider supplies the HMAC keys of signed challenges. New challenges
+// are signed with the current key, stamps are verified with any key Lookup
+// finds, so previous keys keep being accepted while they are provided.
+type KeyProvider interface {
+	Current(ctx context.Context) (SigningKey, error)
+	Lookup(ctx context.Context, id string) (SigningKey, error)
+}
+
+// StaticKeyProvider provides a fixed set of keys, the first is the current one
+type StaticKeyProvider struct {
+	keys []SigningKey
+}
+
+func NewStaticKeyProvider(current SigningKey, previous ...SigningKey) (*StaticKeyProvider, error) {
+	keys := append([]SigningKey{current}, previous...)
+	for _, k := range keys {
+		if err := validateKey(k); err != nil {
+			return nil, err
+		}
+	}
+
+	return &StaticKeyProvider{keys: keys}, nil
+}
+
+func (p *StaticKeyProvider) Current(context.Context) (SigningKey, error) {
+	return p.keys[0], nil
+}
+
+func (p *StaticKeyProvider) Lookup(_ context.Context, id string) (SigningKey, error) {
+	for _, k := range p.keys {
+		if k.ID == id {
+			return k, nil
+		}
+	}
+
+	return SigningKey{}, fmt.Errorf("%w: '%s'", ErrUnknownKey, id)
+}
+
+// NewEnvKeyProvider reads the keys from the variable formatted as
+// "id=base64secret,id=base64secret", the first key is the current one
+func NewEnvKeyProvider(name string) (*StaticKeyProvider, error) {
+	raw, ok := os.LookupEnv(name)
+	if !ok || raw == "" {
+		return nil, fmt.Errorf("%w: %s is not set", ErrInvalidKey, name)
+	}
+
+	var keys []SigningKey
+	for _, item := range strings.Split(raw, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: expected id=secret in %s", ErrInvalidKey, name)
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(secret)
+		if err != nil {
+			return nil, fmt.Errorf("%w: secret of '%s' is not base64", ErrInvalidKey, id)
+		}
+
+		keys = append(keys, SigningKey{ID: id, Secret: decoded})
+	}
+
+	return NewStaticKeyProvider(keys[0], keys[1:]...)
+}
+
+// SecretFetcher reads a secret by name, it is implemented by thin
+// wrappers of the secret manager clients, e.g. AWS Secrets Manager,
+// GCP Secret Manager or Vault
+type SecretFetcher interface {
+	FetchSecret(ctx context.Context, name string) ([]byte, error)
+}
+
+// secretKeys is the JSON layout of the secret
+type secretKeys struct {
+	Current string            `json:"current"`
+	Keys    map[string][]byte `json:"keys"`
+}
+
+// SecretManagerKeyProvider loads the keys from a secret holding
+//
+//	{"current": "k2", "keys": {"k2": "base64secret", "k1": "base64secret"}}
+//
+// and reloads it once the refresh interval passes, so that the keys
+// are rotated by updating the secret without redeploying.
+type SecretManagerKeyProvider struct {
+	fetcher SecretFetcher
+	name    string
+	refresh time.Duration
+
+	mu       sync.Mutex
+	keys     *StaticKeyProvider
+	loadedAt time.Time
+}
+
+func NewSecretManagerKeyProvider(fetcher SecretFetcher, name string, refresh time.Duration) *SecretManagerKeyProvider {
+	return &SecretManagerKeyProvider{fetcher: fetcher, name: name, refresh: refresh}
+}
+
+func (p *SecretManagerKeyProvider) Current(ctx context.Context) (SigningKey, error) {
+	keys, err := p.load(ctx)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	return keys.Current(ctx)
+}
+
+func (p *SecretManagerKeyProvider) Lookup(ctx context.Context, id string) (SigningKey, error) {
+	keys, err := p.load(ctx)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	return keys.Lookup(ctx, id)
+}
+
+// load returns the cached keys, keeping them when the reload fails
+func (p *SecretManagerKeyProvider) load(ctx context.Context) (*StaticKeyProvider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil && clock().Sub(p.loadedAt) < p.refresh {
+		return p.keys, nil
+	}
+
+	keys, err := p.fetch(ctx)
+	if err != nil {
+		if p.keys != nil {
+			return p.keys, nil
+		}
+		return nil, err
+	}
+
+	p.keys, p.loadedAt = keys, clock()
+	return keys, nil
+}
+
+func (p *SecretManagerKeyProvider) fetch(ctx context.Context) (*StaticKeyProvider, error) {
+	raw, err := p.fetcher.FetchSecret(ctx, p.name)
+	if err != nil {
+		return nil, err
+	}
+
+	var secret secretKeys
+	if err := json.Unmarshal(raw, &secret); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+
+	current, ok := secret.Keys[secret.Current]
+	if !ok {
+		return nil, fmt.Errorf("%w: current key '%s' is missing", ErrInvalidKey, secret.Current)
+	}
+
+	var previous []SigningKey
+	for id, key := range secret.Keys {
+		if id != secret.Current {
+			previous = append(previous, SigningKey{ID: id, Secret: key})
+		}
+	}
+
+	return NewStaticKeyProvider(SigningKey{ID: secret.Current, Secret: current}, previous...)
+}
+
+// validateKey rejects the IDs which can not be carried by the header
+// extension and empty secrets
+func validateKey(k SigningKey) error {
+	if k.ID == "" || strings.ContainsAny(k.ID, ":.") {
+		return fmt.Errorf("%w: id '%s' must be non empty without ':' and '.'", ErrInvalidKey, k.ID)
+	}
+
+	if len(k.Secret) == 0 {
+		return fmt.Errorf("%w: empty secret of '%s'", ErrInvalidKey, k.ID)
+	}
+
+	return nil
+}
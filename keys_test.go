@@ -0,0 +1,78 @@
+package hashcache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSecretFetcher struct {
+	secret string
+	err    error
+	calls  int
+}
+
+func (f *fakeSecretFetcher) FetchSecret(context.Context, string) ([]byte, error) {
+	f.calls++
+	return []byte(f.secret), f.err
+}
+
+func TestNewEnvKeyProvider(t *testing.T) {
+	t.Setenv(DefaultSigningKeysEnv, "k2=c2Vjb25k,k1=Zmlyc3Q=")
+
+	p, err := NewEnvKeyProvider(DefaultSigningKeysEnv)
+	require.NoError(t, err)
+
+	current, err := p.Current(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, SigningKey{ID: "k2", Secret: []byte("second")}, current)
+
+	previous, err := p.Lookup(context.Background(), "k1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("first"), previous.Secret)
+
+	_, err = p.Lookup(context.Background(), "k0")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	t.Setenv(DefaultSigningKeysEnv, "bad.id=c2Vjb25k")
+	_, err = NewEnvKeyProvider(DefaultSigningKeysEnv)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestSecretManagerKeyProvider(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	fetcher := &fakeSecretFetcher{secret: `{"current": "k1", "keys": {"k1": "Zmlyc3Q="}}`}
+	keys := NewSecretManagerKeyProvider(fetcher, "hashcash", time.Minute)
+	m := NewMiddleware(WithMiddlewareVerifier(NewVerifier(WithMinZeroBits(1))), WithChallengeKeys(keys))
+
+	challenge, err := m.issueChallenge(context.Background(), "", "example.com", 1)
+	require.NoError(t, err)
+	h, err := Compute(context.Background(), challenge, 0)
+	require.NoError(t, err)
+	require.NoError(t, m.checkChallengeSignature(context.Background(), h))
+
+	// rotated keys are picked up after the refresh interval
+	fetcher.secret = `{"current": "k2", "keys": {"k2": "c2Vjb25k", "k1": "Zmlyc3Q="}}`
+	now = now.Add(time.Minute)
+
+	current, err := keys.Current(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "k2", current.ID)
+	require.NoError(t, m.checkChallengeSignature(context.Background(), h))
+
+	// failed reloads keep the loaded keys
+	fetcher.err = errors.New("unavailable")
+	now = now.Add(time.Minute)
+	require.NoError(t, m.checkChallengeSignature(context.Background(), h))
+	assert.Equal(t, 3, fetcher.calls)
+
+	fetcher.secret, fetcher.err = `{"current": "k2", "keys": {"k2": "c2Vjb25k"}}`, nil
+	now = now.Add(time.Minute)
+	assert.ErrorIs(t, m.checkChallengeSignature(context.Background(), h), ErrInvalidChallengeSignature)
+}
@@ -0,0 +1,171 @@
+package hashcache
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// StampKeystore keeps the stamps pre-minted by a client until they are
+// used, see WithKeystore
+type StampKeystore interface {
+	// Put stores the solved stamp
+	Put(ctx context.Context, h Header) error
+
+	// Take removes and returns an unexpired stamp of the resource
+	// with at least the zero bits, reporting whether there was one
+	Take(ctx context.Context, resource string, zeroBits uint8) (Header, bool, error)
+}
+
+// FileKeystore is a StampKeystore persisting the stamps to a file, one
+// per line, so that pre-minted stamps survive the restarts of the app.
+// The file is rewritten atomically on every change, which suits the
+// handful of stamps a client keeps ahead of time.
+type FileKeystore struct {
+	mu     sync.Mutex
+	path   string
+	stamps []Header
+}
+
+// OpenFileKeystore loads the stamps of the file, dropping the expired
+// and unparsable ones, a missing file being an empty keystore
+func OpenFileKeystore(path string) (*FileKeystore, error) {
+	ks := &FileKeystore{path: path}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	now := clock().UnixNano()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h, err := Parse(scanner.Text())
+		if err != nil || h.Expiration <= now {
+			continue
+		}
+
+		ks.stamps = append(ks.stamps, h)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+func (ks *FileKeystore) Put(_ context.Context, h Header) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.evict()
+	stamps := append(slices.Clip(ks.stamps), h)
+	if err := ks.save(stamps); err != nil {
+		return err
+	}
+
+	ks.stamps = stamps
+	return nil
+}
+
+// Take returns the stamp expiring first, so that the others last
+func (ks *FileKeystore) Take(_ context.Context, resource string, zeroBits uint8) (Header, bool, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.evict()
+
+	found := -1
+	for i, h := range ks.stamps {
+		if h.ZeroBits < zeroBits {
+			continue
+		}
+
+		// the stamps minted by New keep the resource encoded
+		if raw, err := h.rawResource(); err != nil || raw != resource {
+			continue
+		}
+
+		if found < 0 || h.Expiration < ks.stamps[found].Expiration {
+			found = i
+		}
+	}
+
+	if found < 0 {
+		return Header{}, false, nil
+	}
+
+	// the stamp is kept unless the keystore without it is saved
+	stamps := slices.Delete(slices.Clone(ks.stamps), found, found+1)
+	if err := ks.save(stamps); err != nil {
+		return Header{}, false, err
+	}
+
+	h := ks.stamps[found]
+	ks.stamps = stamps
+	return h, true, nil
+}
+
+// Len is the number of unexpired stamps
+func (ks *FileKeystore) Len() int {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.evict()
+	return len(ks.stamps)
+}
+
+// evict the expired stamps, compacting them in place
+func (ks *FileKeystore) evict() {
+	now := clock().UnixNano()
+
+	kept := ks.stamps[:0]
+	for _, h := range ks.stamps {
+		if h.Expiration > now {
+			kept = append(kept, h)
+		}
+	}
+
+	clear(ks.stamps[len(kept):])
+	ks.stamps = kept
+}
+
+// save the stamps to a temporary file synced and renamed over
+// the keystore, so that a crash never leaves it half written
+func (ks *FileKeystore) save(stamps []Header) error {
+	tmp, err := os.CreateTemp(filepath.Dir(ks.path), filepath.Base(ks.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for _, h := range stamps {
+		_, _ = w.WriteString(h.String())
+		_ = w.WriteByte('\n')
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), ks.path)
+}
@@ -0,0 +1,197 @@
+package hashcache
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInsufficientBalance = newError(CodeInsufficientBalance, "insufficient balance")
+	ErrInvalidAmount       = newError(CodeInvalidAmount, "invalid amount")
+)
+
+// LedgerEntry is the balance of a client as of UpdatedAt,
+// before any decay since then has been applied.
+type LedgerEntry struct {
+	Balance   float64
+	UpdatedAt time.Time
+}
+
+// LedgerStore persists ledger entries by client key
+type LedgerStore interface {
+	Load(key string) (LedgerEntry, bool, error)
+	Save(key string, entry LedgerEntry) error
+}
+
+// OverProofBonus rewards the stamps the digest of which has more zero bits
+// than required, e.g. solved ahead of time at a higher difficulty during
+// the off-peak hours
+type OverProofBonus struct {
+	// Required zero bits, the bonus is earned by the digest zero bits above
+	Required uint8
+
+	// PerZeroBit is the share of the credit added per zero bit of excess,
+	// e.g. 0.5 credits a stamp two zero bits over the requirement twice
+	PerZeroBit float64
+
+	// OffPeak tells whether the bonus applies at the time of the credit,
+	// nil meaning always
+	OffPeak func(time.Time) bool
+}
+
+// multiplier of the credit of the verified header at the time
+func (b OverProofBonus) multiplier(h Header, now time.Time) float64 {
+	if b.OffPeak != nil && !b.OffPeak(now) {
+		return 1
+	}
+
+	achieved := digestZeroBits(h)
+	if achieved <= b.Required {
+		return 1
+	}
+
+	return 1 + b.PerZeroBit*float64(achieved-b.Required)
+}
+
+type LedgerConfig struct {
+	// Bonus of the over-proved stamps, see WithOverProofBonus
+	Bonus *OverProofBonus
+}
+
+type LedgerOption func(*LedgerConfig)
+
+// WithOverProofBonus credits the stamps exceeding the required difficulty
+// more. The credit stays the expected work of the claimed zero bits, the
+// bonus multiplies it linearly in the excess of the digest, so that the
+// lucky digests do not inflate the balances exponentially.
+func WithOverProofBonus(b OverProofBonus) LedgerOption {
+	return func(cfg *LedgerConfig) {
+		cfg.Bonus = &b
+	}
+}
+
+// Ledger keeps a running balance of accepted work per client key,
+// so that a client can pay once with a big stamp and spend the credit
+// over a number of requests. Balances decay exponentially with the
+// configured half-life, a zero half-life disables decay.
+type Ledger struct {
+	mu       sync.Mutex
+	store    LedgerStore
+	halfLife time.Duration
+	cfg      LedgerConfig
+}
+
+func NewLedger(store LedgerStore, halfLife time.Duration, opts ...LedgerOption) *Ledger {
+	var cfg LedgerConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &Ledger{store: store, halfLife: halfLife, cfg: cfg}
+}
+
+// Credit adds the expected work of the verified header to the client
+// balance and returns the new balance
+func (l *Ledger) Credit(key string, h Header) (float64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := clock()
+	balance, err := l.balance(key, now)
+	if err != nil {
+		return 0, err
+	}
+
+	credit := expectedHashes(h.ZeroBits)
+	if l.cfg.Bonus != nil {
+		credit *= l.cfg.Bonus.multiplier(h, now)
+	}
+
+	balance += credit
+	if err := l.store.Save(key, LedgerEntry{Balance: balance, UpdatedAt: now}); err != nil {
+		return 0, err
+	}
+
+	return balance, nil
+}
+
+// Balance of the client with decay applied
+func (l *Ledger) Balance(key string) (float64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.balance(key, clock())
+}
+
+// Spend withdraws the amount from the client balance or fails with
+// ErrInsufficientBalance leaving the balance untouched.
+func (l *Ledger) Spend(key string, amount float64) error {
+	if amount < 0 || math.IsNaN(amount) {
+		return ErrInvalidAmount
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := clock()
+	balance, err := l.balance(key, now)
+	if err != nil {
+		return err
+	}
+
+	if balance < amount {
+		return ErrInsufficientBalance
+	}
+
+	return l.store.Save(key, LedgerEntry{Balance: balance - amount, UpdatedAt: now})
+}
+
+func (l *Ledger) balance(key string, now time.Time) (float64, error) {
+	entry, ok, err := l.store.Load(key)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	if l.halfLife <= 0 {
+		return entry.Balance, nil
+	}
+
+	elapsed := now.Sub(entry.UpdatedAt)
+	if elapsed <= 0 {
+		return entry.Balance, nil
+	}
+
+	return entry.Balance * math.Pow(0.5, float64(elapsed)/float64(l.halfLife)), nil
+}
+
+// expectedHashes is the average number of hashes needed
+// to find a digest with the given number of leading zero hex digits
+func expectedHashes(zeroBits uint8) float64 {
+	return math.Pow(16, float64(zeroBits))
+}
+
+type MemoryLedgerStore struct {
+	mu      sync.RWMutex
+	entries map[string]LedgerEntry
+}
+
+func NewMemoryLedgerStore() *MemoryLedgerStore {
+	return &MemoryLedgerStore{entries: make(map[string]LedgerEntry)}
+}
+
+func (s *MemoryLedgerStore) Load(key string) (LedgerEntry, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, ok := s.entries[key]
+	return entry, ok, nil
+}
+
+func (s *MemoryLedgerStore) Save(key string, entry LedgerEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = entry
+	return nil
+}
@@ -0,0 +1,32 @@
+package hashcache
+
+import (
+	"context"
+	"errors"
+)
+
+// Closer is implemented by the components running goroutines, e.g. the
+// Miner and the MemoryStore janitor. Close stops accepting new work, waits
+// for the work in flight until the context is done and stops the goroutines.
+// Components without goroutines, like the DifficultyController,
+// need no closing.
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+// CloseAll closes the components in order, sharing the context deadline
+// between them, and returns the joined errors
+func CloseAll(ctx context.Context, closers ...Closer) error {
+	var errs []error
+	for _, c := range closers {
+		if c == nil {
+			continue
+		}
+
+		if err := c.Close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
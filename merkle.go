@@ -0,0 +1,130 @@
+package hashcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+)
+
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+var ErrEmptyBatch = newError(CodeEmptyBatch, "empty batch")
+
+// MerkleStep is a sibling hash on the path from a leaf to the root,
+// Left tells whether the sibling is the left operand of the parent hash.
+type MerkleStep struct {
+	Hash []byte
+	Left bool
+}
+
+// MerkleProof proves inclusion of a single stamp in a MerkleBatch
+type MerkleProof struct {
+	Index int
+	Steps []MerkleStep
+}
+
+// MerkleBatch commits many stamps into a single root, so that the receiver
+// can either verify all of them by recomputing the root or spot-check
+// a sample of them with the compact inclusion proofs.
+type MerkleBatch struct {
+	Root   []byte
+	Proofs []MerkleProof
+}
+
+func NewMerkleBatch(headers []Header) (MerkleBatch, error) {
+	if len(headers) == 0 {
+		return MerkleBatch{}, ErrEmptyBatch
+	}
+
+	level := make([][]byte, len(headers))
+	for i, h := range headers {
+		level[i] = merkleLeaf(h)
+	}
+
+	proofs := make([]MerkleProof, len(headers))
+	// positions of every leaf in the current level
+	positions := make([]int, len(headers))
+	for i := range headers {
+		proofs[i].Index = i
+		positions[i] = i
+	}
+
+	for len(level) > 1 {
+		for i, pos := range positions {
+			sibling := pos ^ 1
+			if sibling < len(level) {
+				proofs[i].Steps = append(proofs[i].Steps, MerkleStep{Hash: level[sibling], Left: sibling < pos})
+			}
+			positions[i] = pos / 2
+		}
+
+		level = merkleLevelUp(level)
+	}
+
+	return MerkleBatch{Root: level[0], Proofs: proofs}, nil
+}
+
+// MerkleRoot of the headers, in the order given
+func MerkleRoot(headers []Header) ([]byte, error) {
+	if len(headers) == 0 {
+		return nil, ErrEmptyBatch
+	}
+
+	level := make([][]byte, len(headers))
+	for i, h := range headers {
+		level[i] = merkleLeaf(h)
+	}
+
+	for len(level) > 1 {
+		level = merkleLevelUp(level)
+	}
+
+	return level[0], nil
+}
+
+// VerifyInclusion checks that the header is committed in the root.
+// It does not check the proof of work of the header itself.
+func VerifyInclusion(root []byte, h Header, proof MerkleProof) bool {
+	sum := merkleLeaf(h)
+	for _, step := range proof.Steps {
+		if step.Left {
+			sum = merkleNode(step.Hash, sum)
+		} else {
+			sum = merkleNode(sum, step.Hash)
+		}
+	}
+
+	return bytes.Equal(sum, root)
+}
+
+// merkleLevelUp hashes pairs of nodes, the odd node out is promoted as is
+func merkleLevelUp(level [][]byte) [][]byte {
+	next := make([][]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 == len(level) {
+			next = append(next, level[i])
+			continue
+		}
+
+		next = append(next, merkleNode(level[i], level[i+1]))
+	}
+
+	return next
+}
+
+func merkleLeaf(h Header) []byte {
+	sum := sha256.Sum256(append([]byte{merkleLeafPrefix}, h.String()...))
+	return sum[:]
+}
+
+func merkleNode(left, right []byte) []byte {
+	buf := make([]byte, 0, 1+len(left)+len(right))
+	buf = append(buf, merkleNodePrefix)
+	buf = append(buf, left...)
+	buf = append(buf, right...)
+
+	sum := sha256.Sum256(buf)
+	return sum[:]
+}
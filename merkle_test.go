@@ -0,0 +1,41 @@
+package hashcache
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerkleBatch(t *testing.T) {
+	t.Parallel()
+
+	for _, n := range []int{1, 2, 5, 8} {
+		t.Run(fmt.Sprintf("%d headers", n), func(t *testing.T) {
+			headers := make([]Header, n)
+			for i := range headers {
+				headers[i] = Header{Ver: 1, ZeroBits: 3, Resource: fmt.Sprintf("rcpt-%d", i), Algorithm: algSha256}
+			}
+
+			batch, err := NewMerkleBatch(headers)
+			require.NoError(t, err)
+
+			root, err := MerkleRoot(headers)
+			require.NoError(t, err)
+			assert.Equal(t, root, batch.Root)
+
+			for i, h := range headers {
+				assert.True(t, VerifyInclusion(batch.Root, h, batch.Proofs[i]), "header %d", i)
+
+				h.Counter++
+				assert.False(t, VerifyInclusion(batch.Root, h, batch.Proofs[i]), "tampered header %d", i)
+			}
+		})
+	}
+
+	t.Run("empty batch", func(t *testing.T) {
+		_, err := NewMerkleBatch(nil)
+		assert.ErrorIs(t, err, ErrEmptyBatch)
+	})
+}
@@ -0,0 +1,469 @@
+package hashcache
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrMissingStamp = newError(CodeMissingStamp, "missing stamp")
+	ErrClientBanned = newError(CodeBanned, "client banned")
+)
+
+const (
+	DefaultStampHeader     = "X-Hashcash"
+	DefaultChallengeHeader = "X-Hashcash-Challenge"
+
+	defaultChallengeTTL = time.Minute
+)
+
+type MiddlewareConfig struct {
+	Verifier        *Verifier
+	Escalation      EscalationPolicy
+	Reputation      ReputationProvider
+	StampHeader     string
+	ChallengeHeader string
+
+	// Challenge issued to rejected clients,
+	// its zero bits are set by the escalation policy
+	Challenge ChallengeTemplate
+
+	// ClientKey identifies the client, defaults to the remote IP address
+	ClientKey func(r *http.Request) string
+
+	// Resource the stamps of the request must be minted for,
+	// defaults to the request host
+	Resource func(r *http.Request) string
+
+	// ChallengeKeys sign the issued challenges when set
+	ChallengeKeys KeyProvider
+
+	// Tenant of the request, the verifier applies its policy
+	Tenant func(r *http.Request) string
+
+	// BindBody requires the stamps to be bound to the request body
+	// read up to MaxBodyBytes, see WithBodyBinding
+	BindBody     bool
+	MaxBodyBytes int64
+
+	// BindRequest binds the resource to the method and the path
+	// of the request, see WithRequestBinding
+	BindRequest bool
+
+	// IssueLimiter caps the challenges issued per client, see WithIssueLimits
+	IssueLimiter *IssueLimiter
+
+	// Endpoints raise the difficulty of the matching requests,
+	// see WithEndpointRoutes
+	Endpoints *EndpointRoutes
+
+	// Shadow evaluates the stamps without enforcing them, see WithShadowMode
+	Shadow bool
+
+	// ChallengeQueue of the pre-generated challenges, see WithChallengeQueue
+	ChallengeQueue *ChallengeQueue
+
+	// CostHeaders report the cost of the accepted stamps, see WithCostHeaders
+	CostHeaders bool
+}
+
+type MiddlewareOption func(*MiddlewareConfig)
+
+// Middleware guards an HTTP handler with proof of work. Requests without
+// a valid stamp are rejected with a fresh challenge in the challenge header,
+// the difficulty of which is set by the escalation policy.
+type Middleware struct {
+	cfg MiddlewareConfig
+}
+
+func NewMiddleware(opts ...MiddlewareOption) *Middleware {
+	cfg := MiddlewareConfig{
+		StampHeader:     DefaultStampHeader,
+		ChallengeHeader: DefaultChallengeHeader,
+		Challenge:       ChallengeTemplate{TTL: defaultChallengeTTL},
+		ClientKey:       remoteIP,
+		Resource:        func(r *http.Request) string { return r.Host },
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.Verifier == nil {
+		cfg.Verifier = NewVerifier()
+	}
+
+	if cfg.Escalation == nil {
+		cfg.Escalation = policyEscalation{cfg.Verifier}
+	}
+
+	if cfg.Reputation != nil {
+		cfg.Escalation = NewReputationEscalation(cfg.Escalation, cfg.Reputation)
+	}
+
+	if cfg.BindRequest {
+		cfg.Resource = requestResource(cfg.Resource)
+	}
+
+	return &Middleware{cfg: cfg}
+}
+
+func WithMiddlewareVerifier(v *Verifier) MiddlewareOption {
+	return func(cfg *MiddlewareConfig) {
+		cfg.Verifier = v
+	}
+}
+
+func WithEscalation(p EscalationPolicy) MiddlewareOption {
+	return func(cfg *MiddlewareConfig) {
+		cfg.Escalation = p
+	}
+}
+
+// WithReputationProvider adjusts the escalation policy
+// by the reputation of the clients
+func WithReputationProvider(p ReputationProvider) MiddlewareOption {
+	return func(cfg *MiddlewareConfig) {
+		cfg.Reputation = p
+	}
+}
+
+func WithClientKeyFunc(fn func(r *http.Request) string) MiddlewareOption {
+	return func(cfg *MiddlewareConfig) {
+		cfg.ClientKey = fn
+	}
+}
+
+func WithResourceFunc(fn func(r *http.Request) string) MiddlewareOption {
+	return func(cfg *MiddlewareConfig) {
+		cfg.Resource = fn
+	}
+}
+
+// WithTenantFunc verifies the requests under the policy
+// and the spent stamp namespace of their tenant
+func WithTenantFunc(fn func(r *http.Request) string) MiddlewareOption {
+	return func(cfg *MiddlewareConfig) {
+		cfg.Tenant = fn
+	}
+}
+
+func WithChallengeTTL(ttl time.Duration) MiddlewareOption {
+	return func(cfg *MiddlewareConfig) {
+		cfg.Challenge.TTL = ttl
+	}
+}
+
+func WithChallengeTemplate(t ChallengeTemplate) MiddlewareOption {
+	return func(cfg *MiddlewareConfig) {
+		cfg.Challenge = t
+	}
+}
+
+// Handler wraps the next handler, it is the chi middleware as is:
+//
+//	r := chi.NewRouter()
+//	r.Use(m.Handler)
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r, ok := m.Allow(w, r); ok {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// Allow reports whether the request carries a valid stamp and returns
+// the request with the VerifiedStamp in its context, otherwise it writes
+// the rejection to w. It is the building block of adapters to routers
+// which do not use net/http middlewares, e.g. for gin:
+//
+//	func(c *gin.Context) {
+//		r, ok := m.Allow(c.Writer, c.Request)
+//		if !ok {
+//			c.Abort()
+//			return
+//		}
+//		c.Request = r
+//		c.Next()
+//	}
+//
+// and for echo:
+//
+//	func(next echo.HandlerFunc) echo.HandlerFunc {
+//		return func(c echo.Context) error {
+//			r, ok := m.Allow(c.Response(), c.Request())
+//			if !ok {
+//				return nil
+//			}
+//			c.SetRequest(r)
+//			return next(c)
+//		}
+//	}
+//
+// Fiber is not based on net/http, its adaptor.HTTPMiddleware(m.Handler)
+// converts the middleware. The module does not depend on the frameworks,
+// so the glue above is left to the applications.
+func (m *Middleware) Allow(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	r = m.withTenant(r)
+	if m.cfg.Shadow {
+		r = r.WithContext(context.WithValue(r.Context(), shadowContextKey{}, true))
+	}
+
+	clientKey := m.cfg.ClientKey(r)
+	resource := m.cfg.Resource(r)
+
+	esc := m.required(r, clientKey)
+	if esc.Waived {
+		return r, true
+	}
+
+	if esc.Banned {
+		if m.cfg.Shadow {
+			return shadowPass(r, ErrClientBanned), true
+		}
+		m.ban(w, esc)
+		return r, false
+	}
+
+	var digest string
+	if m.cfg.BindBody {
+		var err error
+		if digest, err = DigestBody(r, m.cfg.MaxBodyBytes); err != nil {
+			if m.cfg.Shadow {
+				return shadowPass(r, err), true
+			}
+			m.rejectBody(w, err)
+			return r, false
+		}
+	}
+
+	h, err := m.verifyRequest(r, clientKey, resource, digest, esc.ZeroBits)
+	if err != nil {
+		m.cfg.Escalation.Failure(clientKey)
+		if m.cfg.Shadow {
+			return shadowPass(r, err), true
+		}
+		if m.cfg.BindBody {
+			resource = BindBody(resource, digest)
+		}
+		m.challenge(w, r, clientKey, resource, err)
+		return r, false
+	}
+
+	m.cfg.Escalation.Success(clientKey)
+	if m.cfg.IssueLimiter != nil {
+		m.cfg.IssueLimiter.Redeem(clientKey, h)
+	}
+
+	if hist := m.cfg.Verifier.cfg.Histogram; hist != nil {
+		hist.observeSolveTime(r)
+	}
+
+	if m.cfg.CostHeaders {
+		m.writeCostHeaders(w, r, clientKey, h)
+	}
+
+	stamp := VerifiedStamp{
+		Header:           h,
+		RequiredZeroBits: esc.ZeroBits,
+		Score:            defaultScorer.scoreVerified(h, clock()),
+		Grade:            gradeZeroBits(h, esc.ZeroBits),
+	}
+	return r.WithContext(ContextWithStamp(r.Context(), stamp)), true
+}
+
+func (m *Middleware) verifyRequest(r *http.Request, clientKey, resource, digest string, zeroBits uint8) (Header, error) {
+	start := time.Now()
+	h, err := m.precheck(r, resource, digest, zeroBits)
+	if err != nil {
+		m.cfg.Verifier.audit(r.Context(), start, clientKey, h, err)
+		return Header{}, err
+	}
+
+	// the verified header carries its digest, the proof is not checked again
+	return m.cfg.Verifier.verifyAudited(r.Context(), clientKey, h)
+}
+
+// precheck parses the stamp of the request and checks
+// the requirements specific to the request
+func (m *Middleware) precheck(r *http.Request, resource, digest string, zeroBits uint8) (Header, error) {
+	raw := r.Header.Get(m.cfg.StampHeader)
+	if raw == "" {
+		return Header{}, ErrMissingStamp
+	}
+
+	// sheds the obviously bad stamps before decoding and hashing them
+	p := m.cfg.Verifier.policyFor(TenantFromContext(r.Context()))
+	if err := p.prevalidate(raw, zeroBits, m.cfg.Verifier.cfg.ResourceNormalizer); err != nil {
+		return Header{}, err
+	}
+
+	h, err := parseWire(raw)
+	if err != nil {
+		return Header{}, err
+	}
+
+	stampResource, err := h.rawResource()
+	if err != nil {
+		return h, err
+	}
+
+	if m.cfg.BindBody {
+		if resource, err = bodyResource(h, resource, digest); err != nil {
+			return h, err
+		}
+	}
+
+	if err := m.cfg.Verifier.MatchResource(stampResource, resource); err != nil {
+		return h, err
+	}
+
+	if h.ZeroBits < zeroBits {
+		return h, fmt.Errorf("%w: got %d, want at least %d", ErrInsufficientBits, h.ZeroBits, zeroBits)
+	}
+
+	return h, m.checkChallengeSignature(r.Context(), h)
+}
+
+// challenge rejects the request with a challenge sized
+// for the next attempt of the client
+func (m *Middleware) challenge(w http.ResponseWriter, r *http.Request, clientKey, resource string, reason error) {
+	esc := m.required(r, clientKey)
+	if esc.Banned {
+		m.ban(w, esc)
+		return
+	}
+
+	h, err := m.issueChallenge(r.Context(), clientKey, resource, esc.ZeroBits)
+	if err != nil {
+		m.rejectIssue(w, err)
+		return
+	}
+
+	p := newProblem(http.StatusForbidden, problemCode(reason), reason)
+	p.RequiredZeroBits = esc.ZeroBits
+	p.Challenge = h.String()
+
+	w.Header().Set(m.cfg.ChallengeHeader, p.Challenge)
+	writeProblem(w, p)
+}
+
+func (m *Middleware) withTenant(r *http.Request) *http.Request {
+	if m.cfg.Tenant == nil {
+		return r
+	}
+
+	return r.WithContext(ContextWithTenant(r.Context(), m.cfg.Tenant(r)))
+}
+
+// required is the escalation of the client raised to the minimum
+// of the tenant policy for the algorithm of the challenges, to the
+// difficulty of the endpoint of the request and to a single bit since
+// New does not mint challenges without work
+func (m *Middleware) required(r *http.Request, clientKey string) Escalation {
+	esc := m.cfg.Escalation.Required(clientKey)
+	if esc.Waived {
+		return esc
+	}
+
+	if m.cfg.Endpoints != nil {
+		if zeroBits, ok := m.cfg.Endpoints.Match(r.Method, r.URL.Path); ok {
+			esc.ZeroBits = max(esc.ZeroBits, zeroBits)
+		}
+	}
+
+	alg := m.cfg.Challenge.Algorithm
+	if alg == "" {
+		alg = DefaultAlgorithm
+	}
+
+	p := m.cfg.Verifier.policyFor(TenantFromContext(r.Context()))
+	esc.ZeroBits = max(esc.ZeroBits, p.MinZeroBitsFor(alg))
+
+	esc.ZeroBits = max(esc.ZeroBits, 1)
+	return esc
+}
+
+// rejectBody rejects the request the body of which can not be digested
+func (m *Middleware) rejectBody(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrBodyTooLarge) {
+		writeProblem(w, newProblem(http.StatusRequestEntityTooLarge, "body_too_large", err))
+		return
+	}
+
+	writeProblem(w, newProblem(http.StatusBadRequest, "unreadable_body", err))
+}
+
+// rejectIssue rejects the request a challenge can not be issued for
+func (m *Middleware) rejectIssue(w http.ResponseWriter, err error) {
+	var limited *IssueLimitError
+	if errors.As(err, &limited) {
+		p := newProblem(http.StatusTooManyRequests, "issue_limited", err)
+		p.RetryAfter = retryAfterSeconds(limited.RetryAfter)
+		writeProblem(w, p)
+		return
+	}
+
+	writeProblem(w, newProblem(http.StatusInternalServerError, "challenge_failed", nil))
+}
+
+// ban rejects the request of a banned client
+func (m *Middleware) ban(w http.ResponseWriter, esc Escalation) {
+	p := newProblem(http.StatusTooManyRequests, "banned", nil)
+	p.RetryAfter = retryAfterSeconds(esc.RetryAfter)
+	writeProblem(w, p)
+}
+
+// SolveChallenge computes the work for a challenge issued by the middleware
+// and returns the stamp to send back in the stamp header. The hints of
+// the challenge are honored, see ChallengeHints.
+func SolveChallenge(ctx context.Context, challenge string, maxIterations int) (string, error) {
+	h, err := parseWire(challenge)
+	if err != nil {
+		return "", err
+	}
+
+	solved, err := solveHinted(ctx, h, maxIterations)
+	if err != nil {
+		return "", err
+	}
+
+	return solved.String(), nil
+}
+
+// parseWire parses a header string into the form produced by New
+// which keeps the resource base64 encoded, so that String gives back
+// the string that was received and hashed by the other side.
+func parseWire(raw string) (Header, error) {
+	h, err := Parse(raw)
+	if err != nil {
+		return Header{}, err
+	}
+
+	if h.decoded {
+		h.Resource = base64.StdEncoding.EncodeToString([]byte(h.Resource))
+		h.decoded = false
+		h.raw.of = h.fields()
+	}
+
+	return h, nil
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func retryAfterSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,711 @@
+package hashcache
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware_Escalation(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	m := NewMiddleware(WithEscalation(NewLadderEscalation([]uint8{1, 2}, time.Minute)))
+	var verified VerifiedStamp
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verified, _ = StampFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(stamp string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if stamp != "" {
+			req.Header.Set(DefaultStampHeader, stamp)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	challenge, err := parseWire(rec.Header().Get(DefaultChallengeHeader))
+	require.NoError(t, err)
+	assert.Equal(t, uint8(2), challenge.ZeroBits)
+
+	var problem Problem
+	assert.Equal(t, problemContentType, rec.Header().Get("Content-Type"))
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&problem))
+	assert.Equal(t, "missing_stamp", problem.Code)
+	assert.Equal(t, uint8(2), problem.RequiredZeroBits)
+	assert.Equal(t, rec.Header().Get(DefaultChallengeHeader), problem.Challenge)
+
+	rec = do("garbage")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&problem))
+	assert.Equal(t, "banned", problem.Code)
+	assert.Equal(t, 60, problem.RetryAfter)
+
+	now = now.Add(time.Minute)
+	rec = do("")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	stamp, err := SolveChallenge(context.Background(), rec.Header().Get(DefaultChallengeHeader), 0)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, do(stamp).Code)
+	assert.Equal(t, stamp, verified.Header.String())
+	assert.Equal(t, uint8(2), verified.RequiredZeroBits)
+	assert.Positive(t, verified.Score)
+}
+
+func TestRampEscalation(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	store := NewMemoryRampStore()
+	ramp := NewRampEscalation(store, 2, WithRampBounds(1, 4), WithRampWindow(2), WithRampCadence(time.Second))
+	assert.Equal(t, uint8(2), ramp.Required("new").ZeroBits)
+
+	observe := func(key string, success bool, n int, every time.Duration) {
+		for i := 0; i < n; i++ {
+			now = now.Add(every)
+			if success {
+				ramp.Success(key)
+			} else {
+				ramp.Failure(key)
+			}
+		}
+	}
+
+	// well behaved clients ramp down to the minimum
+	observe("steady", true, 6, time.Minute)
+	assert.Equal(t, uint8(1), ramp.Required("steady").ZeroBits)
+
+	// failing clients ramp up to the maximum
+	observe("failing", false, 10, time.Minute)
+	assert.Equal(t, uint8(4), ramp.Required("failing").ZeroBits)
+
+	// fast clients ramp up whatever their success rate
+	observe("fast", true, 2, 100*time.Millisecond)
+	assert.Equal(t, uint8(3), ramp.Required("fast").ZeroBits)
+
+	state, ok, err := store.Load("fast")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, 100*time.Millisecond, state.Interval)
+	assert.Equal(t, float64(1), state.SuccessRate)
+
+	// the middleware feeds the outcomes of the stamps
+	m := NewMiddleware(WithEscalation(ramp))
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 2; i++ {
+		now = now.Add(time.Minute)
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.Header.Set(DefaultStampHeader, "garbage")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, uint8(3), ramp.Required("192.0.2.1").ZeroBits)
+}
+
+func TestMiddleware_CostHeaders(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	ledger := NewLedger(NewMemoryLedgerStore(), 0)
+	m := NewMiddleware(
+		WithMiddlewareVerifier(NewVerifier(WithLedger(ledger))),
+		WithEscalation(NewLadderEscalation([]uint8{1, 2, 3}, time.Minute)),
+		WithCostHeaders(),
+	)
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(stamp string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if stamp != "" {
+			req.Header.Set(DefaultStampHeader, stamp)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Empty(t, rec.Header().Get(CostBitsHeader))
+
+	stamp, err := SolveChallenge(context.Background(), rec.Header().Get(DefaultChallengeHeader), 0)
+	require.NoError(t, err)
+
+	rec = do(stamp)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(CostBitsHeader))
+	assert.Equal(t, "256", rec.Header().Get(CostCreditHeader))
+	assert.Equal(t, "1", rec.Header().Get(CostNextBitsHeader), "the success resets the ladder")
+}
+
+func TestMiddleware_Allow(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	m := NewMiddleware(WithMiddlewareVerifier(NewVerifier(WithMinZeroBits(1))))
+
+	// the chi middleware signature
+	var _ func(http.Handler) http.Handler = m.Handler
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	_, ok := m.Allow(rec, req)
+	require.False(t, ok)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get(DefaultChallengeHeader))
+
+	stamp, err := SolveChallenge(context.Background(), rec.Header().Get(DefaultChallengeHeader), 0)
+	require.NoError(t, err)
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set(DefaultStampHeader, stamp)
+	allowed, ok := m.Allow(rec, req)
+	require.True(t, ok)
+	assert.Equal(t, http.StatusOK, rec.Code, "nothing is written for the allowed requests")
+
+	verified, ok := StampFromContext(allowed.Context())
+	require.True(t, ok)
+	assert.Equal(t, stamp, verified.Header.String())
+
+	// waived clients pass without a stamp
+	m = NewMiddleware(WithReputationProvider(ReputationFunc(func(string) Reputation { return Reputation{Allowlisted: true} })))
+	rec = httptest.NewRecorder()
+	_, ok = m.Allow(rec, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	assert.True(t, ok)
+}
+
+func TestMiddleware_Reputation(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	m := NewMiddleware(
+		WithClientKeyFunc(func(r *http.Request) string { return r.Header.Get("X-Client") }),
+		WithEscalation(fixedEscalation(1)),
+		WithReputationProvider(ReputationFunc(func(clientKey string) Reputation {
+			switch clientKey {
+			case "trusted":
+				return Reputation{Allowlisted: true}
+			case "abuser":
+				return Reputation{ExtraZeroBits: 2}
+			default:
+				return Reputation{}
+			}
+		})),
+	)
+	stamped := false
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, stamped = StampFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(client string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.Header.Set("X-Client", client)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, do("trusted").Code)
+	assert.False(t, stamped)
+
+	rec := do("abuser")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	challenge, err := parseWire(rec.Header().Get(DefaultChallengeHeader))
+	require.NoError(t, err)
+	assert.Equal(t, uint8(3), challenge.ZeroBits)
+
+	rec = do("unknown")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	challenge, err = parseWire(rec.Header().Get(DefaultChallengeHeader))
+	require.NoError(t, err)
+	assert.Equal(t, uint8(1), challenge.ZeroBits)
+}
+
+func TestMiddleware_ChallengeHandler(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	m := NewMiddleware(
+		WithMiddlewareVerifier(NewVerifier(WithMinZeroBits(1))),
+		WithSignedChallenges([]byte("secret")),
+	)
+	protected := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(handler http.Handler, method, stamp string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://example.com/", nil)
+		if stamp != "" {
+			req.Header.Set(DefaultStampHeader, stamp)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusMethodNotAllowed, do(m.ChallengeHandler(), http.MethodPost, "").Code)
+
+	rec := do(m.ChallengeHandler(), http.MethodGet, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp ChallengeResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, uint8(1), resp.RequiredZeroBits)
+
+	stamp, err := SolveChallenge(context.Background(), resp.Challenge, 0)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, do(protected, http.MethodGet, stamp).Code)
+
+	unsigned, err := New("example.com", 1, time.Minute)
+	require.NoError(t, err)
+	unsigned, err = Compute(context.Background(), unsigned, 0)
+	require.NoError(t, err)
+
+	rec = do(protected, http.MethodGet, unsigned.String())
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	var problem Problem
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&problem))
+	assert.Equal(t, "invalid_signature", problem.Code)
+}
+
+func TestEndpointRoutes(t *testing.T) {
+	t.Parallel()
+
+	routes, err := NewEndpointRoutes(
+		EndpointRoute{Pattern: "/api/", ZeroBits: 2},
+		EndpointRoute{Pattern: "/search", ZeroBits: 18},
+		EndpointRoute{Pattern: "POST /signup", ZeroBits: 24},
+		EndpointRoute{Pattern: "/users/*/", ZeroBits: 3},
+		EndpointRoute{Pattern: "/users/*/delete", ZeroBits: 20},
+	)
+	require.NoError(t, err)
+
+	tt := []struct {
+		method, path string
+		zeroBits     uint8
+		ok           bool
+	}{
+		{http.MethodGet, "/search", 18, true},
+		{http.MethodGet, "/search/more", 0, false},
+		{http.MethodPost, "/signup", 24, true},
+		{http.MethodGet, "/signup", 0, false},
+		{http.MethodGet, "/api/v1/items", 2, true},
+		{http.MethodGet, "/users/42/delete", 20, true},
+		{http.MethodGet, "/users/42/profile", 3, true},
+		{http.MethodGet, "/", 0, false},
+	}
+
+	for _, tc := range tt {
+		zeroBits, ok := routes.Match(tc.method, tc.path)
+		assert.Equal(t, tc.ok, ok, tc.path)
+		assert.Equal(t, tc.zeroBits, zeroBits, tc.path)
+	}
+
+	_, err = NewEndpointRoutes(EndpointRoute{Pattern: "GET search"})
+	assert.ErrorIs(t, err, ErrInvalidEndpointPattern)
+
+	m := NewMiddleware(
+		WithMiddlewareVerifier(NewVerifier(WithMinZeroBits(1))),
+		WithEndpointRoutes(routes),
+	)
+
+	challenge := func(target string) uint8 {
+		rec := httptest.NewRecorder()
+		m.ChallengeHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var resp ChallengeResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		return resp.RequiredZeroBits
+	}
+
+	assert.Equal(t, uint8(1), challenge("http://example.com/challenge"))
+	assert.Equal(t, uint8(18), challenge("http://example.com/challenge?path=/search"))
+	assert.Equal(t, uint8(24), challenge("http://example.com/challenge?method=POST&path=/signup"))
+}
+
+func TestMiddleware_ShadowMode(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	var records []AuditRecord
+	v := NewVerifier(WithMinZeroBits(1), WithAuditor(AuditorFunc(func(rec AuditRecord) {
+		records = append(records, rec)
+	})))
+
+	m := NewMiddleware(
+		WithMiddlewareVerifier(v),
+		WithEscalation(NewLadderEscalation([]uint8{1}, time.Minute)),
+		WithShadowMode(),
+	)
+
+	var rejections []error
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rejections = append(rejections, ShadowRejection(r.Context()))
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(stamp string) int {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if stamp != "" {
+			req.Header.Set(DefaultStampHeader, stamp)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	h, err := New("example.com", 1, time.Minute)
+	require.NoError(t, err)
+	h, err = Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, do(h.String()))
+	assert.Equal(t, http.StatusOK, do(""))
+	assert.Equal(t, http.StatusOK, do(""), "banned clients are let through")
+
+	require.Len(t, rejections, 3)
+	assert.NoError(t, rejections[0])
+	assert.ErrorIs(t, rejections[1], ErrMissingStamp)
+	assert.ErrorIs(t, rejections[2], ErrClientBanned)
+
+	require.Len(t, records, 2)
+	assert.Equal(t, AuditAccept, records[0].Decision)
+	assert.Equal(t, AuditReject, records[1].Decision)
+	assert.True(t, records[1].Shadow)
+	assert.Equal(t, VerifierStats{Accepted: 1, Rejected: 1}, v.Stats())
+}
+
+func TestMiddleware_IssueLimits(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+	randomizer = randBase64
+
+	m := NewMiddleware(
+		WithMiddlewareVerifier(NewVerifier(WithMinZeroBits(1))),
+		WithIssueLimits(IssueLimits{MaxOutstanding: 2, PerMinute: 3}),
+	)
+	protected := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(handler http.Handler, stamp string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if stamp != "" {
+			req.Header.Set(DefaultStampHeader, stamp)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(m.ChallengeHandler(), "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, http.StatusOK, do(m.ChallengeHandler(), "").Code)
+
+	rec2 := do(m.ChallengeHandler(), "")
+	require.Equal(t, http.StatusTooManyRequests, rec2.Code, "two challenges are outstanding")
+
+	var problem Problem
+	require.NoError(t, json.NewDecoder(rec2.Body).Decode(&problem))
+	assert.Equal(t, "issue_limited", problem.Code)
+	assert.Equal(t, 60, problem.RetryAfter)
+
+	// redeeming a challenge frees its slot
+	var resp ChallengeResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	stamp, err := SolveChallenge(context.Background(), resp.Challenge, 0)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, do(protected, stamp).Code)
+	require.Equal(t, http.StatusOK, do(m.ChallengeHandler(), "").Code)
+
+	// rejections of requests without a stamp are limited too
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, http.StatusTooManyRequests, do(protected, "").Code)
+
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, http.StatusOK, do(m.ChallengeHandler(), "").Code)
+}
+
+func TestMiddleware_Pregenerate(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+	randomizer = randBase64
+
+	queue := NewChallengeQueue(time.Minute)
+	m := NewMiddleware(
+		WithMiddlewareVerifier(NewVerifier(WithMinZeroBits(1), WithIssuedChallenges(NewMemoryChallengeStore()))),
+		WithSignedChallenges([]byte("secret")),
+		WithChallengeQueue(queue),
+	)
+	protected := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	ctx := context.Background()
+	require.NoError(t, m.Pregenerate(ctx, ChallengeBatch{Resource: "example.com", ZeroBits: 1, Count: 3, TTL: 10 * time.Minute}))
+	require.NoError(t, m.Pregenerate(ctx, ChallengeBatch{Resource: "other.com", ZeroBits: 1, Count: 2}))
+	assert.Equal(t, 5, queue.Len())
+
+	do := func(handler http.Handler, stamp string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if stamp != "" {
+			req.Header.Set(DefaultStampHeader, stamp)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	challenge := func() Header {
+		rec := do(m.ChallengeHandler(), "")
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var resp ChallengeResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		h, err := Parse(resp.Challenge)
+		require.NoError(t, err)
+		return h
+	}
+
+	// the queued challenges are recorded and signed
+	h := challenge()
+	assert.Equal(t, now.Add(10*time.Minute).UnixNano(), h.Expiration)
+	solved, err := Compute(ctx, h, 0)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, do(protected, solved.String()).Code)
+	assert.Equal(t, 4, queue.Len())
+
+	// the challenges with too little life left are dropped
+	now = now.Add(9*time.Minute + time.Second)
+	h = challenge()
+	assert.Equal(t, now.Add(defaultChallengeTTL).UnixNano(), h.Expiration)
+	assert.Equal(t, 2, queue.Len(), "only the other resource is left")
+
+	solved, err = Compute(ctx, h, 0)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, do(protected, solved.String()).Code)
+}
+
+func TestMiddleware_PregenerateNormalized(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+	randomizer = randBase64
+
+	queue := NewChallengeQueue(time.Minute)
+	m := NewMiddleware(
+		WithMiddlewareVerifier(NewVerifier(WithMinZeroBits(1), WithResourceNormalizer(NormalizeResource))),
+		WithChallengeQueue(queue),
+		WithIssueLimits(IssueLimits{MaxOutstanding: 1}),
+	)
+
+	ctx := context.Background()
+	require.NoError(t, m.Pregenerate(ctx, ChallengeBatch{Resource: "Example.com", ZeroBits: 1, Count: 2, TTL: 10 * time.Minute}))
+
+	challenge := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com./", nil)
+		req.RemoteAddr = remoteAddr
+
+		rec := httptest.NewRecorder()
+		m.ChallengeHandler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// the variants of the resource share the queue
+	require.Equal(t, http.StatusOK, challenge("192.0.2.1:1234"))
+	assert.Equal(t, 1, queue.Len())
+
+	// the challenge refused by the limiter stays queued
+	require.NotEqual(t, http.StatusOK, challenge("192.0.2.1:1234"))
+	assert.Equal(t, 1, queue.Len())
+
+	require.Equal(t, http.StatusOK, challenge("192.0.2.2:1234"))
+	assert.Zero(t, queue.Len())
+}
+
+func TestMiddleware_BodyBinding(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	m := NewMiddleware(WithEscalation(fixedEscalation(1)), WithBodyBinding(16))
+	var received string
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(body, stamp string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader(body))
+		if stamp != "" {
+			req.Header.Set(DefaultStampHeader, stamp)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(`{"amount":1}`, "")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	stamp, err := SolveChallenge(context.Background(), rec.Header().Get(DefaultChallengeHeader), 0)
+	require.NoError(t, err)
+
+	rec = do(`{"amount":9}`, stamp)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	var problem Problem
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&problem))
+	assert.Equal(t, "resource_mismatch", problem.Code)
+
+	assert.Equal(t, http.StatusOK, do(`{"amount":1}`, stamp).Code)
+	assert.Equal(t, `{"amount":1}`, received)
+
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader(`{"amount":2}`))
+	digest, err := DigestBody(req, 0)
+	require.NoError(t, err)
+
+	h, err := New("example.com", 1, time.Minute)
+	require.NoError(t, err)
+	h.Ext = BodyExt(digest)
+	solved, err := Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, do(`{"amount":2}`, solved.String()).Code)
+
+	rec = do(`{"amount":3}`, solved.String())
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&problem))
+	assert.Equal(t, "body_mismatch", problem.Code)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, do(strings.Repeat("x", 17), stamp).Code)
+
+	// the bodies over the limit are let through whole in shadow mode
+	m = NewMiddleware(WithEscalation(fixedEscalation(1)), WithBodyBinding(16), WithShadowMode())
+	handler = m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received = string(b)
+		assert.ErrorIs(t, ShadowRejection(r.Context()), ErrBodyTooLarge)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	large := strings.Repeat("x", 1024)
+	assert.Equal(t, http.StatusOK, do(large, stamp).Code)
+	assert.Equal(t, large, received)
+}
+
+func TestMiddleware_RequestBinding(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	m := NewMiddleware(WithEscalation(fixedEscalation(1)), WithRequestBinding())
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(handler http.Handler, method, target, stamp string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if stamp != "" {
+			req.Header.Set(DefaultStampHeader, stamp)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(m.ChallengeHandler(), http.MethodGet, "http://example.com/challenge?path=/search", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	challenge, err := parseWire(rec.Header().Get(DefaultChallengeHeader))
+	require.NoError(t, err)
+	resource, err := challenge.rawResource()
+	require.NoError(t, err)
+	assert.Equal(t, "GET example.com/search", resource)
+
+	rec = do(handler, http.MethodPost, "http://example.com/orders/", "")
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	stamp, err := SolveChallenge(context.Background(), rec.Header().Get(DefaultChallengeHeader), 0)
+	require.NoError(t, err)
+
+	rec = do(handler, http.MethodGet, "http://example.com/orders", stamp)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	var problem Problem
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&problem))
+	assert.Equal(t, "resource_mismatch", problem.Code)
+
+	assert.Equal(t, http.StatusOK, do(handler, http.MethodPost, "http://example.com//orders/./", stamp).Code)
+}
+
+func TestMiddleware_WorkHistogram(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	hist := NewWorkHistogram()
+	v := NewVerifier(WithMinZeroBits(1), WithWorkHistogram(hist))
+	handler := NewMiddleware(WithMiddlewareVerifier(v)).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, tc := range []struct {
+		zeroBits  uint8
+		solveTime string
+	}{
+		{zeroBits: 1, solveTime: "120"},
+		{zeroBits: 1, solveTime: "garbage"},
+		{zeroBits: 2},
+	} {
+		h, err := New("example.com", tc.zeroBits, time.Minute)
+		require.NoError(t, err)
+		h, err = Compute(context.Background(), h, 0)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.Header.Set(DefaultStampHeader, h.String())
+		if tc.solveTime != "" {
+			req.Header.Set(DefaultSolveTimeHeader, tc.solveTime)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	snapshot := hist.Snapshot()
+	assert.Equal(t, map[uint8]uint64{1: 2, 2: 1}, snapshot.ZeroBits)
+	assert.InDelta(t, 2.0/3, snapshot.ShareAt(1), 1e-9)
+	assert.Equal(t, []uint64{0, 0, 0, 1, 0, 0, 0, 0, 0}, snapshot.SolveTimes)
+
+	rec := httptest.NewRecorder()
+	NewAdminHandler(v).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var stats AdminStats
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&stats))
+	require.NotNil(t, stats.Work)
+	assert.Equal(t, snapshot, *stats.Work)
+}
@@ -0,0 +1,361 @@
+package hashcache
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var (
+	ErrMinerClosed    = newError(CodeMinerClosed, "miner closed")
+	ErrMinerSaturated = newError(CodeMinerSaturated, "miner queue is full")
+)
+
+type Priority int
+
+const (
+	// PrioritySpeculative is for pre-minting stamps ahead of time
+	PrioritySpeculative Priority = iota
+	PriorityNormal
+	// PriorityInteractive is for stamps a user is waiting for
+	PriorityInteractive
+
+	priorityLevels = 3
+)
+
+const defaultStarvationAge = 30 * time.Second
+
+type MinerConfig struct {
+	// Workers solving concurrently, defaults to the number of CPUs
+	Workers int
+
+	// MaxIterations per job, zero meaning no limit
+	MaxIterations int
+
+	// Shares caps the number of workers busy with jobs of a priority,
+	// zero meaning no cap
+	Shares [priorityLevels]int
+
+	// StarvationAge after which a waiting job is served
+	// ahead of any other priority
+	StarvationAge time.Duration
+
+	// MaxQueue bounds the number of waiting jobs, jobs submitted to
+	// a full queue fail with ErrMinerSaturated. Zero means no bound.
+	MaxQueue int
+
+	// Keystore receives the solved speculative stamps, see WithKeystore
+	Keystore StampKeystore
+}
+
+// MinerStats is a snapshot of the miner load
+type MinerStats struct {
+	// Queued jobs by priority
+	Queued   [priorityLevels]int
+	InFlight int
+
+	Completed uint64
+	Failed    uint64
+	// Rejected because the queue was full
+	Rejected uint64
+	// Dropped from the queue without running, because they were
+	// cancelled while waiting or the miner was closed
+	Dropped uint64
+}
+
+// QueueDepth is the total number of waiting jobs
+func (s MinerStats) QueueDepth() int {
+	var depth int
+	for _, n := range s.Queued {
+		depth += n
+	}
+
+	return depth
+}
+
+type MinerOption func(*MinerConfig)
+
+func WithMinerWorkers(n int) MinerOption {
+	return func(cfg *MinerConfig) {
+		cfg.Workers = n
+	}
+}
+
+func WithPriorityShare(p Priority, workers int) MinerOption {
+	return func(cfg *MinerConfig) {
+		cfg.Shares[p] = workers
+	}
+}
+
+func WithStarvationAge(d time.Duration) MinerOption {
+	return func(cfg *MinerConfig) {
+		cfg.StarvationAge = d
+	}
+}
+
+func WithMaxQueue(n int) MinerOption {
+	return func(cfg *MinerConfig) {
+		cfg.MaxQueue = n
+	}
+}
+
+// WithKeystore stores the stamps solved by speculative jobs in the
+// keystore, to be taken with Take when needed, e.g. a FileKeystore
+// keeping them across the restarts of the app
+func WithKeystore(ks StampKeystore) MinerOption {
+	return func(cfg *MinerConfig) {
+		cfg.Keystore = ks
+	}
+}
+
+type minerJob struct {
+	ctx      context.Context
+	header   Header
+	priority Priority
+	queuedAt time.Time
+	job      *Job
+}
+
+// Miner solves headers in the background, serving urgent interactive
+// requests ahead of speculative pre-minting
+type Miner struct {
+	cfg MinerConfig
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queues   [priorityLevels][]*minerJob
+	running  [priorityLevels]int
+	inFlight map[*minerJob]struct{}
+	closed   bool
+	stats    MinerStats
+
+	wg sync.WaitGroup
+}
+
+func NewMiner(opts ...MinerOption) *Miner {
+	cfg := MinerConfig{
+		Workers:       runtime.NumCPU(),
+		StarvationAge: defaultStarvationAge,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	m := &Miner{cfg: cfg, inFlight: make(map[*minerJob]struct{})}
+	m.cond = sync.NewCond(&m.mu)
+
+	for i := 0; i < max(cfg.Workers, 1); i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+
+	return m
+}
+
+// Submit queues the header to be solved with the priority
+func (m *Miner) Submit(ctx context.Context, h Header, p Priority) *Job {
+	p = min(max(p, PrioritySpeculative), PriorityInteractive)
+
+	ctx, cancel := context.WithCancel(ctx)
+	job := newJob(cancel)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		job.finish(ComputeResult{}, ErrMinerClosed)
+		return job
+	}
+
+	if m.cfg.MaxQueue > 0 && m.queueDepth() >= m.cfg.MaxQueue {
+		m.stats.Rejected++
+		job.finish(ComputeResult{}, ErrMinerSaturated)
+		return job
+	}
+
+	m.queues[p] = append(m.queues[p], &minerJob{ctx: ctx, header: h, priority: p, queuedAt: clock(), job: job})
+	m.cond.Signal()
+	return job
+}
+
+// Take a pre-minted stamp of the resource with at least the zero bits
+// from the keystore, reporting whether there was one
+func (m *Miner) Take(ctx context.Context, resource string, zeroBits uint8) (Header, bool, error) {
+	if m.cfg.Keystore == nil {
+		return Header{}, false, nil
+	}
+
+	return m.cfg.Keystore.Take(ctx, resource, zeroBits)
+}
+
+// Close stops accepting jobs, fails the queued ones and waits for
+// the running ones to finish, cancelling them when ctx is done first
+func (m *Miner) Close(ctx context.Context) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+
+	m.closed = true
+	for p := range m.queues {
+		for _, queued := range m.queues[p] {
+			queued.job.finish(ComputeResult{}, ErrMinerClosed)
+			m.stats.Dropped++
+		}
+		m.queues[p] = nil
+	}
+	m.cond.Broadcast()
+	m.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		m.cancelRunning()
+		<-stopped
+		return ctx.Err()
+	}
+}
+
+func (m *Miner) cancelRunning() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for running := range m.inFlight {
+		running.job.Cancel()
+	}
+}
+
+func (m *Miner) work() {
+	defer m.wg.Done()
+
+	for {
+		next, ok := m.next()
+		if !ok {
+			return
+		}
+
+		if err := next.ctx.Err(); err != nil {
+			next.job.finish(ComputeResult{}, err)
+			m.done(next, &m.stats.Dropped)
+			continue
+		}
+
+		start := time.Now()
+		h, err := Compute(next.ctx, next.header, m.cfg.MaxIterations)
+		if err == nil && next.priority == PrioritySpeculative && m.cfg.Keystore != nil {
+			err = m.cfg.Keystore.Put(next.ctx, h)
+		}
+		next.job.finish(ComputeResult{Time: time.Since(start), Header: h}, err)
+
+		if err != nil {
+			m.done(next, &m.stats.Failed)
+		} else {
+			m.done(next, &m.stats.Completed)
+		}
+	}
+}
+
+// done releases the worker share of the job and counts its outcome
+func (m *Miner) done(job *minerJob, outcome *uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	*outcome++
+	m.running[job.priority]--
+	delete(m.inFlight, job)
+	m.cond.Broadcast()
+}
+
+// Stats of the miner
+func (m *Miner) Stats() MinerStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	for p := range m.queues {
+		stats.Queued[p] = len(m.queues[p])
+	}
+	stats.InFlight = len(m.inFlight)
+	return stats
+}
+
+func (m *Miner) queueDepth() int {
+	var depth int
+	for p := range m.queues {
+		depth += len(m.queues[p])
+	}
+
+	return depth
+}
+
+// next blocks until a job can be run or the miner is closed
+func (m *Miner) next() (*minerJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for {
+		if m.closed {
+			return nil, false
+		}
+
+		if next := m.pick(); next != nil {
+			m.running[next.priority]++
+			m.inFlight[next] = struct{}{}
+			return next, true
+		}
+
+		m.cond.Wait()
+	}
+}
+
+// pick serves the oldest starving job first, then the highest
+// priority with a free share of workers
+func (m *Miner) pick() *minerJob {
+	now := clock()
+
+	starving := -1
+	for p := range m.queues {
+		if len(m.queues[p]) == 0 || now.Sub(m.queues[p][0].queuedAt) < m.cfg.StarvationAge {
+			continue
+		}
+
+		if starving < 0 || m.queues[p][0].queuedAt.Before(m.queues[starving][0].queuedAt) {
+			starving = p
+		}
+	}
+
+	if starving >= 0 {
+		return m.pop(starving)
+	}
+
+	for p := len(m.queues) - 1; p >= 0; p-- {
+		if len(m.queues[p]) == 0 {
+			continue
+		}
+
+		if share := m.cfg.Shares[p]; share > 0 && m.running[p] >= share {
+			continue
+		}
+
+		return m.pop(p)
+	}
+
+	return nil
+}
+
+func (m *Miner) pop(p int) *minerJob {
+	next := m.queues[p][0]
+	m.queues[p][0] = nil
+	m.queues[p] = m.queues[p][1:]
+	return next
+}
@@ -0,0 +1,198 @@
+package hashcache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiner_Pick(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	m := &Miner{cfg: MinerConfig{StarvationAge: time.Minute}}
+	m.cfg.Shares[PriorityInteractive] = 1
+
+	queue := func(p Priority, queuedAt time.Time) *minerJob {
+		j := &minerJob{priority: p, queuedAt: queuedAt}
+		m.queues[p] = append(m.queues[p], j)
+		return j
+	}
+
+	speculative := queue(PrioritySpeculative, now.Add(-2*time.Minute))
+	normal := queue(PriorityNormal, now)
+	interactive := queue(PriorityInteractive, now)
+	second := queue(PriorityInteractive, now)
+
+	assert.Same(t, speculative, m.pick(), "starving job goes first")
+	assert.Same(t, interactive, m.pick())
+
+	m.running[PriorityInteractive] = 1
+	assert.Same(t, normal, m.pick(), "interactive share is used up")
+	assert.Nil(t, m.pick())
+
+	m.running[PriorityInteractive] = 0
+	assert.Same(t, second, m.pick())
+}
+
+func TestMiner_Submit(t *testing.T) {
+	t.Parallel()
+
+	m := NewMiner(WithMinerWorkers(2))
+
+	h, err := Parse("1:2:1665396610:bG9jYWxob3N0:sha-256:vZOxuoIgixP+hw==:AAAAAAAAAAA=")
+	require.NoError(t, err)
+
+	result, err := m.Submit(context.Background(), h, PriorityInteractive).Result()
+	require.NoError(t, err)
+	assert.True(t, result.Header.Valid())
+
+	blocker := h
+	blocker.ZeroBits = 60
+	busy := m.Submit(context.Background(), blocker, PriorityNormal)
+	require.Eventually(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return len(m.inFlight) == 1
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, m.Close(ctx), context.DeadlineExceeded)
+
+	_, err = busy.Result()
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = m.Submit(context.Background(), h, PriorityNormal).Result()
+	assert.ErrorIs(t, err, ErrMinerClosed)
+}
+
+func TestMiner_Backpressure(t *testing.T) {
+	t.Parallel()
+
+	m := NewMiner(WithMinerWorkers(1), WithMaxQueue(1))
+
+	blocker, err := Parse("1:60:1665396610:bG9jYWxob3N0:sha-256:vZOxuoIgixP+hw==:AAAAAAAAAAA=")
+	require.NoError(t, err)
+
+	m.Submit(context.Background(), blocker, PriorityNormal)
+	require.Eventually(t, func() bool { return m.Stats().InFlight == 1 }, time.Second, time.Millisecond)
+
+	queued := m.Submit(context.Background(), blocker, PrioritySpeculative)
+	_, err = m.Submit(context.Background(), blocker, PriorityInteractive).Result()
+	assert.ErrorIs(t, err, ErrMinerSaturated)
+
+	stats := m.Stats()
+	assert.Equal(t, 1, stats.QueueDepth())
+	assert.Equal(t, 1, stats.Queued[PrioritySpeculative])
+	assert.Equal(t, uint64(1), stats.Rejected)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, m.Close(ctx), context.DeadlineExceeded)
+
+	_, err = queued.Result()
+	assert.ErrorIs(t, err, ErrMinerClosed)
+
+	stats = m.Stats()
+	assert.Equal(t, uint64(1), stats.Dropped)
+	assert.Equal(t, uint64(1), stats.Failed)
+	assert.Equal(t, 0, stats.InFlight)
+}
+
+func TestMiner_Keystore(t *testing.T) {
+	now := time.Now()
+	clock = func() time.Time { return now }
+	defer func() { clock = time.Now }()
+
+	path := filepath.Join(t.TempDir(), "stamps")
+	ks, err := OpenFileKeystore(path)
+	require.NoError(t, err)
+
+	m := NewMiner(WithMinerWorkers(1), WithKeystore(ks))
+
+	for _, bits := range []uint8{1, 2} {
+		h, err := New("api.example.com", bits, time.Hour)
+		require.NoError(t, err)
+		_, err = m.Submit(context.Background(), h, PrioritySpeculative).Result()
+		require.NoError(t, err)
+	}
+
+	h, err := New("api.example.com", 1, time.Hour)
+	require.NoError(t, err)
+	_, err = m.Submit(context.Background(), h, PriorityInteractive).Result()
+	require.NoError(t, err)
+	assert.Equal(t, 2, ks.Len(), "only speculative stamps are kept")
+
+	// the workers read the clock, stop them before moving it
+	require.NoError(t, m.Close(context.Background()))
+
+	// the stamps survive a restart
+	ks, err = OpenFileKeystore(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, ks.Len())
+
+	stamp, ok, err := ks.Take(context.Background(), "api.example.com", 2)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, uint8(2), stamp.ZeroBits)
+	assert.True(t, stamp.Valid())
+
+	_, ok, err = ks.Take(context.Background(), "other.example.com", 0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	now = now.Add(2 * time.Hour)
+	ks, err = OpenFileKeystore(path)
+	require.NoError(t, err)
+	assert.Zero(t, ks.Len(), "expired stamps are dropped")
+}
+
+func TestFileKeystore(t *testing.T) {
+	now := time.Now()
+	clock = func() time.Time { return now }
+	defer func() { clock = time.Now }()
+
+	ks, err := OpenFileKeystore(filepath.Join(t.TempDir(), "stamps"))
+	require.NoError(t, err)
+
+	for _, ttl := range []time.Duration{time.Minute, time.Hour} {
+		h, err := New("api.example.com", 1, ttl)
+		require.NoError(t, err)
+		require.NoError(t, ks.Put(context.Background(), h))
+	}
+
+	// the expired stamps are evicted once
+	now = now.Add(2 * time.Minute)
+	require.Equal(t, 1, ks.Len())
+	require.Len(t, ks.stamps, 1)
+
+	// the stamps put by the process are found without reloading
+	stamp, ok, err := ks.Take(context.Background(), "api.example.com", 1)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, now.Add(time.Hour-2*time.Minute).UnixNano(), stamp.Expiration)
+
+	_, ok, err = ks.Take(context.Background(), "api.example.com", 1)
+	require.NoError(t, err)
+	assert.False(t, ok, "a stamp is taken once")
+
+	// the stamps are kept in memory as in the file when saving fails
+	dir := t.TempDir()
+	ks, err = OpenFileKeystore(filepath.Join(dir, "stamps"))
+	require.NoError(t, err)
+	h, err := New("api.example.com", 1, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, ks.Put(context.Background(), h))
+	require.NoError(t, os.RemoveAll(dir))
+
+	_, _, err = ks.Take(context.Background(), "api.example.com", 1)
+	require.Error(t, err)
+	require.Error(t, ks.Put(context.Background(), h))
+	assert.Equal(t, 1, ks.Len())
+}
@@ -0,0 +1,120 @@
+package hashcache
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+type MintConfig struct {
+	// Concurrency is the number of stamps solved at once,
+	// defaults to the number of CPUs
+	Concurrency int
+
+	// MaxIterations per stamp, zero meaning no limit
+	MaxIterations int
+
+	// Template of the minted stamps
+	Template ChallengeTemplate
+
+	// Progress is called after every solved stamp
+	// with the number of stamps done so far
+	Progress func(done, total int)
+}
+
+type MintOption func(*MintConfig)
+
+func WithMintConcurrency(n int) MintOption {
+	return func(cfg *MintConfig) {
+		cfg.Concurrency = n
+	}
+}
+
+func WithMintTemplate(t ChallengeTemplate) MintOption {
+	return func(cfg *MintConfig) {
+		cfg.Template = t
+	}
+}
+
+func WithProgress(fn func(done, total int)) MintOption {
+	return func(cfg *MintConfig) {
+		cfg.Progress = fn
+	}
+}
+
+// MintAll solves a stamp per resource sharing a budget of workers, e.g. for
+// a mail sender minting a stamp per recipient. The stamps are returned in
+// the order of the resources, the first failure cancels the rest.
+func MintAll(baseCtx context.Context, resources []string, opts ...MintOption) ([]Header, error) {
+	cfg := MintConfig{Concurrency: runtime.NumCPU()}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	ctx, cancel := context.WithCancel(baseCtx)
+	defer cancel()
+
+	headers := make([]Header, len(resources))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	var done atomic.Int64
+	var errOnce sync.Once
+	var firstErr error
+
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	for i := 0; i < max(cfg.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				h, err := cfg.Template.Issue(resources[i])
+				if err != nil {
+					fail(err)
+					return
+				}
+
+				if headers[i], err = Compute(ctx, h, cfg.MaxIterations); err != nil {
+					fail(err)
+					return
+				}
+
+				n := done.Add(1)
+				if cfg.Progress != nil {
+					cfg.Progress(int(n), len(resources))
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := range resources {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if err := baseCtx.Err(); err != nil {
+		return nil, err
+	}
+
+	return headers, nil
+}
@@ -0,0 +1,43 @@
+package hashcache
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMintAll(t *testing.T) {
+	t.Parallel()
+
+	resources := make([]string, 20)
+	for i := range resources {
+		resources[i] = fmt.Sprintf("rcpt-%d@example.com", i)
+	}
+
+	var progress atomic.Int64
+	headers, err := MintAll(
+		context.Background(),
+		resources,
+		WithMintConcurrency(4),
+		WithMintTemplate(ChallengeTemplate{Algorithm: algSha256, ZeroBits: 2, TTL: time.Hour}),
+		WithProgress(func(done, total int) {
+			assert.Equal(t, len(resources), total)
+			progress.Add(1)
+		}),
+	)
+	require.NoError(t, err)
+	require.Len(t, headers, len(resources))
+	assert.Equal(t, int64(len(resources)), progress.Load())
+
+	for i, h := range headers {
+		assert.True(t, h.Valid())
+		assert.Equal(t, uint8(2), h.ZeroBits)
+		assert.Equal(t, base64.StdEncoding.EncodeToString([]byte(resources[i])), h.Resource)
+	}
+}
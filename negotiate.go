@@ -0,0 +1,205 @@
+package hashcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	maxOfferBytes = 1 << 16
+)
+
+var (
+	ErrNoCommonFormat    = newError(CodeNoCommonFormat, "no common header format")
+	ErrNoCommonAlgorithm = newError(CodeNoCommonAlgorithm, "no common algorithm")
+	ErrDifficultyTooLow  = newError(CodeDifficultyTooLow, "acceptable difficulty is too low")
+	ErrNegotiationFailed = newError(CodeNegotiationFailed, "negotiation failed")
+)
+
+var defaultAlgorithmsOrder = []string{algSha256, algSha512, algSha1}
+
+// Offer is sent by the client to advertise what work it is able to do
+type Offer struct {
+	Resource string `json:"resource"`
+
+	// Algorithms supported by the client, all registered algorithms are
+	// assumed when empty
+	Algorithms []string `json:"algorithms"`
+
+	// MaxZeroBits the client is willing to compute, zero means no limit
+	MaxZeroBits uint8 `json:"max_zero_bits"`
+
+	// Formats the client is able to emit,
+	// the format of this library is assumed when empty
+	Formats []HeaderFormat `json:"formats,omitempty"`
+
+	// MaxTTL shortens the ttl of the challenge, zero keeps the server ttl
+	MaxTTL Duration `json:"max_ttl,omitempty"`
+}
+
+type NegotiatorConfig struct {
+	// Algorithms in the order of server preference
+	Algorithms []string
+
+	// ZeroBits required from clients without limits
+	ZeroBits uint8
+
+	// MinZeroBits the server is willing to go down to
+	MinZeroBits uint8
+
+	// Formats the server accepts in the order of preference,
+	// only the format of this library when empty
+	Formats []HeaderFormat
+
+	TTL time.Duration
+}
+
+// Negotiator responds to client offers with concrete challenges, so that
+// heterogeneous clients get appropriately sized work. The types are plain
+// data and can be carried by any transport, the negotiator itself serves
+// them over HTTP as JSON.
+type Negotiator struct {
+	cfg NegotiatorConfig
+}
+
+func NewNegotiator(cfg NegotiatorConfig) *Negotiator {
+	if len(cfg.Algorithms) == 0 {
+		cfg.Algorithms = defaultAlgorithmsOrder
+	}
+
+	if len(cfg.Formats) == 0 {
+		cfg.Formats = []HeaderFormat{FormatLibrary}
+	}
+
+	return &Negotiator{cfg: cfg}
+}
+
+// Negotiate a challenge for the offer
+func (n *Negotiator) Negotiate(offer Offer) (Header, error) {
+	format, ok := n.chooseFormat(offer.Formats)
+	if !ok {
+		return Header{}, ErrNoCommonFormat
+	}
+
+	alg, ok := n.chooseAlgorithm(offer.Algorithms, format)
+	if !ok {
+		return Header{}, ErrNoCommonAlgorithm
+	}
+
+	zeroBits := n.cfg.ZeroBits
+	if offer.MaxZeroBits > 0 && offer.MaxZeroBits < zeroBits {
+		zeroBits = offer.MaxZeroBits
+	}
+
+	if zeroBits < n.cfg.MinZeroBits {
+		return Header{}, fmt.Errorf("%w: client accepts %d, server requires at least %d",
+			ErrDifficultyTooLow, offer.MaxZeroBits, n.cfg.MinZeroBits)
+	}
+
+	ttl := n.cfg.TTL
+	if offer.MaxTTL > 0 {
+		ttl = min(ttl, time.Duration(offer.MaxTTL))
+	}
+
+	return ChallengeTemplate{
+		Algorithm: alg,
+		ZeroBits:  zeroBits,
+		TTL:       ttl,
+		Options:   []HeaderOption{WithFormat(format)},
+	}.Issue(offer.Resource)
+}
+
+func (n *Negotiator) chooseFormat(offered []HeaderFormat) (HeaderFormat, bool) {
+	if len(offered) == 0 {
+		offered = []HeaderFormat{FormatLibrary}
+	}
+
+	for _, f := range n.cfg.Formats {
+		if slices.Contains(offered, f) {
+			return f, true
+		}
+	}
+
+	return 0, false
+}
+
+// chooseAlgorithm is sha-1 for the formats of the specification
+func (n *Negotiator) chooseAlgorithm(offered []string, format HeaderFormat) (string, bool) {
+	for _, alg := range n.cfg.Algorithms {
+		if !isSupportedAlgorithm(alg) || (format != FormatLibrary && alg != algSha1) {
+			continue
+		}
+
+		if len(offered) == 0 || slices.Contains(offered, alg) {
+			return alg, true
+		}
+	}
+
+	return "", false
+}
+
+// ServeHTTP accepts an Offer posted as JSON
+// and responds with the challenge Header as JSON
+func (n *Negotiator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var offer Offer
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxOfferBytes)).Decode(&offer); err != nil {
+		http.Error(w, "invalid offer", http.StatusBadRequest)
+		return
+	}
+
+	h, err := n.Negotiate(offer)
+	switch {
+	case errors.Is(err, ErrNoCommonFormat), errors.Is(err, ErrNoCommonAlgorithm), errors.Is(err, ErrDifficultyTooLow):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h)
+}
+
+// RequestChallenge posts the offer to a Negotiator served at the url
+func RequestChallenge(ctx context.Context, client *http.Client, url string, offer Offer) (Header, error) {
+	body, err := json.Marshal(offer)
+	if err != nil {
+		return Header{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Header{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Header{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Header{}, fmt.Errorf("%w: status %d", ErrNegotiationFailed, resp.StatusCode)
+	}
+
+	var h Header
+	if err := json.NewDecoder(resp.Body).Decode(&h); err != nil {
+		return Header{}, fmt.Errorf("%w: %s", ErrNegotiationFailed, err.Error())
+	}
+
+	return h, nil
+}
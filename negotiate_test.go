@@ -0,0 +1,170 @@
+package hashcache
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiator(t *testing.T) {
+	t.Parallel()
+
+	n := NewNegotiator(NegotiatorConfig{
+		Algorithms:  []string{algSha512, algSha256},
+		ZeroBits:    5,
+		MinZeroBits: 3,
+		TTL:         time.Minute,
+	})
+
+	srv := httptest.NewServer(n)
+	defer srv.Close()
+
+	t.Run("capped difficulty and common algorithm", func(t *testing.T) {
+		h, err := RequestChallenge(context.Background(), srv.Client(), srv.URL, Offer{
+			Resource:    "127.0.0.1",
+			Algorithms:  []string{algSha1, algSha256},
+			MaxZeroBits: 4,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, algSha256, h.Algorithm)
+		assert.Equal(t, uint8(4), h.ZeroBits)
+	})
+
+	t.Run("no limits", func(t *testing.T) {
+		h, err := n.Negotiate(Offer{Resource: "127.0.0.1"})
+		require.NoError(t, err)
+		assert.Equal(t, algSha512, h.Algorithm)
+		assert.Equal(t, uint8(5), h.ZeroBits)
+	})
+
+	t.Run("no agreement", func(t *testing.T) {
+		_, err := n.Negotiate(Offer{Algorithms: []string{algSha1}})
+		assert.ErrorIs(t, err, ErrNoCommonAlgorithm)
+
+		_, err = n.Negotiate(Offer{MaxZeroBits: 2})
+		assert.ErrorIs(t, err, ErrDifficultyTooLow)
+
+		_, err = RequestChallenge(context.Background(), srv.Client(), srv.URL, Offer{MaxZeroBits: 2})
+		assert.ErrorIs(t, err, ErrNegotiationFailed)
+
+		_, err = n.Negotiate(Offer{Formats: []HeaderFormat{FormatSpec}})
+		assert.ErrorIs(t, err, ErrNoCommonFormat)
+	})
+
+	t.Run("format of the specification", func(t *testing.T) {
+		n := NewNegotiator(NegotiatorConfig{
+			ZeroBits: 2,
+			Formats:  []HeaderFormat{FormatSpec, FormatLibrary},
+			TTL:      time.Minute,
+		})
+
+		srv := httptest.NewServer(n)
+		defer srv.Close()
+
+		h, err := RequestChallenge(context.Background(), srv.Client(), srv.URL, Offer{
+			Resource: "127.0.0.1",
+			Formats:  []HeaderFormat{FormatLibrary, FormatSpec},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, FormatSpec, h.Format)
+		assert.Equal(t, algSha1, h.Algorithm)
+
+		h, err = n.Negotiate(Offer{Resource: "127.0.0.1", Algorithms: []string{algSha256}})
+		require.NoError(t, err)
+		assert.Equal(t, FormatLibrary, h.Format)
+	})
+}
+
+func TestSolveWithFallback(t *testing.T) {
+	t.Parallel()
+
+	n := NewNegotiator(NegotiatorConfig{
+		Algorithms:  []string{algSha1},
+		ZeroBits:    40,
+		MinZeroBits: 1,
+		TTL:         time.Minute,
+	})
+	fetch := func(ctx context.Context, offer Offer) (Header, error) {
+		return n.Negotiate(offer)
+	}
+	offer := Offer{Resource: "example.com"}
+
+	start := time.Now()
+	h, err := SolveWithFallback(context.Background(), offer, fetch, []FallbackStep{
+		{Budget: 20 * time.Millisecond},
+		{MaxZeroBits: 1, MaxTTL: 10 * time.Second},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint8(1), h.ZeroBits)
+	assert.True(t, h.Valid())
+	assert.LessOrEqual(t, h.Expiration, start.Add(11*time.Second).UnixNano())
+
+	_, err = SolveWithFallback(context.Background(), offer, fetch, []FallbackStep{
+		{Budget: 10 * time.Millisecond},
+	})
+	assert.ErrorIs(t, err, ErrFallbackExhausted)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = SolveWithFallback(context.Background(), Offer{Resource: "example.com", Algorithms: []string{algSha512}}, fetch,
+		[]FallbackStep{{MaxZeroBits: 1}})
+	assert.ErrorIs(t, err, ErrFallbackExhausted)
+	assert.ErrorIs(t, err, ErrNoCommonAlgorithm)
+}
+
+func TestCallWithStamp(t *testing.T) {
+	t.Parallel()
+
+	n := NewNegotiator(NegotiatorConfig{
+		Algorithms:  []string{algSha256},
+		ZeroBits:    2,
+		MinZeroBits: 1,
+		TTL:         time.Minute,
+	})
+	fetch := func(ctx context.Context, offer Offer) (Header, error) {
+		return n.Negotiate(offer)
+	}
+	offer := WithFlowOffer(Offer{Resource: "example.com"})
+
+	var callBudget time.Duration
+	call := func(ctx context.Context, stamp Header) error {
+		deadline, _ := ctx.Deadline()
+		callBudget = time.Until(deadline)
+		if !stamp.Valid() {
+			return ErrInvalidProof
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, CallWithStamp(ctx, fetch, call, offer))
+	assert.Greater(t, callBudget, 9*time.Second, "the unused time goes to the call")
+
+	// an impossible solve is aborted with the call share left
+	hard := NewNegotiator(NegotiatorConfig{Algorithms: []string{algSha256}, ZeroBits: 40, MinZeroBits: 40, TTL: time.Minute})
+	fetchHard := func(ctx context.Context, offer Offer) (Header, error) {
+		return hard.Negotiate(offer)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	err := CallWithStamp(ctx, fetchHard, call, offer, WithDeadlineSplit(DeadlineSplit{Fetch: 1, Solve: 1, Call: 2}))
+	var flowErr *FlowError
+	require.ErrorAs(t, err, &flowErr)
+	assert.Equal(t, FlowSolve, flowErr.Phase)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.InDelta(t, 67*time.Millisecond, flowErr.Budget, float64(20*time.Millisecond))
+	assert.NoError(t, ctx.Err(), "the deadline of the request is not reached")
+
+	err = CallWithStamp(context.Background(), func(context.Context, Offer) (Header, error) {
+		return Header{}, ErrNegotiationFailed
+	}, call)
+	require.ErrorAs(t, err, &flowErr)
+	assert.Equal(t, FlowFetch, flowErr.Phase)
+	assert.ErrorIs(t, err, ErrNegotiationFailed)
+}
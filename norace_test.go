@@ -0,0 +1,5 @@
+//go:build !race
+
+package hashcache
+
+const raceEnabled = false
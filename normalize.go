@@ -0,0 +1,216 @@
+package hashcache
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	punycodeBase        = 36
+	punycodeTMin        = 1
+	punycodeTMax        = 26
+	punycodeSkew        = 38
+	punycodeDamp        = 700
+	punycodeInitialBias = 72
+	punycodeInitialN    = 128
+
+	acePrefix = "xn--"
+)
+
+var ErrInvalidResource = newError(CodeInvalidResource, "invalid resource")
+
+// ResourceNormalizer maps equivalent spellings of a resource to a single
+// form. It is applied both at mint and at verify time, so that e.g.
+// "User@Example.com" and "user@example.com" are the same stamp resource.
+type ResourceNormalizer func(resource string) (string, error)
+
+// NormalizeResource picks the normalization by the shape of the resource:
+// IP addresses, email addresses and domain names are supported, anything
+// else is returned as is.
+func NormalizeResource(resource string) (string, error) {
+	if _, err := netip.ParseAddr(resource); err == nil {
+		return NormalizeIP(resource)
+	}
+
+	if _, err := netip.ParseAddrPort(resource); err == nil {
+		return NormalizeIP(resource)
+	}
+
+	if strings.Contains(resource, "@") {
+		return NormalizeEmail(resource)
+	}
+
+	if strings.Contains(resource, ".") && !strings.ContainsAny(resource, "/: ") {
+		return NormalizeDomain(resource)
+	}
+
+	return resource, nil
+}
+
+// NormalizeIP formats an IP address or an address with port canonically,
+// IPv4-mapped IPv6 addresses are reduced to IPv4
+func NormalizeIP(resource string) (string, error) {
+	if addr, err := netip.ParseAddr(resource); err == nil {
+		return addr.Unmap().WithZone(addr.Zone()).String(), nil
+	}
+
+	addrPort, err := netip.ParseAddrPort(resource)
+	if err != nil {
+		return "", fmt.Errorf("%w: '%s' is not an ip address", ErrInvalidResource, resource)
+	}
+
+	return netip.AddrPortFrom(addrPort.Addr().Unmap(), addrPort.Port()).String(), nil
+}
+
+// NormalizeEmail lowercases the address and normalizes its domain
+func NormalizeEmail(resource string) (string, error) {
+	at := strings.LastIndex(resource, "@")
+	if at <= 0 || at == len(resource)-1 {
+		return "", fmt.Errorf("%w: '%s' is not an email address", ErrInvalidResource, resource)
+	}
+
+	domain, err := NormalizeDomain(resource[at+1:])
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ToLower(resource[:at]) + "@" + domain, nil
+}
+
+// NormalizeDomain lowercases the domain, drops the trailing dot and
+// converts internationalized labels to punycode. It does not implement
+// the full IDNA mapping, only case folding of the labels.
+func NormalizeDomain(resource string) (string, error) {
+	domain := strings.TrimSuffix(strings.ToLower(resource), ".")
+	if domain == "" {
+		return "", fmt.Errorf("%w: empty domain", ErrInvalidResource)
+	}
+
+	labels := strings.Split(domain, ".")
+	for i, label := range labels {
+		if label == "" {
+			return "", fmt.Errorf("%w: empty label in domain '%s'", ErrInvalidResource, resource)
+		}
+
+		if !utf8.ValidString(label) {
+			return "", fmt.Errorf("%w: domain '%s' is not valid utf-8", ErrInvalidResource, resource)
+		}
+
+		if isASCII(label) {
+			continue
+		}
+
+		encoded, err := encodePunycode(label)
+		if err != nil {
+			return "", err
+		}
+		labels[i] = acePrefix + encoded
+	}
+
+	return strings.Join(labels, "."), nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
+
+// encodePunycode implements the encoding procedure of RFC 3492
+func encodePunycode(s string) (string, error) {
+	runes := []rune(s)
+	out := make([]byte, 0, len(s)+8)
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+
+	basic := len(out)
+	handled := basic
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := punycodeInitialN, 0, punycodeInitialBias
+	for handled < len(runes) {
+		m := math.MaxInt32
+		for _, r := range runes {
+			if int(r) >= n && int(r) < m {
+				m = int(r)
+			}
+		}
+
+		if m-n > (math.MaxInt32-delta)/(handled+1) {
+			return "", fmt.Errorf("%w: punycode overflow", ErrInvalidResource)
+		}
+		delta += (m - n) * (handled + 1)
+		n = m
+
+		for _, r := range runes {
+			if int(r) < n {
+				delta++
+				if delta == math.MaxInt32 {
+					return "", fmt.Errorf("%w: punycode overflow", ErrInvalidResource)
+				}
+			}
+
+			if int(r) != n {
+				continue
+			}
+
+			q := delta
+			for k := punycodeBase; ; k += punycodeBase {
+				t := min(max(k-bias, punycodeTMin), punycodeTMax)
+				if q < t {
+					break
+				}
+
+				out = append(out, punycodeDigit(t+(q-t)%(punycodeBase-t)))
+				q = (q - t) / (punycodeBase - t)
+			}
+
+			out = append(out, punycodeDigit(q))
+			bias = punycodeAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+
+		delta++
+		n++
+	}
+
+	return string(out), nil
+}
+
+func punycodeAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punycodeDamp
+	} else {
+		delta /= 2
+	}
+
+	delta += delta / numPoints
+	k := 0
+	for delta > ((punycodeBase-punycodeTMin)*punycodeTMax)/2 {
+		delta /= punycodeBase - punycodeTMin
+		k += punycodeBase
+	}
+
+	return k + (punycodeBase-punycodeTMin+1)*delta/(delta+punycodeSkew)
+}
+
+func punycodeDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+
+	return byte('0' + d - 26)
+}
@@ -0,0 +1,59 @@
+package hashcache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeResource(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		in  string
+		out string
+	}{
+		{in: "User@Example.com", out: "user@example.com"},
+		{in: "user@Bücher.example.", out: "user@xn--bcher-kva.example"},
+		{in: "MÜNCHEN.de", out: "xn--mnchen-3ya.de"},
+		{in: "::ffff:127.0.0.1", out: "127.0.0.1"},
+		{in: "[2001:DB8::0001]:443", out: "[2001:db8::1]:443"},
+		{in: "opaque resource", out: "opaque resource"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.in, func(t *testing.T) {
+			out, err := NormalizeResource(tc.in)
+			require.NoError(t, err)
+			assert.Equal(t, tc.out, out)
+		})
+	}
+
+	t.Run("verifier matches normalized resources", func(t *testing.T) {
+		v := NewVerifier(WithResourceNormalizer(NormalizeResource))
+		assert.NoError(t, v.MatchResource("user@example.com", "User@Example.COM"))
+		assert.ErrorIs(t, NewVerifier().MatchResource("user@example.com", "User@Example.COM"), ErrResourceMismatch)
+	})
+}
+
+func TestCanonicalPath(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		path string
+		want string
+	}{
+		{path: "", want: "/"},
+		{path: "/", want: "/"},
+		{path: "/orders/", want: "/orders"},
+		{path: "//orders//42", want: "/orders/42"},
+		{path: "/orders/../admin/./users", want: "/admin/users"},
+		{path: "orders", want: "/orders"},
+		{path: "/../..", want: "/"},
+	}
+
+	for _, tc := range tt {
+		assert.Equal(t, tc.want, CanonicalPath(tc.path), tc.path)
+	}
+}
@@ -0,0 +1,300 @@
+package hashcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultNotifyBatchSize       = 100
+	defaultNotifyFlushInterval   = time.Second
+	defaultNotifyQueueSize       = 4096
+	defaultNotifyDeliveryTimeout = 5 * time.Second
+)
+
+var ErrWebhookFailed = newError(CodeWebhookFailed, "webhook delivery failed")
+
+// NotificationEvent is the AuditRecord as delivered to the sinks
+type NotificationEvent struct {
+	Time      time.Time     `json:"time"`
+	StampKey  string        `json:"stamp_key,omitempty"`
+	Resource  string        `json:"resource,omitempty"`
+	ClientKey string        `json:"client_key"`
+	Tenant    string        `json:"tenant,omitempty"`
+	Decision  AuditDecision `json:"decision"`
+	Reason    string        `json:"reason,omitempty"`
+	Latency   Duration      `json:"latency"`
+	Shadow    bool          `json:"shadow,omitempty"`
+}
+
+// NotificationSink receives the batches of events of a Notifier
+type NotificationSink interface {
+	Deliver(ctx context.Context, events []NotificationEvent) error
+}
+
+// NotificationSinkFunc adapts a function to the NotificationSink interface
+type NotificationSinkFunc func(ctx context.Context, events []NotificationEvent) error
+
+func (f NotificationSinkFunc) Deliver(ctx context.Context, events []NotificationEvent) error {
+	return f(ctx, events)
+}
+
+// WebhookSink posts the batches as a JSON array to the url,
+// any status but 2xx fails the delivery
+func WebhookSink(client *http.Client, url string) NotificationSink {
+	return NotificationSinkFunc(func(ctx context.Context, events []NotificationEvent) error {
+		body, err := json.Marshal(events)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return errors.Join(ErrWebhookFailed, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("%w: status %d", ErrWebhookFailed, resp.StatusCode)
+		}
+
+		return nil
+	})
+}
+
+// ChannelSink sends the batches to the channel, waiting for
+// the receiver until the delivery times out
+func ChannelSink(ch chan<- []NotificationEvent) NotificationSink {
+	return NotificationSinkFunc(func(ctx context.Context, events []NotificationEvent) error {
+		select {
+		case ch <- events:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+type NotifierConfig struct {
+	// BatchSize flushes the batch as soon as it is reached
+	BatchSize int
+
+	// FlushInterval flushes the incomplete batches
+	FlushInterval time.Duration
+
+	// QueueSize bounds the events waiting for a batch,
+	// the events of a full queue are dropped
+	QueueSize int
+
+	// DeliveryTimeout of a batch
+	DeliveryTimeout time.Duration
+
+	// OnError is called with the failed deliveries, the batch is dropped
+	OnError func(err error)
+}
+
+type NotifierOption func(*NotifierConfig)
+
+func WithNotifyBatchSize(n int) NotifierOption {
+	return func(cfg *NotifierConfig) {
+		cfg.BatchSize = n
+	}
+}
+
+func WithNotifyFlushInterval(d time.Duration) NotifierOption {
+	return func(cfg *NotifierConfig) {
+		cfg.FlushInterval = d
+	}
+}
+
+func WithNotifyQueueSize(n int) NotifierOption {
+	return func(cfg *NotifierConfig) {
+		cfg.QueueSize = n
+	}
+}
+
+func WithNotifyErrorHandler(fn func(err error)) NotifierOption {
+	return func(cfg *NotifierConfig) {
+		cfg.OnError = fn
+	}
+}
+
+// NotifierStats count the events by outcome
+type NotifierStats struct {
+	Delivered uint64 `json:"delivered"`
+	Failed    uint64 `json:"failed"`
+	// Dropped because the queue was full or the notifier closed
+	Dropped uint64 `json:"dropped"`
+}
+
+// Notifier is an Auditor delivering the decisions asynchronously in
+// batches to a sink, e.g. to feed the fraud and abuse pipelines outside
+// the service in near real time. Auditing never blocks the verifier,
+// the events which do not fit the queue are dropped.
+type Notifier struct {
+	cfg  NotifierConfig
+	sink NotificationSink
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan NotificationEvent
+
+	stop    chan struct{}
+	stopped chan struct{}
+
+	delivered atomic.Uint64
+	failed    atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+func NewNotifier(sink NotificationSink, opts ...NotifierOption) *Notifier {
+	cfg := NotifierConfig{
+		BatchSize:       defaultNotifyBatchSize,
+		FlushInterval:   defaultNotifyFlushInterval,
+		QueueSize:       defaultNotifyQueueSize,
+		DeliveryTimeout: defaultNotifyDeliveryTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	cfg.BatchSize = max(cfg.BatchSize, 1)
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultNotifyFlushInterval
+	}
+
+	n := &Notifier{
+		cfg:     cfg,
+		sink:    sink,
+		queue:   make(chan NotificationEvent, max(cfg.QueueSize, 1)),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go n.run()
+	return n
+}
+
+// Audit queues the record for delivery
+func (n *Notifier) Audit(rec AuditRecord) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.closed {
+		n.dropped.Add(1)
+		return
+	}
+
+	select {
+	case n.queue <- notificationEvent(rec):
+	default:
+		n.dropped.Add(1)
+	}
+}
+
+func (n *Notifier) Stats() NotifierStats {
+	return NotifierStats{
+		Delivered: n.delivered.Load(),
+		Failed:    n.failed.Load(),
+		Dropped:   n.dropped.Load(),
+	}
+}
+
+// Close stops accepting events and delivers the queued ones,
+// waiting for the delivery until ctx is done
+func (n *Notifier) Close(ctx context.Context) error {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.stop)
+	}
+	n.mu.Unlock()
+
+	select {
+	case <-n.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (n *Notifier) run() {
+	defer close(n.stopped)
+
+	ticker := time.NewTicker(n.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]NotificationEvent, 0, n.cfg.BatchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			n.deliver(batch)
+			batch = make([]NotificationEvent, 0, n.cfg.BatchSize)
+		}
+	}
+
+	for {
+		select {
+		case ev := <-n.queue:
+			if batch = append(batch, ev); len(batch) >= n.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-n.stop:
+			for {
+				select {
+				case ev := <-n.queue:
+					if batch = append(batch, ev); len(batch) >= n.cfg.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (n *Notifier) deliver(batch []NotificationEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.DeliveryTimeout)
+	defer cancel()
+
+	if err := n.sink.Deliver(ctx, batch); err != nil {
+		n.failed.Add(uint64(len(batch)))
+		if n.cfg.OnError != nil {
+			n.cfg.OnError(err)
+		}
+		return
+	}
+
+	n.delivered.Add(uint64(len(batch)))
+}
+
+func notificationEvent(rec AuditRecord) NotificationEvent {
+	return NotificationEvent{
+		Time:      rec.Time,
+		StampKey:  rec.StampKey,
+		Resource:  rec.Resource,
+		ClientKey: rec.ClientKey,
+		Tenant:    rec.Tenant,
+		Decision:  rec.Decision,
+		Reason:    rec.Reason,
+		Latency:   Duration(rec.Latency),
+		Shadow:    rec.Shadow,
+	}
+}
@@ -0,0 +1,69 @@
+package hashcache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifier_Webhook(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var batches [][]NotificationEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var events []NotificationEvent
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&events))
+
+		mu.Lock()
+		batches = append(batches, events)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	n := NewNotifier(WebhookSink(srv.Client(), srv.URL), WithNotifyBatchSize(2), WithNotifyFlushInterval(time.Hour))
+	for _, decision := range []AuditDecision{AuditAccept, AuditReject, AuditAccept} {
+		n.Audit(AuditRecord{ClientKey: "client", Decision: decision, Latency: time.Millisecond})
+	}
+	require.NoError(t, n.Close(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, batches, 2)
+	assert.Len(t, batches[0], 2)
+	assert.Equal(t, AuditReject, batches[0][1].Decision)
+	assert.Equal(t, Duration(time.Millisecond), batches[1][0].Latency)
+	assert.Equal(t, NotifierStats{Delivered: 3}, n.Stats())
+
+	n.Audit(AuditRecord{})
+	assert.Equal(t, uint64(1), n.Stats().Dropped)
+}
+
+func TestNotifier_Channel(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan []NotificationEvent, 1)
+	n := NewNotifier(ChannelSink(ch), WithNotifyFlushInterval(10*time.Millisecond))
+	v := NewVerifier(WithAuditor(n))
+
+	h := Header{Resource: "127.0.0.1", Algorithm: algSha256}
+	require.Error(t, v.VerifyFor(context.Background(), "client", h))
+
+	select {
+	case events := <-ch:
+		require.Len(t, events, 1)
+		assert.Equal(t, AuditReject, events[0].Decision)
+		assert.Equal(t, "127.0.0.1", events[0].Resource)
+	case <-time.After(time.Second):
+		t.Fatal("the batch was not flushed")
+	}
+
+	require.NoError(t, n.Close(context.Background()))
+}
@@ -2,7 +2,13 @@ package hashcache
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,6 +20,22 @@ type PoolConfig struct {
 	Concurrency   int
 	MaxIterations int
 	Timeout       time.Duration
+	Strategy      SearchStrategy
+
+	// RandomizeCounterOffset starts the search at a random counter
+	RandomizeCounterOffset bool
+
+	// CPUBudget caps the CPU time of the computation, see WithCPUBudget
+	CPUBudget time.Duration
+
+	// Recording receives the decisions of the solve, see WithRecording
+	Recording io.Writer
+
+	// CheckInterval of the context in hashes, see ContextWithCheckInterval
+	CheckInterval int
+
+	// Power state of the host sizing the pool, see WithPowerState
+	Power PowerStateProvider
 }
 
 type ComputeResult struct {
@@ -23,6 +45,31 @@ type ComputeResult struct {
 
 type PoolOption func(*PoolConfig)
 
+// WithRandomSearch makes the pool workers sample random counters
+// instead of searching adjacent counter ranges
+func WithRandomSearch() PoolOption {
+	return func(cfg *PoolConfig) {
+		cfg.Strategy = RandomSearch
+	}
+}
+
+// WithCounterOffsetRandomized starts the search at a random point of
+// the counter space, so that independent processes minting against the
+// same challenge do not duplicate each other's work
+func WithCounterOffsetRandomized() PoolOption {
+	return func(cfg *PoolConfig) {
+		cfg.RandomizeCounterOffset = true
+	}
+}
+
+// WithCheckInterval makes the workers check the context every n hashes,
+// see ContextWithCheckInterval
+func WithCheckInterval(n int) PoolOption {
+	return func(cfg *PoolConfig) {
+		cfg.CheckInterval = n
+	}
+}
+
 func ComputeWithPool(
 	baseCtx context.Context,
 	header Header,
@@ -45,7 +92,46 @@ func ComputeWithPool(
 
 	defer cancel()
 
+	if cfg.CheckInterval > 0 {
+		ctx = ContextWithCheckInterval(ctx, cfg.CheckInterval)
+	}
+
+	if cfg.Power != nil {
+		profile := ProfileFor(cfg.Power.PowerState(ctx), cfg.Concurrency)
+		cfg.Concurrency = profile.Concurrency
+		ctx = ContextWithDutyCycle(ctx, profile.DutyCycle)
+	}
+
+	if cfg.CPUBudget > 0 {
+		var stop context.CancelFunc
+		ctx, stop = withCPUBudget(ctx, cfg.CPUBudget, cfg.Concurrency)
+		defer stop()
+	}
+
 	start := time.Now()
+
+	if cfg.RandomizeCounterOffset {
+		offset, err := randomCounterOffset()
+		if err != nil {
+			return ComputeResult{}, err
+		}
+		header.Counter = offset
+	}
+
+	if _, ok := resolveWorkFunction(header.Algorithm).(hashcashWork); !ok {
+		// only the counter search can be split between workers
+		calc, err := Compute(ctx, header, cfg.MaxIterations)
+		if err != nil {
+			return ComputeResult{}, &ComputeError{Limit: contextCause(ctx, err)}
+		}
+
+		return ComputeResult{Time: time.Since(start), Header: calc}, nil
+	}
+
+	if cfg.Recording != nil {
+		return recordedResult(ctx, header, cfg, start)
+	}
+
 	var wg sync.WaitGroup
 	wg.Add(cfg.Concurrency)
 
@@ -56,32 +142,46 @@ func ComputeWithPool(
 		close(resultCh)
 	}()
 
-	counter := int(header.Counter)
+	counter := header.Counter
+	var exhausted atomic.Bool
+	var progress poolProgress
 
 	for i := 0; i < cfg.Concurrency; i++ {
 		go func(i int) {
 			defer wg.Done()
 
-			chunkSize := cfg.MaxIterations / cfg.Concurrency
-			sincePos := counter + i*chunkSize
-			if i > 0 {
-				sincePos += i
-			}
-
-			untilPos := sincePos + chunkSize
-			if untilPos > cfg.MaxIterations {
-				untilPos = cfg.MaxIterations
+			var calc Header
+			var err error
+			switch {
+			case cfg.Strategy == RandomSearch:
+				calc, err = progress.searchRandom(ctx, header, randomWorkerIterations(cfg))
+			case cfg.MaxIterations <= 0:
+				// workers interleave over the unlimited counter space
+				chunkHeader := header
+				chunkHeader.Counter = counter + uint64(i)
+				calc, err = progress.searchCounter(ctx, chunkHeader, math.MaxUint64, uint64(cfg.Concurrency))
+			default:
+				chunkSize := uint64(cfg.MaxIterations / cfg.Concurrency)
+				sincePos := counter + uint64(i)*chunkSize
+				if i > 0 {
+					sincePos += uint64(i)
+				}
+
+				untilPos := min(sincePos+chunkSize, counter+uint64(cfg.MaxIterations))
+
+				chunkHeader := header
+				chunkHeader.Counter = sincePos
+				calc, err = progress.searchCounter(ctx, chunkHeader, untilPos, 1)
 			}
 
-			chunkHeader := header
-			chunkHeader.Counter = uint64(sincePos)
-
-			calc, err := Compute(ctx, chunkHeader, untilPos)
 			if err != nil {
+				if errors.Is(err, ErrCounterExhausted) {
+					exhausted.Store(true)
+				}
 				return
 			}
 
-			resultCh <- calc
+			sendResult(ctx, resultCh, calc)
 		}(i)
 	}
 
@@ -94,11 +194,56 @@ func ComputeWithPool(
 		}
 	}
 
+	computeErr := &ComputeError{
+		Limit:      ErrTooManyIterations,
+		Iterations: progress.iterations.Load(),
+		Counter:    progress.counter.Load(),
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		computeErr.Limit = context.Cause(ctx)
+	case exhausted.Load():
+		computeErr.Limit = ErrCounterExhausted
+	}
+
+	return computeResult, computeErr
+}
+
+// contextCause replaces the context error with its cause,
+// e.g. ErrCPUBudgetExceeded
+func contextCause(ctx context.Context, err error) error {
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return context.Cause(ctx)
+	}
+
+	return err
+}
+
+// randomCounterOffset leaves enough room above the offset
+// for the counter ranges of the workers not to overflow
+func randomCounterOffset() (uint64, error) {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return 0, errors.Join(ErrRandomFailed, err)
+	}
+
+	return binary.LittleEndian.Uint64(buf[:]) >> 2, nil
+}
+
+// sendResult gives up once the pool is done, so that workers finding
+// a result after the first one do not block forever
+func sendResult(ctx context.Context, resultCh chan<- Header, h Header) {
 	select {
+	case resultCh <- h:
 	case <-ctx.Done():
-		return computeResult, ctx.Err()
-	default:
+	}
+}
+
+func randomWorkerIterations(cfg PoolConfig) int {
+	if cfg.MaxIterations <= 0 {
+		return 0
 	}
 
-	return computeResult, ErrTooManyIterations
+	return max(cfg.MaxIterations/cfg.Concurrency, 1)
 }
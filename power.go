@@ -0,0 +1,121 @@
+package hashcache
+
+import (
+	"context"
+	"time"
+)
+
+// ThermalState of the host, in the levels of the mobile platforms
+type ThermalState int
+
+const (
+	ThermalNominal ThermalState = iota
+	ThermalFair
+	ThermalSerious
+	ThermalCritical
+)
+
+// PowerState of the host as reported by the embedding application
+type PowerState struct {
+	OnBattery bool
+	Thermal   ThermalState
+}
+
+// PowerStateProvider is implemented by the SDKs embedding the solver
+// on mobile and desktop hosts from the signals of the platform
+type PowerStateProvider interface {
+	PowerState(ctx context.Context) PowerState
+}
+
+// PowerStateFunc adapts a function to the PowerStateProvider interface
+type PowerStateFunc func(ctx context.Context) PowerState
+
+func (f PowerStateFunc) PowerState(ctx context.Context) PowerState { return f(ctx) }
+
+// SolvingProfile is the concurrency and the fraction
+// of the time the workers compute hashes
+type SolvingProfile struct {
+	Concurrency int
+	DutyCycle   float64
+}
+
+// ProfileFor the power state, out of the full concurrency: on battery
+// half the workers hash half of the time, under serious thermal
+// pressure a single worker does, and a quarter of the time when critical
+func ProfileFor(s PowerState, concurrency int) SolvingProfile {
+	p := SolvingProfile{Concurrency: max(concurrency, 1), DutyCycle: 1}
+
+	if s.OnBattery {
+		p.Concurrency = max(p.Concurrency/2, 1)
+		p.DutyCycle = 0.5
+	}
+
+	switch s.Thermal {
+	case ThermalFair:
+		p.Concurrency = max(p.Concurrency/2, 1)
+	case ThermalSerious:
+		p.Concurrency = 1
+		p.DutyCycle = min(p.DutyCycle, 0.5)
+	case ThermalCritical:
+		p.Concurrency = 1
+		p.DutyCycle = 0.25
+	}
+
+	return p
+}
+
+// WithPowerState sizes the pool and its duty cycle by the power state
+// of the host at the start of the computation, see ProfileFor
+func WithPowerState(p PowerStateProvider) PoolOption {
+	return func(cfg *PoolConfig) {
+		cfg.Power = p
+	}
+}
+
+type dutyCycleContextKey struct{}
+
+// ContextWithDutyCycle makes Compute and the workers of ComputeWithPool
+// hash only the fraction of the time, resting in between the checks of
+// the context, see ContextWithCheckInterval. One or more is no rest.
+func ContextWithDutyCycle(ctx context.Context, fraction float64) context.Context {
+	return context.WithValue(ctx, dutyCycleContextKey{}, fraction)
+}
+
+// pacer rests a search for the duty cycle of its context,
+// a nil pacer never rests
+type pacer struct {
+	duty  float64
+	since time.Time
+}
+
+func newPacer(ctx context.Context) *pacer {
+	duty, ok := ctx.Value(dutyCycleContextKey{}).(float64)
+	if !ok || duty >= 1 || duty <= 0 {
+		return nil
+	}
+
+	return &pacer{duty: duty, since: time.Now()}
+}
+
+// checkpoint fails with the error of the context,
+// resting for the share of the time worked since the last one
+func (p *pacer) checkpoint(ctx context.Context) error {
+	if err := ctx.Err(); err != nil || p == nil {
+		return err
+	}
+
+	worked := time.Since(p.since)
+	rest := time.Duration(float64(worked) * (1 - p.duty) / p.duty)
+
+	timer := time.NewTimer(rest)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+
+	p.since = time.Now()
+	return nil
+}
@@ -0,0 +1,155 @@
+package hashcache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ChallengeBatch of challenges pre-generated for the resource
+type ChallengeBatch struct {
+	Resource string
+	ZeroBits uint8
+	Count    int
+
+	// TTL of the challenges, the challenge template ttl when zero.
+	// It has to cover the time until the spike and stay within
+	// the max ttl of the verifier.
+	TTL time.Duration
+}
+
+// ChallengeQueue holds the challenges pre-generated ahead of anticipated
+// traffic spikes, e.g. ticket sales, so that the issuance does not become
+// the bottleneck under load, see WithChallengeQueue
+type ChallengeQueue struct {
+	// minRemaining life of the challenges handed out
+	minRemaining time.Duration
+
+	mu     sync.Mutex
+	queues map[string][]Header
+}
+
+// NewChallengeQueue handing out the challenges with at least
+// minRemaining of their ttl left, the others are dropped
+func NewChallengeQueue(minRemaining time.Duration) *ChallengeQueue {
+	return &ChallengeQueue{minRemaining: minRemaining, queues: make(map[string][]Header)}
+}
+
+// WithChallengeQueue issues the challenges pre-generated by Pregenerate
+// before minting new ones
+func WithChallengeQueue(q *ChallengeQueue) MiddlewareOption {
+	return func(cfg *MiddlewareConfig) {
+		cfg.ChallengeQueue = q
+	}
+}
+
+// Len is the number of the queued challenges, the expired ones included
+func (q *ChallengeQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := 0
+	for _, queue := range q.queues {
+		n += len(queue)
+	}
+
+	return n
+}
+
+func (q *ChallengeQueue) push(key string, hs []Header) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.queues[key] = append(q.queues[key], hs...)
+}
+
+// requeue the challenge popped but not issued in the end, first in line
+func (q *ChallengeQueue) requeue(key string, h Header) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.queues[key] = append([]Header{h}, q.queues[key]...)
+}
+
+// pop the oldest challenge of the key with enough life left
+func (q *ChallengeQueue) pop(key string) (Header, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	deadline := clock().Add(q.minRemaining).UnixNano()
+	queue := q.queues[key]
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+
+		if h.Expiration >= deadline {
+			q.queues[key] = queue
+			return h, true
+		}
+	}
+
+	delete(q.queues, key)
+	return Header{}, false
+}
+
+func challengeQueueKey(tenant, resource string, zeroBits uint8) string {
+	return tenant + "\x00" + resource + "\x00" + strconv.Itoa(int(zeroBits))
+}
+
+// Pregenerate signs and records the batch of challenges for the tenant
+// of the context and queues them, the middleware issues them to the
+// requests of the resource needing the zero bits of the batch
+func (m *Middleware) Pregenerate(ctx context.Context, batch ChallengeBatch) error {
+	if m.cfg.ChallengeQueue == nil || batch.Count <= 0 {
+		return nil
+	}
+
+	ttl := batch.TTL
+	if ttl <= 0 {
+		ttl = m.cfg.Challenge.TTL
+	}
+
+	hs := make([]Header, 0, batch.Count)
+	for i := 0; i < batch.Count; i++ {
+		h, err := m.newChallenge(ctx, batch.Resource, batch.ZeroBits, ttl)
+		if err != nil {
+			return err
+		}
+
+		if err := m.cfg.Verifier.RecordChallenge(ctx, h); err != nil {
+			return err
+		}
+
+		hs = append(hs, h)
+	}
+
+	m.cfg.ChallengeQueue.push(m.challengeQueueKey(ctx, batch.Resource, batch.ZeroBits), hs)
+	return nil
+}
+
+// queuedChallenge pre-generated for the resource, if any
+func (m *Middleware) queuedChallenge(ctx context.Context, resource string, zeroBits uint8) (Header, bool) {
+	if m.cfg.ChallengeQueue == nil {
+		return Header{}, false
+	}
+
+	return m.cfg.ChallengeQueue.pop(m.challengeQueueKey(ctx, resource, zeroBits))
+}
+
+// requeueChallenge popped by queuedChallenge but not issued
+func (m *Middleware) requeueChallenge(ctx context.Context, resource string, zeroBits uint8, h Header) {
+	m.cfg.ChallengeQueue.requeue(m.challengeQueueKey(ctx, resource, zeroBits), h)
+}
+
+// challengeQueueKey of the resource in the normalized form the
+// challenges are minted for, so that its variants share the queue
+func (m *Middleware) challengeQueueKey(ctx context.Context, resource string, zeroBits uint8) string {
+	if n := m.cfg.Verifier.cfg.ResourceNormalizer; n != nil {
+		if normalized, err := n(resource); err == nil {
+			resource = normalized
+		}
+	}
+
+	return challengeQueueKey(TenantFromContext(ctx), resource, zeroBits)
+}
@@ -0,0 +1,91 @@
+package hashcache
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxStampLength is the longest stamp string accepted by Prevalidate
+const MaxStampLength = 4096
+
+// Prevalidate checks the length, the number of fields, the expiration
+// and the bounds of the difficulty of the stamp string without decoding
+// nor hashing it, so that obviously bad stamps are shed cheaply. A stamp
+// passing it still has to be verified.
+func Prevalidate(raw string) error {
+	return (&VerifierPolicy{}).prevalidate(raw, 0, nil)
+}
+
+// prevalidate the stamp string against the policy and the zero bits
+// required on top of it, the resource being normalized by n when set
+func (p *VerifierPolicy) prevalidate(raw string, zeroBits uint8, n ResourceNormalizer) error {
+	if len(raw) > MaxStampLength {
+		return fmt.Errorf("%w: %d bytes, at most %d allowed", ErrInvalidHeaderString, len(raw), MaxStampLength)
+	}
+
+	tokens := strings.Split(raw, headerStringSeparator)
+
+	// the zero bits of the version 0 are implied by the hash
+	if tokens[0] == "0" {
+		if len(tokens) != 4 {
+			return ErrInvalidHeaderString
+		}
+
+		expiration, ok := parseSpecDate(tokens[1])
+		if !ok {
+			return fmt.Errorf("%w: invalid date '%s'", ErrInvalidHeaderString, tokens[1])
+		}
+
+		if !p.AcceptsAlgorithm(algSha1) {
+			return fmt.Errorf("%w: '%s'", ErrUnsupportedAlgorithm, algSha1)
+		}
+
+		if err := p.checkWireResource(tokens[2], true, n); err != nil {
+			return err
+		}
+
+		return p.checkExpiration(Header{Expiration: expiration})
+	}
+
+	if len(tokens) < 7 || len(tokens) > 8 {
+		return ErrInvalidHeaderString
+	}
+
+	bits, err := strconv.ParseUint(tokens[1], 10, 8)
+	if err != nil {
+		return fmt.Errorf("%w: invalid zero bits '%s'", ErrInvalidHeaderString, tokens[1])
+	}
+
+	alg := strings.ToLower(tokens[4])
+	expiration, err := strconv.ParseInt(tokens[2], 10, 64)
+	if isSpecFormat(tokens) {
+		alg = algSha1
+		bits /= specBitsPerZeroBit
+		expiration, _ = parseSpecDate(tokens[2])
+	} else if err != nil {
+		return fmt.Errorf("%w: invalid expiration '%s'", ErrInvalidHeaderString, tokens[2])
+	}
+
+	if !isSupportedAlgorithm(alg) {
+		return fmt.Errorf("%w: unsupported algorithm '%s'", ErrInvalidHeaderString, alg)
+	}
+
+	if err := p.checkWireResource(tokens[3], isSpecFormat(tokens), n); err != nil {
+		return err
+	}
+
+	if !p.AcceptsAlgorithm(alg) {
+		return fmt.Errorf("%w: '%s'", ErrUnsupportedAlgorithm, alg)
+	}
+
+	if required := max(p.MinZeroBitsFor(alg), zeroBits); uint8(bits) < required {
+		return fmt.Errorf("%w: got %d, want at least %d", ErrInsufficientBits, bits, required)
+	}
+
+	if err := p.checkMaxZeroBits(alg, uint8(bits)); err != nil {
+		return err
+	}
+
+	return p.checkExpiration(Header{Expiration: expiration})
+}
@@ -0,0 +1,89 @@
+package hashcache
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+const problemContentType = "application/problem+json"
+
+// problemErrors are the rejection reasons the problem responses
+// are coded by, in the order they are matched
+var problemErrors = []*Error{
+	ErrMissingStamp,
+	ErrInvalidHeaderString,
+	ErrResourceMismatch,
+	ErrResourceNotAllowed,
+	ErrInsufficientBits,
+	ErrUnsupportedAlgorithm,
+	ErrRandTooShort,
+	ErrHeaderExpired,
+	ErrExpirationTooFar,
+	ErrInvalidProof,
+	ErrStampSpent,
+	ErrRevoked,
+	ErrBrokenChain,
+	ErrInvalidChallengeSignature,
+	ErrBodyMismatch,
+	ErrBodyTooLarge,
+	ErrUnknownChallenge,
+	ErrImplausibleReport,
+}
+
+// Problem is the RFC 7807 body of the middleware rejections,
+// extended with what the client needs to recover
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+
+	// Code of the rejection reason, e.g. "stamp_expired"
+	Code string `json:"code"`
+
+	// RequiredZeroBits and Challenge of the next attempt
+	RequiredZeroBits uint8  `json:"required_bits,omitempty"`
+	Challenge        string `json:"challenge,omitempty"`
+
+	// RetryAfter is the number of seconds a banned client must wait
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+func newProblem(status int, code string, err error) Problem {
+	p := Problem{
+		Type:   "urn:hashcash:problem:" + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+	}
+
+	if err != nil {
+		p.Detail = err.Error()
+	}
+
+	return p
+}
+
+// problemCode of the rejection reason, "rejected" for the unknown ones
+func problemCode(err error) string {
+	for _, reason := range problemErrors {
+		if errors.Is(err, reason) {
+			return string(reason.Code)
+		}
+	}
+
+	return "rejected"
+}
+
+func writeProblem(w http.ResponseWriter, p Problem) {
+	if p.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(p.RetryAfter))
+	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
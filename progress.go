@@ -0,0 +1,136 @@
+package hashcache
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+const (
+	// contextCheckInterval is the default number of hashes
+	// tried between the checks of the context
+	contextCheckInterval = 1 << 10
+
+	// maxContextCheckInterval bounds the cancellation latency
+	maxContextCheckInterval = 1 << 16
+)
+
+type checkIntervalContextKey struct{}
+
+// ContextWithCheckInterval makes Compute and the workers of ComputeWithPool
+// check the context every n hashes instead of the default 1024. The check
+// costs a fraction of a hash, so larger intervals raise the throughput,
+// while the cancellation latency grows to n hashes per worker. The interval
+// is capped at 65536 hashes.
+func ContextWithCheckInterval(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, checkIntervalContextKey{}, uint64(min(max(n, 1), maxContextCheckInterval)))
+}
+
+// checkInterval of the context, see ContextWithCheckInterval
+func checkInterval(ctx context.Context) uint64 {
+	if n, ok := ctx.Value(checkIntervalContextKey{}).(uint64); ok {
+		return n
+	}
+
+	return contextCheckInterval
+}
+
+// ComputeError tells which limit stopped ComputeWithPool and how far
+// the search got, so that the caller can decide whether to retry with
+// more budget, e.g. from the counter after Counter
+type ComputeError struct {
+	// Limit is ErrTooManyIterations, ErrCounterExhausted or the cause of
+	// the context, e.g. context.DeadlineExceeded or ErrCPUBudgetExceeded
+	Limit error
+
+	// Iterations completed by all the workers
+	Iterations uint64
+
+	// Counter is the highest counter tried by the sequential search,
+	// zero for the random search
+	Counter uint64
+}
+
+func (e *ComputeError) Error() string {
+	return fmt.Sprintf("%s after %d iterations, highest counter %d", e.Limit, e.Iterations, e.Counter)
+}
+
+func (e *ComputeError) Unwrap() error {
+	return e.Limit
+}
+
+// poolProgress is shared by the workers of the pool
+type poolProgress struct {
+	iterations atomic.Uint64
+	counter    atomic.Uint64
+}
+
+func (p *poolProgress) add(iterations, counter uint64) {
+	p.iterations.Add(iterations)
+	for {
+		highest := p.counter.Load()
+		if counter <= highest || p.counter.CompareAndSwap(highest, counter) {
+			return
+		}
+	}
+}
+
+// searchCounter tries the counters up to until with the stride,
+// recording the progress of the search
+func (p *poolProgress) searchCounter(ctx context.Context, h Header, until, stride uint64) (Header, error) {
+	var done, last uint64
+	defer func() { p.add(done, last) }()
+
+	interval, pace := checkInterval(ctx), newPacer(ctx)
+	for h.Counter <= until {
+		if done%interval == 0 {
+			if err := pace.checkpoint(ctx); err != nil {
+				return Header{}, err
+			}
+		}
+
+		last = h.Counter
+		done++
+		if h = h.memoized(); h.Valid() {
+			return h, nil
+		}
+
+		if h.Counter > math.MaxUint64-stride {
+			return Header{}, ErrCounterExhausted
+		}
+
+		h.Counter += stride
+	}
+
+	return Header{}, ErrTooManyIterations
+}
+
+// searchRandom samples at most maxIterations random counters,
+// zero or less meaning no limit
+func (p *poolProgress) searchRandom(ctx context.Context, h Header, maxIterations int) (Header, error) {
+	rng, err := newSearchRand()
+	if err != nil {
+		return Header{}, err
+	}
+
+	var done uint64
+	defer func() { p.add(done, 0) }()
+
+	interval, pace := checkInterval(ctx), newPacer(ctx)
+	for maxIterations <= 0 || done < uint64(maxIterations) {
+		if done%interval == 0 {
+			if err := pace.checkpoint(ctx); err != nil {
+				return Header{}, err
+			}
+		}
+
+		done++
+		h.Counter = rng.Uint64()
+		if h = h.memoized(); h.Valid() {
+			return h, nil
+		}
+	}
+
+	return Header{}, ErrTooManyIterations
+}
@@ -0,0 +1,7 @@
+//go:build race
+
+package hashcache
+
+// raceEnabled tells the allocation counts are off, the race
+// detector allocating on its own
+const raceEnabled = true
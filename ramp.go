@@ -0,0 +1,212 @@
+package hashcache
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRampWindow      = 5
+	defaultRampLowSuccess  = 0.5
+	defaultRampHighSuccess = 0.9
+
+	// rampSmoothing is the weight of the latest observation
+	// in the moving averages of a client
+	rampSmoothing = 0.2
+)
+
+// RampState of a client as observed by a RampEscalation
+type RampState struct {
+	ZeroBits uint8
+
+	// SuccessRate and Interval are the moving averages of the outcomes
+	// of the stamps and of the time between them
+	SuccessRate float64
+	Interval    time.Duration
+
+	// SinceChange is the number of outcomes since the zero bits changed
+	SinceChange int
+	LastSeen    time.Time
+}
+
+// RampStore persists the ramp states by client key
+type RampStore interface {
+	Load(key string) (RampState, bool, error)
+	Save(key string, state RampState) error
+}
+
+type RampConfig struct {
+	// MinZeroBits and MaxZeroBits bound the ramp
+	MinZeroBits uint8
+	MaxZeroBits uint8
+
+	// Window is the number of outcomes between the changes of the zero bits
+	Window int
+
+	// The zero bits go up below LowSuccessRate
+	// and down from HighSuccessRate
+	LowSuccessRate  float64
+	HighSuccessRate float64
+
+	// FastInterval between the outcomes of a client ramps it up
+	// whatever its success rate, zero ignores the cadence
+	FastInterval time.Duration
+}
+
+type RampOption func(*RampConfig)
+
+func WithRampBounds(minZeroBits, maxZeroBits uint8) RampOption {
+	return func(cfg *RampConfig) {
+		cfg.MinZeroBits = minZeroBits
+		cfg.MaxZeroBits = maxZeroBits
+	}
+}
+
+func WithRampWindow(n int) RampOption {
+	return func(cfg *RampConfig) {
+		cfg.Window = n
+	}
+}
+
+func WithRampSuccessRates(low, high float64) RampOption {
+	return func(cfg *RampConfig) {
+		cfg.LowSuccessRate = low
+		cfg.HighSuccessRate = high
+	}
+}
+
+// WithRampCadence ramps up the clients sending stamps faster than
+// the interval on average
+func WithRampCadence(fastInterval time.Duration) RampOption {
+	return func(cfg *RampConfig) {
+		cfg.FastInterval = fastInterval
+	}
+}
+
+// RampEscalation starts the unknown clients at a low difficulty and ramps
+// their zero bits up or down one at a time by their success rate and
+// cadence, giving a smoother onboarding than a fixed difficulty. The states
+// are persisted in the store, clients the state of which can not be loaded
+// are required the initial zero bits.
+type RampEscalation struct {
+	mu      sync.Mutex
+	store   RampStore
+	initial uint8
+	cfg     RampConfig
+}
+
+func NewRampEscalation(store RampStore, initial uint8, opts ...RampOption) *RampEscalation {
+	cfg := RampConfig{
+		MinZeroBits:     initial,
+		MaxZeroBits:     math.MaxUint8,
+		Window:          defaultRampWindow,
+		LowSuccessRate:  defaultRampLowSuccess,
+		HighSuccessRate: defaultRampHighSuccess,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &RampEscalation{store: store, initial: initial, cfg: cfg}
+}
+
+func (r *RampEscalation) Required(clientKey string) Escalation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, ok, err := r.store.Load(clientKey)
+	if err != nil || !ok {
+		return Escalation{ZeroBits: r.initial}
+	}
+
+	return Escalation{ZeroBits: state.ZeroBits}
+}
+
+func (r *RampEscalation) Failure(clientKey string) { r.observe(clientKey, false) }
+func (r *RampEscalation) Success(clientKey string) { r.observe(clientKey, true) }
+
+func (r *RampEscalation) observe(clientKey string, success bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := clock()
+	outcome := 0.0
+	if success {
+		outcome = 1
+	}
+
+	state, ok, err := r.store.Load(clientKey)
+	if err != nil {
+		return
+	}
+
+	if !ok {
+		state = RampState{ZeroBits: r.initial, SuccessRate: outcome}
+	} else {
+		state.SuccessRate += rampSmoothing * (outcome - state.SuccessRate)
+
+		interval := now.Sub(state.LastSeen)
+		if state.Interval == 0 {
+			state.Interval = interval
+		} else {
+			state.Interval += time.Duration(rampSmoothing * float64(interval-state.Interval))
+		}
+	}
+
+	state.LastSeen = now
+	state.SinceChange++
+
+	if state.SinceChange >= r.cfg.Window {
+		bits := r.ramp(state)
+		if bits != state.ZeroBits {
+			state.ZeroBits = bits
+			state.SinceChange = 0
+		}
+	}
+
+	_ = r.store.Save(clientKey, state)
+}
+
+// ramp the zero bits of the client one step
+func (r *RampEscalation) ramp(state RampState) uint8 {
+	fast := r.cfg.FastInterval > 0 && state.Interval > 0 && state.Interval < r.cfg.FastInterval
+	switch {
+	case state.SuccessRate < r.cfg.LowSuccessRate || fast:
+		if state.ZeroBits < r.cfg.MaxZeroBits {
+			return state.ZeroBits + 1
+		}
+	case state.SuccessRate >= r.cfg.HighSuccessRate:
+		if state.ZeroBits > r.cfg.MinZeroBits {
+			return state.ZeroBits - 1
+		}
+	}
+
+	return state.ZeroBits
+}
+
+type MemoryRampStore struct {
+	mu     sync.RWMutex
+	states map[string]RampState
+}
+
+func NewMemoryRampStore() *MemoryRampStore {
+	return &MemoryRampStore{states: make(map[string]RampState)}
+}
+
+func (s *MemoryRampStore) Load(key string) (RampState, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state, ok := s.states[key]
+	return state, ok, nil
+}
+
+func (s *MemoryRampStore) Save(key string, state RampState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.states[key] = state
+	return nil
+}
@@ -0,0 +1,138 @@
+package hashcache
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+var ErrReplayMismatch = newError(CodeReplayMismatch, "replay mismatch")
+
+// replayHeader is the first line of a recording
+type replayHeader struct {
+	Header string `json:"header"`
+}
+
+// ReplayDecision is a hash tried during a recorded solve
+type ReplayDecision struct {
+	Rand    string `json:"rand"`
+	Counter uint64 `json:"counter"`
+	Hash    string `json:"hash"`
+}
+
+// ReplayResult of a recording replayed by this build
+type ReplayResult struct {
+	Decisions int
+
+	// Header of the last decision and whether it solves the work
+	Header Header
+	Valid  bool
+}
+
+// WithRecording writes every decision of the solve to w as JSON lines,
+// the header first, then the rand, the counter and the hash of every
+// attempt. The pool searches with a single worker then, so that the
+// recording is deterministic. Work functions other than the counter
+// search are not recorded. See Replay.
+func WithRecording(w io.Writer) PoolOption {
+	return func(cfg *PoolConfig) {
+		cfg.Recording = w
+	}
+}
+
+// computeRecorded searches the counters sequentially,
+// recording every decision
+func computeRecorded(ctx context.Context, h Header, cfg PoolConfig) (Header, error) {
+	w := bufio.NewWriter(cfg.Recording)
+	enc := json.NewEncoder(w)
+
+	if err := enc.Encode(replayHeader{Header: h.String()}); err != nil {
+		return Header{}, err
+	}
+
+	solved, err := recordSearch(ctx, h, cfg.MaxIterations, enc)
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+
+	return solved, err
+}
+
+func recordSearch(ctx context.Context, h Header, maxIterations int, enc *json.Encoder) (Header, error) {
+	for i := 0; maxIterations <= 0 || i < maxIterations; i++ {
+		if ctx.Err() != nil {
+			return Header{}, ctx.Err()
+		}
+
+		h = h.memoized()
+		if err := enc.Encode(ReplayDecision{Rand: h.Rand, Counter: h.Counter, Hash: h.Hash()}); err != nil {
+			return Header{}, err
+		}
+
+		if h.Valid() {
+			return h, nil
+		}
+
+		if h.Counter == math.MaxUint64 {
+			return Header{}, ErrCounterExhausted
+		}
+
+		h.Counter++
+	}
+
+	return Header{}, ErrTooManyIterations
+}
+
+// Replay recomputes the decisions of a recording made with WithRecording,
+// failing with ErrReplayMismatch at the first hash this build computes
+// differently, e.g. to reproduce verification mismatches between the
+// builds of a client and a server.
+func Replay(r io.Reader) (ReplayResult, error) {
+	dec := json.NewDecoder(r)
+
+	var rh replayHeader
+	if err := dec.Decode(&rh); err != nil {
+		return ReplayResult{}, fmt.Errorf("%w: malformed recording: %s", ErrReplayMismatch, err.Error())
+	}
+
+	h, err := parseWire(rh.Header)
+	if err != nil {
+		return ReplayResult{}, err
+	}
+
+	var result ReplayResult
+	for {
+		var d ReplayDecision
+		if err := dec.Decode(&d); errors.Is(err, io.EOF) {
+			return result, nil
+		} else if err != nil {
+			return result, fmt.Errorf("%w: malformed decision %d: %s", ErrReplayMismatch, result.Decisions, err.Error())
+		}
+
+		h.Rand, h.Counter = d.Rand, d.Counter
+		h = h.memoized()
+		if got := h.Hash(); got != d.Hash {
+			return result, fmt.Errorf("%w: decision %d with counter %d hashed to %s, recorded %s",
+				ErrReplayMismatch, result.Decisions, d.Counter, got, d.Hash)
+		}
+
+		result.Decisions++
+		result.Header = h
+		result.Valid = h.Valid()
+	}
+}
+
+// recordedResult wraps the outcome of a recorded solve
+func recordedResult(ctx context.Context, h Header, cfg PoolConfig, start time.Time) (ComputeResult, error) {
+	solved, err := computeRecorded(ctx, h, cfg)
+	if err != nil {
+		return ComputeResult{}, &ComputeError{Limit: contextCause(ctx, err)}
+	}
+
+	return ComputeResult{Time: time.Since(start), Header: solved}, nil
+}
@@ -0,0 +1,118 @@
+package hashcache
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	solveTimeExtName       = "st"
+	solveIterationsExtName = "it"
+
+	// maxReportedHashRate is far above any single client, hashes per second
+	maxReportedHashRate = 1e11
+
+	// reportIterationsTail bounds the reported iterations in expected
+	// hashes of the zero bits, exceeding it has a chance of e^-64
+	reportIterationsTail = 64
+)
+
+var ErrImplausibleReport = newError(CodeImplausibleReport, "implausible solve report")
+
+// SolveReport is the solve time and the number of iterations measured
+// by a client. The extension is hashed with the rest of the stamp, so
+// a stamp reports the previous solve of the client, of the same difficulty.
+type SolveReport struct {
+	Time       time.Duration
+	Iterations uint64
+}
+
+// WithSolveReport puts the report in the "st" (milliseconds)
+// and "it" entries of the extension, before the work is computed
+func (h Header) WithSolveReport(r SolveReport) Header {
+	h.Ext = withExtValue(h.Ext, solveTimeExtName, strconv.FormatInt(r.Time.Milliseconds(), 10))
+	h.Ext = withExtValue(h.Ext, solveIterationsExtName, strconv.FormatUint(r.Iterations, 10))
+	h.digest = digestMemo{}
+	return h
+}
+
+// SolveReportOf the stamp, malformed reports are reported as missing
+func SolveReportOf(h Header) (SolveReport, bool) {
+	st, ok := extValue(h.Ext, solveTimeExtName)
+	if !ok {
+		return SolveReport{}, false
+	}
+
+	it, ok := extValue(h.Ext, solveIterationsExtName)
+	if !ok {
+		return SolveReport{}, false
+	}
+
+	ms, err := strconv.ParseUint(st, 10, 32)
+	if err != nil {
+		return SolveReport{}, false
+	}
+
+	iterations, err := strconv.ParseUint(it, 10, 64)
+	if err != nil {
+		return SolveReport{}, false
+	}
+
+	return SolveReport{Time: time.Duration(ms) * time.Millisecond, Iterations: iterations}, true
+}
+
+// WithSolveReports validates the solve reports of the stamps and feeds
+// the plausible ones of the accepted stamps to the controller, and to the
+// histogram when there is one. Stamps with implausible reports are
+// rejected with ErrImplausibleReport.
+func WithSolveReports(c *DifficultyController) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.SolveReports = c
+	}
+}
+
+// checkReport of the stamp for plausibility: the iterations must
+// fit the zero bits and the hash rate must be humanly possible
+func (v *Verifier) checkReport(h Header) error {
+	if v.cfg.SolveReports == nil {
+		return nil
+	}
+
+	r, ok := SolveReportOf(h)
+	if !ok {
+		return nil
+	}
+
+	if r.Time <= 0 || r.Iterations == 0 {
+		return fmt.Errorf("%w: %d iterations in %s", ErrImplausibleReport, r.Iterations, r.Time)
+	}
+
+	if bound := reportIterationsTail * expectedHashes(h.ZeroBits); float64(r.Iterations) > min(bound, math.MaxUint64) {
+		return fmt.Errorf("%w: %d iterations for %d zero bits", ErrImplausibleReport, r.Iterations, h.ZeroBits)
+	}
+
+	if rate := float64(r.Iterations) / r.Time.Seconds(); rate > maxReportedHashRate {
+		return fmt.Errorf("%w: %.0f hashes per second", ErrImplausibleReport, rate)
+	}
+
+	return nil
+}
+
+// observeReport of the accepted stamp
+func (v *Verifier) observeReport(h Header) {
+	if v.cfg.SolveReports == nil {
+		return
+	}
+
+	r, ok := SolveReportOf(h)
+	if !ok {
+		return
+	}
+
+	v.cfg.SolveReports.Observe(r.Time)
+	if v.cfg.Histogram != nil {
+		v.cfg.Histogram.ObserveSolveTime(r.Time)
+	}
+}
@@ -0,0 +1,131 @@
+package hashcache
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const resourceWildcard = "*"
+
+var ErrResourceNotAllowed = newError(CodeResourceNotAllowed, "resource not allowed")
+
+// WithAllowedResources accepts only the stamps of the resources matching
+// one of the patterns, so that the verifier is not an oracle for the
+// resources it does not protect. A pattern is an exact resource or has
+// * wildcards matching any run of characters, e.g. "*.example.com".
+func WithAllowedResources(patterns ...string) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.AllowResources = append(cfg.AllowResources, patterns...)
+	}
+}
+
+// WithDeniedResources rejects the stamps of the resources matching
+// one of the patterns, even the allowed ones
+func WithDeniedResources(patterns ...string) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.DenyResources = append(cfg.DenyResources, patterns...)
+	}
+}
+
+// AcceptsResource tells whether the stamps of the resource are accepted
+func (p *VerifierPolicy) AcceptsResource(resource string) bool {
+	for _, pattern := range p.DenyResources {
+		if matchResource(pattern, resource) {
+			return false
+		}
+	}
+
+	if len(p.AllowResources) == 0 {
+		return true
+	}
+
+	for _, pattern := range p.AllowResources {
+		if matchResource(pattern, resource) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *VerifierPolicy) filtersResources() bool {
+	return len(p.AllowResources) > 0 || len(p.DenyResources) > 0
+}
+
+// checkResource of the header, normalized by n when set
+func (p *VerifierPolicy) checkResource(h Header, n ResourceNormalizer) error {
+	if !p.filtersResources() {
+		return nil
+	}
+
+	resource, err := h.rawResource()
+	if err != nil {
+		return fmt.Errorf("%w: invalid base64 encoded resource '%s'", ErrInvalidHeaderString, h.Resource)
+	}
+
+	return p.checkRawResource(resource, n)
+}
+
+// checkWireResource checks the resource token of the stamp string,
+// decoding the base64 resource of the format of this library
+func (p *VerifierPolicy) checkWireResource(token string, spec bool, n ResourceNormalizer) error {
+	if !p.filtersResources() || spec {
+		return p.checkRawResource(token, n)
+	}
+
+	resource, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return fmt.Errorf("%w: invalid base64 encoded resource '%s'", ErrInvalidHeaderString, token)
+	}
+
+	return p.checkRawResource(string(resource), n)
+}
+
+// checkRawResource filters the resource in the form MatchResource
+// compares it, so that a variant of a denied resource is denied too
+func (p *VerifierPolicy) checkRawResource(resource string, n ResourceNormalizer) error {
+	if !p.filtersResources() {
+		return nil
+	}
+
+	if n != nil {
+		normalized, err := n(resource)
+		if err != nil {
+			return errors.Join(fmt.Errorf("%w: '%s'", ErrResourceNotAllowed, resource), err)
+		}
+		resource = normalized
+	}
+
+	if !p.AcceptsResource(resource) {
+		return fmt.Errorf("%w: '%s'", ErrResourceNotAllowed, resource)
+	}
+
+	return nil
+}
+
+// matchResource matches the resource against the pattern,
+// where * matches any run of characters
+func matchResource(pattern, resource string) bool {
+	if !strings.Contains(pattern, resourceWildcard) {
+		return pattern == resource
+	}
+
+	parts := strings.Split(pattern, resourceWildcard)
+	if !strings.HasPrefix(resource, parts[0]) {
+		return false
+	}
+	resource = resource[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(resource, part)
+		if i < 0 {
+			return false
+		}
+		resource = resource[i+len(part):]
+	}
+
+	return len(resource) >= len(last) && strings.HasSuffix(resource, last)
+}
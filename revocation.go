@@ -0,0 +1,189 @@
+package hashcache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	revokedStampPrefix    = "revoked:stamp:"
+	revokedRandPrefix     = "revoked:rand:"
+	revokedClientPrefix   = "revoked:client:"
+	revokedResourcePrefix = "revoked:resource:"
+	revokedExpiryPrefix   = "revoked:expiry:"
+
+	// revocationBucket is the granularity of the revocations
+	// by issuance time, which are rounded outwards to it
+	revocationBucket = time.Minute
+
+	// maxRevocationBuckets bounds the keys written by a revocation
+	// by issuance time, a day worth of buckets
+	maxRevocationBuckets = 24 * 60
+)
+
+var (
+	ErrRevoked                  = newError(CodeRevoked, "stamp revoked")
+	ErrRevocationWindowTooLarge = newError(CodeRevocationWindowTooLarge, "revocation window too large")
+)
+
+// RevocationList invalidates stamps before they expire, e.g. when a cache
+// of pre-minted stamps of a client is known to be leaked. Stamps can be
+// revoked one by one, by their rand value, all the stamps of a client key,
+// of a resource or issued within a time window.
+// The revocations are kept in a SpentStampStore until they lapse,
+// which can be shared between the verifier instances.
+type RevocationList struct {
+	store SpentStampStore
+
+	// grace the revocations of the stamps are kept past their expiration,
+	// the largest clock skew and replay grace of the verifiers using it
+	grace atomic.Int64
+}
+
+func NewRevocationList(store SpentStampStore) *RevocationList {
+	l := &RevocationList{store: store}
+	l.grace.Store(int64(DefaultReplayGrace))
+	return l
+}
+
+// RevokeStamp until the stamp expires, past the clock skew
+// and the replay grace the verifiers accept it for
+func (l *RevocationList) RevokeStamp(ctx context.Context, h Header) error {
+	return l.revoke(ctx, revokedStampPrefix+StampKey(h), l.lapse(time.Unix(0, h.Expiration)))
+}
+
+// RevokeRand revokes all the stamps with the rand value until the given time,
+// replacing its earlier revocation
+func (l *RevocationList) RevokeRand(ctx context.Context, rand string, until time.Time) error {
+	return l.revoke(ctx, revokedRandPrefix+rand, until)
+}
+
+// RevokeClient revokes all the stamps presented by the client key until the given time,
+// replacing its earlier revocation
+func (l *RevocationList) RevokeClient(ctx context.Context, clientKey string, until time.Time) error {
+	return l.revoke(ctx, revokedClientPrefix+clientKey, until)
+}
+
+// RevokeResource revokes all the stamps minted for the resource until the given time,
+// replacing its earlier revocation
+func (l *RevocationList) RevokeResource(ctx context.Context, resource string, until time.Time) error {
+	return l.revoke(ctx, revokedResourcePrefix+resource, until)
+}
+
+// RevokeIssued revokes all the stamps issued between from and to with
+// the ttl, e.g. the challenges signed while an issuer key was compromised.
+// Stamps do not carry their issuance time, so the ones expiring between
+// from+ttl and to+ttl are revoked, rounded outwards to the minute. The
+// revocations are written in a single batch when the store supports it,
+// and lapse with the stamps they revoke, past the clock skew and the
+// replay grace the verifiers accept them for.
+func (l *RevocationList) RevokeIssued(ctx context.Context, from, to time.Time, ttl time.Duration) error {
+	// the stamps expired by now past the grace need no revocation
+	first := from.Add(ttl)
+	if now := clock().Add(-time.Duration(l.grace.Load())); first.Before(now) {
+		first = now
+	}
+	first = first.Truncate(revocationBucket)
+	last := to.Add(ttl).Truncate(revocationBucket)
+	if last.Before(first) {
+		return nil
+	}
+
+	if n := last.Sub(first) / revocationBucket; n >= maxRevocationBuckets {
+		return fmt.Errorf("%w: %d minutes, at most %d", ErrRevocationWindowTooLarge, n+1, maxRevocationBuckets)
+	}
+
+	var keys []string
+	var until []time.Time
+	for bucket := first; !bucket.After(last); bucket = bucket.Add(revocationBucket) {
+		keys = append(keys, expiryRevocationKey(bucket))
+		until = append(until, l.lapse(bucket.Add(revocationBucket)))
+	}
+
+	_, err := markSpentBatch(ctx, l.store, keys, until)
+	return err
+}
+
+// ReinstateClient lifts the revocation of the client key
+func (l *RevocationList) ReinstateClient(ctx context.Context, clientKey string) error {
+	return l.store.Delete(ctx, revokedClientPrefix+clientKey)
+}
+
+// Check fails with ErrRevoked when the stamp presented by the client is revoked
+func (l *RevocationList) Check(ctx context.Context, clientKey string, h Header) error {
+	resource, err := h.rawResource()
+	if err != nil {
+		resource = h.Resource
+	}
+
+	checks := []struct {
+		key, what string
+	}{
+		{revokedStampPrefix + StampKey(h), "stamp"},
+		{revokedRandPrefix + h.Rand, "rand '" + h.Rand + "'"},
+		{revokedClientPrefix + clientKey, "client '" + clientKey + "'"},
+		{revokedResourcePrefix + resource, "resource '" + resource + "'"},
+		{expiryRevocationKey(time.Unix(0, h.Expiration)), "issuance time"},
+	}
+
+	for _, c := range checks {
+		revoked, err := l.store.IsSpent(ctx, c.key)
+		if err != nil {
+			return err
+		}
+
+		if revoked {
+			return fmt.Errorf("%w: %s", ErrRevoked, c.what)
+		}
+	}
+
+	return nil
+}
+
+// revoke the key until the time, replacing its earlier revocation
+// which MarkSpent neither overwrites nor extends
+func (l *RevocationList) revoke(ctx context.Context, key string, until time.Time) error {
+	fresh, err := l.store.MarkSpent(ctx, key, until)
+	if err != nil || fresh {
+		return err
+	}
+
+	if err := l.store.Delete(ctx, key); err != nil {
+		return err
+	}
+
+	_, err = l.store.MarkSpent(ctx, key, until)
+	return err
+}
+
+// cover the stamps the policy accepts past their expiration
+// with the revocations written afterwards
+func (l *RevocationList) cover(p *VerifierPolicy) {
+	grace := int64(p.MaxClockSkew + p.ReplayGrace)
+	for {
+		current := l.grace.Load()
+		if grace <= current || l.grace.CompareAndSwap(current, grace) {
+			return
+		}
+	}
+}
+
+// lapse of the revocation of the stamps expiring at expiresAt
+func (l *RevocationList) lapse(expiresAt time.Time) time.Time {
+	return expiresAt.Add(time.Duration(l.grace.Load()))
+}
+
+// expiryRevocationKey of the bucket of the expiration time
+func expiryRevocationKey(expiresAt time.Time) string {
+	return revokedExpiryPrefix + strconv.FormatInt(expiresAt.Truncate(revocationBucket).Unix(), 10)
+}
+
+// WithRevocationList rejects the revoked stamps in VerifyFor and VerifyBatch
+func WithRevocationList(l *RevocationList) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.Revocations = l
+	}
+}
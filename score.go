@@ -0,0 +1,217 @@
+package hashcache
+
+import "time"
+
+const (
+	defaultTargetZeroBits = 5
+	defaultScoreMaxTTL    = 24 * time.Hour
+	defaultSpamThreshold  = 0.3
+	defaultHamThreshold   = 0.7
+)
+
+// Verdict classifies a score against the scorer thresholds
+type Verdict int
+
+const (
+	VerdictSpam Verdict = iota
+	VerdictSuspect
+	VerdictHam
+)
+
+// algorithmStrength weights the algorithms by how much
+// the proof computed with them can be trusted
+var algorithmStrength = map[string]float64{
+	algSha1:      0.5,
+	algSha256:    1,
+	algSha512:    1,
+	algSeqSha256: 1,
+}
+
+// ScoreWeights are the shares of the signals in the score,
+// they are normalized by their sum
+type ScoreWeights struct {
+	Difficulty float64
+	TTL        float64
+	Algorithm  float64
+	Resource   float64
+}
+
+type ScoreConfig struct {
+	Weights ScoreWeights
+
+	// TargetZeroBits is the difficulty earning the full difficulty signal
+	TargetZeroBits uint8
+
+	// MaxTTL beyond which the remaining lifetime of a stamp is suspicious
+	MaxTTL time.Duration
+
+	// Resource the stamps are expected to be minted for,
+	// empty gives the full resource signal to any stamp
+	Resource           string
+	ResourceNormalizer ResourceNormalizer
+
+	// Scores below SpamThreshold are spam, scores
+	// from HamThreshold on are ham, suspect in between
+	SpamThreshold float64
+	HamThreshold  float64
+}
+
+type ScoreOption func(*ScoreConfig)
+
+// Scorer combines the signals of a stamp into a score from 0 to 1,
+// for filters which weight signals rather than reject on a single one.
+type Scorer struct {
+	cfg ScoreConfig
+}
+
+var defaultScorer = NewScorer()
+
+func NewScorer(opts ...ScoreOption) *Scorer {
+	cfg := ScoreConfig{
+		Weights:        ScoreWeights{Difficulty: 0.5, TTL: 0.2, Algorithm: 0.1, Resource: 0.2},
+		TargetZeroBits: defaultTargetZeroBits,
+		MaxTTL:         defaultScoreMaxTTL,
+		SpamThreshold:  defaultSpamThreshold,
+		HamThreshold:   defaultHamThreshold,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return &Scorer{cfg: cfg}
+}
+
+func WithScoreWeights(w ScoreWeights) ScoreOption {
+	return func(cfg *ScoreConfig) {
+		cfg.Weights = w
+	}
+}
+
+func WithTargetZeroBits(zeroBits uint8) ScoreOption {
+	return func(cfg *ScoreConfig) {
+		cfg.TargetZeroBits = zeroBits
+	}
+}
+
+func WithScoreMaxTTL(d time.Duration) ScoreOption {
+	return func(cfg *ScoreConfig) {
+		cfg.MaxTTL = d
+	}
+}
+
+// WithExpectedResource gives a partial resource signal to stamps
+// matching the resource only after normalization
+func WithExpectedResource(resource string, n ResourceNormalizer) ScoreOption {
+	return func(cfg *ScoreConfig) {
+		cfg.Resource = resource
+		cfg.ResourceNormalizer = n
+	}
+}
+
+func WithScoreThresholds(spam, ham float64) ScoreOption {
+	return func(cfg *ScoreConfig) {
+		cfg.SpamThreshold = spam
+		cfg.HamThreshold = ham
+	}
+}
+
+// Score the header with the default scorer
+func Score(h Header, now time.Time) float64 {
+	return defaultScorer.Score(h, now)
+}
+
+// Score the header, expired stamps and stamps with an invalid proof score 0
+func (s *Scorer) Score(h Header, now time.Time) float64 {
+	if !isSupportedAlgorithm(h.Algorithm) || !h.Valid() {
+		return 0
+	}
+
+	return s.scoreVerified(h, now)
+}
+
+// scoreVerified scores the verified header, its proof is not checked again
+func (s *Scorer) scoreVerified(h Header, now time.Time) float64 {
+	ttl := s.ttlSignal(h, now)
+	if ttl == 0 {
+		return 0
+	}
+
+	w := s.cfg.Weights
+	total := w.Difficulty + w.TTL + w.Algorithm + w.Resource
+	if total <= 0 {
+		return 0
+	}
+
+	score := w.Difficulty*s.difficultySignal(h) +
+		w.TTL*ttl +
+		w.Algorithm*algorithmStrength[h.Algorithm] +
+		w.Resource*s.resourceSignal(h)
+
+	return score / total
+}
+
+// Classify the score against the thresholds
+func (s *Scorer) Classify(score float64) Verdict {
+	switch {
+	case score < s.cfg.SpamThreshold:
+		return VerdictSpam
+	case score >= s.cfg.HamThreshold:
+		return VerdictHam
+	default:
+		return VerdictSuspect
+	}
+}
+
+func (s *Scorer) difficultySignal(h Header) float64 {
+	if s.cfg.TargetZeroBits == 0 {
+		return 1
+	}
+
+	return min(float64(h.ZeroBits)/float64(s.cfg.TargetZeroBits), 1)
+}
+
+// ttlSignal is 0 for expired stamps and decays for the stamps
+// expiring later than MaxTTL from now
+func (s *Scorer) ttlSignal(h Header, now time.Time) float64 {
+	remaining := time.Unix(0, h.Expiration).Sub(now)
+	switch {
+	case remaining <= 0:
+		return 0
+	case s.cfg.MaxTTL <= 0 || remaining <= s.cfg.MaxTTL:
+		return 1
+	default:
+		return float64(s.cfg.MaxTTL) / float64(remaining)
+	}
+}
+
+// resourceSignal is 1 for an exact match and 0.5 for a match
+// after normalization
+func (s *Scorer) resourceSignal(h Header) float64 {
+	if s.cfg.Resource == "" {
+		return 1
+	}
+
+	resource := h.Resource
+	if raw, err := h.rawResource(); err == nil {
+		resource = raw
+	}
+
+	if resource == s.cfg.Resource {
+		return 1
+	}
+
+	if n := s.cfg.ResourceNormalizer; n != nil {
+		got, err := n(resource)
+		if err != nil {
+			return 0
+		}
+
+		want, err := n(s.cfg.Resource)
+		if err == nil && got == want {
+			return 0.5
+		}
+	}
+
+	return 0
+}
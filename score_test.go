@@ -0,0 +1,183 @@
+package hashcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScorer_Score(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	h, err := New("User@Example.com", 2, time.Hour, WithAlgorithm(algSha1))
+	require.NoError(t, err)
+	h, err = Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+
+	t.Run("default scorer", func(t *testing.T) {
+		// 0.5*2/5 + 0.2 + 0.1*0.5 + 0.2
+		assert.InDelta(t, 0.65, Score(h, now), 0.001)
+		assert.Zero(t, Score(h, now.Add(2*time.Hour)))
+	})
+
+	t.Run("invalid proof scores zero", func(t *testing.T) {
+		invalid := h
+		invalid.Counter++
+		for invalid.Valid() {
+			invalid.Counter++
+		}
+
+		assert.Zero(t, Score(invalid, now))
+	})
+
+	t.Run("resource match quality", func(t *testing.T) {
+		exact := NewScorer(WithTargetZeroBits(2), WithExpectedResource("User@Example.com", NormalizeEmail))
+		normalized := NewScorer(WithTargetZeroBits(2), WithExpectedResource("user@example.com", NormalizeEmail))
+		other := NewScorer(WithTargetZeroBits(2), WithExpectedResource("other@example.com", NormalizeEmail))
+
+		assert.InDelta(t, 0.95, exact.Score(h, now), 0.001)
+		assert.InDelta(t, 0.85, normalized.Score(h, now), 0.001)
+		assert.InDelta(t, 0.75, other.Score(h, now), 0.001)
+	})
+
+	t.Run("classify", func(t *testing.T) {
+		s := NewScorer(WithScoreThresholds(0.4, 0.8))
+		assert.Equal(t, VerdictSpam, s.Classify(0.2))
+		assert.Equal(t, VerdictSuspect, s.Classify(0.4))
+		assert.Equal(t, VerdictHam, s.Classify(0.8))
+	})
+}
+
+func TestGradeStamp(t *testing.T) {
+	t.Parallel()
+
+	h, err := New("grade@example.com", 1, time.Hour)
+	require.NoError(t, err)
+
+	// searches a stamp the digest of which has exactly two zero bits
+	for {
+		h, err = Compute(context.Background(), h, 0)
+		require.NoError(t, err)
+		if bits, _ := DigestZeroBits(h); bits == 2 {
+			break
+		}
+		h.Counter++
+	}
+
+	assert.Equal(t, GradeStrong, GradeStamp(h, VerifierPolicy{MinZeroBits: 1}))
+	assert.Equal(t, GradeStandard, GradeStamp(h, VerifierPolicy{MinZeroBits: 2}))
+	assert.Equal(t, GradeWeak, GradeStamp(h, VerifierPolicy{MinZeroBits: 3}))
+	assert.Equal(t, GradeStandard, GradeStamp(h, VerifierPolicy{
+		MinZeroBits:          1,
+		AlgorithmMinZeroBits: map[string]uint8{algSha256: 2},
+	}))
+
+	h.Counter++
+	for h.Valid() {
+		h.Counter++
+	}
+	assert.Equal(t, GradeWeak, GradeStamp(h, VerifierPolicy{}), "invalid proofs are weak")
+	assert.Equal(t, "strong", GradeStrong.String())
+}
+
+// countingWork counts the verifications of the stamps
+type countingWork struct {
+	sequentialWork
+	verified *atomic.Int64
+}
+
+func (w countingWork) Verify(h Header) bool {
+	return w.VerifyContext(context.Background(), h)
+}
+
+func (w countingWork) VerifyContext(ctx context.Context, h Header) bool {
+	w.verified.Add(1)
+	return w.sequentialWork.VerifyContext(ctx, h)
+}
+
+func TestGradeStamp_Verified(t *testing.T) {
+	const alg = "counting-seq-sha-256"
+	var verified atomic.Int64
+	RegisterWorkFunction(alg, countingWork{verified: &verified})
+
+	h, err := New("grade@example.com", 4, time.Hour, WithAlgorithm(alg))
+	require.NoError(t, err)
+	h, err = Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+
+	v := NewVerifier(WithAlgorithms(alg))
+	verified.Store(0)
+	h, err = v.verifyAudited(context.Background(), "client", h)
+	require.NoError(t, err)
+	assert.Equal(t, GradeStandard, gradeZeroBits(h, 4))
+	assert.Equal(t, int64(1), verified.Load(), "the grade does not verify the stamp again")
+
+	assert.Equal(t, GradeStandard, GradeStamp(h, VerifierPolicy{MinZeroBits: 4}))
+	assert.Equal(t, int64(2), verified.Load())
+}
+
+func TestLedger_CreditVerified(t *testing.T) {
+	const alg = "counting-seq-sha-256"
+	var verified atomic.Int64
+	RegisterWorkFunction(alg, countingWork{verified: &verified})
+
+	ledger := NewLedger(NewMemoryLedgerStore(), 0, WithOverProofBonus(OverProofBonus{Required: 1, PerZeroBit: 0.5}))
+	v := NewVerifier(WithAlgorithms(alg), WithLedger(ledger))
+
+	mint := func() Header {
+		h, err := New("ledger@example.com", 4, time.Hour, WithAlgorithm(alg))
+		require.NoError(t, err)
+		h, err = Compute(context.Background(), h, 0)
+		require.NoError(t, err)
+		return h
+	}
+
+	h := mint()
+	verified.Store(0)
+	require.NoError(t, v.VerifyFor(context.Background(), "client", h))
+	assert.Equal(t, int64(1), verified.Load(), "the bonus does not verify the stamp again")
+
+	h = mint()
+	verified.Store(0)
+	require.NoError(t, v.VerifyBatch(context.Background(), "client", []Header{h})[0])
+	assert.Equal(t, int64(1), verified.Load(), "the batch credits the verified stamp")
+}
+
+func TestMiddleware_VerifiesOnce(t *testing.T) {
+	const alg = "counting-seq-sha-256"
+	var verified atomic.Int64
+	RegisterWorkFunction(alg, countingWork{verified: &verified})
+
+	m := NewMiddleware(
+		WithMiddlewareVerifier(NewVerifier(WithAlgorithms(alg))),
+		WithChallengeTemplate(ChallengeTemplate{Algorithm: alg, TTL: time.Minute}),
+	)
+
+	var stamp VerifiedStamp
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stamp, _ = StampFromContext(r.Context())
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+
+	solved, err := SolveChallenge(context.Background(), rec.Header().Get(DefaultChallengeHeader), 0)
+	require.NoError(t, err)
+
+	verified.Store(0)
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set(DefaultStampHeader, solved)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, solved, stamp.Header.String())
+	assert.Positive(t, stamp.Score)
+	assert.Equal(t, int64(1), verified.Load(), "the score does not verify the stamp again")
+}
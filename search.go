@@ -0,0 +1,61 @@
+package hashcache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	mathrand "math/rand"
+)
+
+type SearchStrategy int
+
+const (
+	// SequentialSearch increments the counter, workers of the pool
+	// get adjacent counter ranges
+	SequentialSearch SearchStrategy = iota
+
+	// RandomSearch samples random counters, so uncoordinated miners
+	// working on the same challenge rarely duplicate work and no prefix
+	// of the counter space can be precomputed
+	RandomSearch
+)
+
+// ComputeRandom searches for the work by sampling random counters,
+// trying at most maxIterations of them, zero or less meaning no limit
+func ComputeRandom(ctx context.Context, h Header, maxIterations int) (Header, error) {
+	if _, ok := resolveWorkFunction(h.Algorithm).(hashcashWork); !ok {
+		return Compute(ctx, h, maxIterations)
+	}
+
+	rng, err := newSearchRand()
+	if err != nil {
+		return Header{}, err
+	}
+
+	interval, pace := checkInterval(ctx), newPacer(ctx)
+	for i := 0; i < maxIterations || maxIterations <= 0; i++ {
+		if uint64(i)%interval == 0 {
+			if err := pace.checkpoint(ctx); err != nil {
+				return Header{}, err
+			}
+		}
+
+		h.Counter = rng.Uint64()
+		if h = h.memoized(); h.Valid() {
+			return h, nil
+		}
+	}
+
+	return Header{}, ErrTooManyIterations
+}
+
+// newSearchRand is a fast non-cryptographic generator
+// seeded from the cryptographic one
+func newSearchRand() (*mathrand.Rand, error) {
+	var seed [8]byte
+	if _, err := rand.Read(seed[:]); err != nil {
+		return nil, err
+	}
+
+	return mathrand.New(mathrand.NewSource(int64(binary.LittleEndian.Uint64(seed[:])))), nil
+}
@@ -0,0 +1,268 @@
+// Package selftest continuously mints and verifies stamps across the
+// algorithms and the verifiers of a deployment, reporting the stamps
+// which mint valid but fail the verification. Run as a canary inside
+// a deployment it detects configuration, store and clock drift issues
+// before the clients do.
+package selftest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/denismitr/hashcache"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+	defaultZeroBits = 1
+	defaultTTL      = time.Minute
+	defaultResource = "selftest.hashcache"
+	defaultClient   = "selftest"
+)
+
+// Target is a verifier under test, e.g. one per store backend
+type Target struct {
+	Name     string
+	Verifier *hashcache.Verifier
+
+	// Replay requires the replay of an accepted stamp to be rejected,
+	// for the verifiers with a spent store
+	Replay bool
+}
+
+type Config struct {
+	Targets []Target
+
+	// Algorithms minted, by default the ones each target accepts
+	Algorithms []string
+
+	// Interval between the rounds of Run
+	Interval time.Duration
+
+	// ZeroBits of the minted stamps, raised to the minimum of the targets
+	ZeroBits uint8
+	TTL      time.Duration
+	Resource string
+
+	// OnDivergence is called for every divergence found
+	OnDivergence func(Divergence)
+}
+
+type Option func(*Config)
+
+// WithTarget adds a verifier under test
+func WithTarget(t Target) Option {
+	return func(cfg *Config) {
+		cfg.Targets = append(cfg.Targets, t)
+	}
+}
+
+func WithAlgorithms(algs ...string) Option {
+	return func(cfg *Config) {
+		cfg.Algorithms = algs
+	}
+}
+
+// WithInterval between the rounds, the rate of the harness
+func WithInterval(d time.Duration) Option {
+	return func(cfg *Config) {
+		cfg.Interval = d
+	}
+}
+
+func WithZeroBits(zeroBits uint8) Option {
+	return func(cfg *Config) {
+		cfg.ZeroBits = zeroBits
+	}
+}
+
+func WithDivergenceHandler(fn func(Divergence)) Option {
+	return func(cfg *Config) {
+		cfg.OnDivergence = fn
+	}
+}
+
+// Divergence is a stamp which minted valid but failed the verification
+// of a target, or the replay of which was accepted
+type Divergence struct {
+	Time      time.Time
+	Target    string
+	Algorithm string
+	Stamp     string
+
+	// Err of the verification, nil for an accepted replay
+	Err  error
+	Code hashcache.ErrorCode
+}
+
+// Report of the rounds run so far
+type Report struct {
+	Rounds      uint64
+	Minted      uint64
+	Verified    uint64
+	Divergences uint64
+
+	// MintFailures are the stamps which could not be minted
+	MintFailures uint64
+
+	Last *Divergence
+}
+
+// Harness mints and verifies stamps in rounds
+type Harness struct {
+	cfg Config
+
+	mu     sync.Mutex
+	report Report
+}
+
+// New harness, a verifier with a memory store is tested without targets
+func New(opts ...Option) *Harness {
+	cfg := Config{
+		Interval: defaultInterval,
+		ZeroBits: defaultZeroBits,
+		TTL:      defaultTTL,
+		Resource: defaultResource,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if len(cfg.Targets) == 0 {
+		cfg.Targets = []Target{{
+			Name:     "memory",
+			Verifier: hashcache.NewVerifier(hashcache.WithSpentStore(hashcache.NewMemoryStore())),
+			Replay:   true,
+		}}
+	}
+
+	return &Harness{cfg: cfg}
+}
+
+// Run rounds every interval until ctx is done
+func (h *Harness) Run(ctx context.Context) error {
+	ticker := time.NewTicker(h.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		h.Round(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Round mints a stamp of every algorithm for every target
+// and returns the divergences found
+func (h *Harness) Round(ctx context.Context) []Divergence {
+	var found []Divergence
+	var minted, verified, failed uint64
+
+	for _, target := range h.cfg.Targets {
+		policy := target.Verifier.Policy()
+
+		algs := h.cfg.Algorithms
+		if len(algs) == 0 {
+			for _, alg := range hashcache.Algorithms() {
+				if policy.AcceptsAlgorithm(alg) {
+					algs = append(algs, alg)
+				}
+			}
+		}
+
+		for _, alg := range algs {
+			stamp, err := h.mint(ctx, alg, max(h.cfg.ZeroBits, policy.MinZeroBitsFor(alg)))
+			if err != nil {
+				failed++
+				continue
+			}
+			minted++
+
+			if d, ok := h.check(ctx, target, alg, stamp); ok {
+				found = append(found, d)
+				continue
+			}
+			verified++
+		}
+	}
+
+	h.mu.Lock()
+	h.report.Rounds++
+	h.report.Minted += minted
+	h.report.Verified += verified
+	h.report.MintFailures += failed
+	h.report.Divergences += uint64(len(found))
+	if len(found) > 0 {
+		last := found[len(found)-1]
+		h.report.Last = &last
+	}
+	h.mu.Unlock()
+
+	if h.cfg.OnDivergence != nil {
+		for _, d := range found {
+			h.cfg.OnDivergence(d)
+		}
+	}
+
+	return found
+}
+
+// Report of the rounds run so far
+func (h *Harness) Report() Report {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	report := h.report
+	if report.Last != nil {
+		last := *report.Last
+		report.Last = &last
+	}
+
+	return report
+}
+
+func (h *Harness) mint(ctx context.Context, alg string, zeroBits uint8) (hashcache.Header, error) {
+	stamp, err := hashcache.New(h.cfg.Resource, zeroBits, h.cfg.TTL, hashcache.WithAlgorithm(alg))
+	if err != nil {
+		return hashcache.Header{}, err
+	}
+
+	if stamp, err = hashcache.Compute(ctx, stamp, 0); err != nil {
+		return hashcache.Header{}, err
+	}
+
+	if !stamp.Valid() {
+		return hashcache.Header{}, hashcache.ErrInvalidProof
+	}
+
+	return stamp, nil
+}
+
+// check verifies the stamp with the target, and its replay
+// when the target must reject it
+func (h *Harness) check(ctx context.Context, target Target, alg string, stamp hashcache.Header) (Divergence, bool) {
+	d := Divergence{Time: time.Now(), Target: target.Name, Algorithm: alg, Stamp: stamp.String()}
+
+	if err := target.Verifier.VerifyFor(ctx, defaultClient, stamp); err != nil {
+		d.Err, d.Code = err, hashcache.CodeOf(err)
+		return d, true
+	}
+
+	if !target.Replay {
+		return d, false
+	}
+
+	err := target.Verifier.VerifyFor(ctx, defaultClient, stamp)
+	if errors.Is(err, hashcache.ErrStampSpent) {
+		return d, false
+	}
+
+	d.Err, d.Code = err, hashcache.CodeOf(err)
+	return d, true
+}
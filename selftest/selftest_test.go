@@ -0,0 +1,60 @@
+package selftest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/denismitr/hashcache"
+)
+
+func TestHarness_Round(t *testing.T) {
+	t.Run("no divergence with memory store", func(t *testing.T) {
+		h := New()
+
+		found := h.Round(context.Background())
+		assert.Empty(t, found)
+
+		report := h.Report()
+		assert.Equal(t, uint64(1), report.Rounds)
+		assert.NotZero(t, report.Minted)
+		assert.Zero(t, report.MintFailures)
+		assert.Equal(t, report.Minted, report.Verified)
+		assert.Zero(t, report.Divergences)
+		assert.Nil(t, report.Last)
+	})
+
+	t.Run("replay accepted without spent store", func(t *testing.T) {
+		var handled []Divergence
+		h := New(
+			WithTarget(Target{Name: "no-store", Verifier: hashcache.NewVerifier(), Replay: true}),
+			WithAlgorithms(hashcache.DefaultAlgorithm),
+			WithDivergenceHandler(func(d Divergence) { handled = append(handled, d) }),
+		)
+
+		found := h.Round(context.Background())
+		require.Len(t, found, 1)
+		assert.Equal(t, "no-store", found[0].Target)
+		assert.NoError(t, found[0].Err)
+		assert.Equal(t, found, handled)
+
+		report := h.Report()
+		assert.Equal(t, uint64(1), report.Divergences)
+		require.NotNil(t, report.Last)
+		assert.Equal(t, found[0].Stamp, report.Last.Stamp)
+	})
+}
+
+func TestHarness_Run(t *testing.T) {
+	h := New(WithInterval(time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, h.Run(ctx), context.DeadlineExceeded)
+	assert.Greater(t, h.Report().Rounds, uint64(1))
+	assert.Zero(t, h.Report().Divergences)
+}
@@ -0,0 +1,141 @@
+package hashcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// algSeqSha256 is a time-lock variant where ZeroBits is the log2 of
+	// the length of a sha-256 hash chain seeded with the header. Every link
+	// depends on the previous one, so the work cannot be spread across
+	// cores and imposes wall-clock delay rather than CPU cost.
+	algSeqSha256 = "seq-sha-256"
+
+	maxSequentialBits = 40
+
+	// defaultMaxSequentialZeroBits verified, about a million hashes
+	defaultMaxSequentialZeroBits = 20
+
+	sequentialCheckpoints = 8
+	sequentialCheckEvery  = 1 << 16
+
+	checkpointSeparator = "."
+)
+
+var ErrInvalidSequentialBits = newError(CodeInvalidSequentialBits, "invalid sequential zero bits")
+
+type sequentialWork struct{}
+
+// Solve walks the hash chain and stores evenly spaced
+// checkpoints in the extension field, so the verifier can check
+// the segments between them in parallel.
+func (sequentialWork) Solve(ctx context.Context, h Header, _ int) (Header, error) {
+	if h.ZeroBits > maxSequentialBits {
+		return Header{}, fmt.Errorf("%w: %d, max is %d", ErrInvalidSequentialBits, h.ZeroBits, maxSequentialBits)
+	}
+
+	segments, segmentLen := sequentialSegments(h.ZeroBits)
+	link := sequentialSeed(h)
+	checkpoints := make([]string, 0, segments)
+
+	for i := 0; i < segments; i++ {
+		var err error
+		if link, err = hashChain(ctx, link, segmentLen); err != nil {
+			return Header{}, err
+		}
+
+		checkpoints = append(checkpoints, base64.RawURLEncoding.EncodeToString(link))
+	}
+
+	h.Ext = strings.Join(checkpoints, checkpointSeparator)
+	return h, nil
+}
+
+func (w sequentialWork) Verify(h Header) bool {
+	return w.VerifyContext(context.Background(), h)
+}
+
+// VerifyContext recomputes the segments of the chain in parallel,
+// giving up once ctx is done
+func (sequentialWork) VerifyContext(ctx context.Context, h Header) bool {
+	if h.ZeroBits > maxSequentialBits || h.Ext == "" {
+		return false
+	}
+
+	segments, segmentLen := sequentialSegments(h.ZeroBits)
+	encoded := strings.Split(h.Ext, checkpointSeparator)
+	if len(encoded) != segments {
+		return false
+	}
+
+	checkpoints := make([][]byte, segments)
+	for i, e := range encoded {
+		cp, err := base64.RawURLEncoding.DecodeString(e)
+		if err != nil || len(cp) != sha256.Size {
+			return false
+		}
+		checkpoints[i] = cp
+	}
+
+	var wg sync.WaitGroup
+	var failed atomic.Bool
+	wg.Add(segments)
+
+	for i := range checkpoints {
+		go func(i int) {
+			defer wg.Done()
+
+			start := sequentialSeed(h)
+			if i > 0 {
+				start = checkpoints[i-1]
+			}
+
+			end, err := hashChain(ctx, start, segmentLen)
+			if err != nil || !bytes.Equal(end, checkpoints[i]) {
+				failed.Store(true)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	return !failed.Load()
+}
+
+func sequentialSegments(zeroBits uint8) (int, uint64) {
+	total := uint64(1) << zeroBits
+	segments := sequentialCheckpoints
+	if total < uint64(segments) {
+		segments = int(total)
+	}
+
+	return segments, total / uint64(segments)
+}
+
+// sequentialSeed is the hash of the header without the checkpoints
+func sequentialSeed(h Header) []byte {
+	h.Ext = ""
+	sum := sha256.Sum256([]byte(h.String()))
+	return sum[:]
+}
+
+func hashChain(ctx context.Context, link []byte, n uint64) ([]byte, error) {
+	sum := [sha256.Size]byte{}
+	copy(sum[:], link)
+
+	for i := uint64(0); i < n; i++ {
+		if i%sequentialCheckEvery == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		sum = sha256.Sum256(sum[:])
+	}
+
+	return sum[:], nil
+}
@@ -0,0 +1,39 @@
+package hashcache
+
+import (
+	"context"
+	"net/http"
+)
+
+type shadowContextKey struct{}
+
+type shadowRejectionContextKey struct{}
+
+// WithShadowMode makes the middleware verify the stamps, escalate and
+// audit as usual, but let through the requests it would reject, so that
+// operators can measure the readiness of the clients and tune the
+// difficulty before enforcing it. The audit records of the middleware are
+// marked Shadow, and the reason a request would have been rejected for
+// is in its context, see ShadowRejection.
+func WithShadowMode() MiddlewareOption {
+	return func(cfg *MiddlewareConfig) {
+		cfg.Shadow = true
+	}
+}
+
+// ShadowRejection is the reason the middleware in shadow mode
+// would have rejected the request for, nil when it would have passed
+func ShadowRejection(ctx context.Context) error {
+	err, _ := ctx.Value(shadowRejectionContextKey{}).(error)
+	return err
+}
+
+func isShadow(ctx context.Context) bool {
+	shadow, _ := ctx.Value(shadowContextKey{}).(bool)
+	return shadow
+}
+
+// shadowPass lets the request rejected for err through
+func shadowPass(r *http.Request, err error) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), shadowRejectionContextKey{}, err))
+}
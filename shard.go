@@ -0,0 +1,41 @@
+package hashcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+)
+
+// RandDomain derives the search domain of the worker with the index from
+// the header, mixing the index into its random string, so that the workers
+// of a coordinator search non overlapping domains without agreeing on
+// counter ranges. The derivation is deterministic, any party knowing the
+// header and the index gets the same domain. The random string keeps its
+// length and the counter is reset. Signed challenges cover the random
+// string, so they can not be split this way.
+func RandDomain(h Header, index uint32) Header {
+	seed, err := base64.StdEncoding.DecodeString(h.Rand)
+	if err != nil || len(seed) == 0 {
+		seed = []byte(h.Rand)
+	}
+
+	mac := sha256.New()
+	mac.Write(seed)
+	_ = binary.Write(mac, binary.BigEndian, index)
+	sum := mac.Sum(nil)
+
+	n := min(max(len(seed), MinRandBytes), len(sum))
+	h.Rand = base64.StdEncoding.EncodeToString(sum[:n])
+	h.Counter = 0
+	h.digest = digestMemo{}
+	return h
+}
+
+// ShardSolver solves the domain of the worker with the index,
+// see RandDomain, e.g. on the remote path of ChooseSolver
+func ShardSolver(index uint32, solver Solver) Solver {
+	return SolverFunc(func(ctx context.Context, h Header) (Header, error) {
+		return solver.Solve(ctx, RandDomain(h, index))
+	})
+}
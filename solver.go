@@ -0,0 +1,118 @@
+package hashcache
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+const (
+	defaultPoolZeroBits   = 4
+	defaultRemoteZeroBits = 7
+)
+
+// Solver computes the work of a header
+type Solver interface {
+	Solve(ctx context.Context, h Header) (Header, error)
+}
+
+type SolverFunc func(ctx context.Context, h Header) (Header, error)
+
+func (fn SolverFunc) Solve(ctx context.Context, h Header) (Header, error) {
+	return fn(ctx, h)
+}
+
+// SingleSolver searches the counters in the calling goroutine,
+// which is the cheapest for the low difficulties
+var SingleSolver Solver = singleSolver{}
+
+type singleSolver struct{}
+
+func (singleSolver) Solve(ctx context.Context, h Header) (Header, error) {
+	return Compute(ctx, h, 0)
+}
+
+// PoolSolver searches the counters with ComputeWithPool
+func PoolSolver(opts ...PoolOption) Solver {
+	return SolverFunc(func(ctx context.Context, h Header) (Header, error) {
+		result, err := ComputeWithPool(ctx, h, opts...)
+		return result.Header, err
+	})
+}
+
+// SolverHints tune the choice of ChooseSolver
+type SolverHints struct {
+	// Override is returned as is when set
+	Override Solver
+
+	// Algorithm and Rates estimate the solve time against the deadline,
+	// without them the solver is chosen by the zero bits alone
+	Algorithm string
+	Rates     HashRates
+
+	// PoolZeroBits and RemoteZeroBits are the least difficulties
+	// routed to the pool and to the remote solver
+	PoolZeroBits   uint8
+	RemoteZeroBits uint8
+
+	// Pool defaults to PoolSolver with the default options
+	Pool Solver
+
+	// Remote solver of the very high difficulties, e.g. a solving service,
+	// the pool takes them when it is not set
+	Remote Solver
+}
+
+// ChooseSolver routes the low difficulties to SingleSolver avoiding the
+// pool overhead, the medium ones to the pool and the very high ones to
+// the remote solver. Given a deadline and the hash rate of the algorithm,
+// the cheapest solver expected to finish before the deadline is chosen
+// instead.
+func ChooseSolver(zeroBits uint8, deadline time.Duration, hints SolverHints) Solver {
+	if hints.Override != nil {
+		return hints.Override
+	}
+
+	pool := hints.Pool
+	if pool == nil {
+		pool = PoolSolver()
+	}
+
+	remote := hints.Remote
+	if remote == nil {
+		remote = pool
+	}
+
+	if cost, err := hints.Rates.Cost(hints.Algorithm, zeroBits); err == nil && deadline > 0 {
+		switch {
+		case cost <= deadline:
+			return SingleSolver
+		case cost/time.Duration(poolParallelism()) <= deadline:
+			return pool
+		default:
+			return remote
+		}
+	}
+
+	poolBits, remoteBits := hints.PoolZeroBits, hints.RemoteZeroBits
+	if poolBits == 0 {
+		poolBits = defaultPoolZeroBits
+	}
+	if remoteBits == 0 {
+		remoteBits = defaultRemoteZeroBits
+	}
+
+	switch {
+	case zeroBits >= remoteBits:
+		return remote
+	case zeroBits >= poolBits:
+		return pool
+	default:
+		return SingleSolver
+	}
+}
+
+// poolParallelism is the expected speedup of the default pool
+func poolParallelism() int {
+	return max(min(runtime.NumCPU(), defaultPoolConcurrency), 1)
+}
@@ -0,0 +1,80 @@
+package hashcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type namedSolver string
+
+func (namedSolver) Solve(ctx context.Context, h Header) (Header, error) {
+	return Compute(ctx, h, 0)
+}
+
+func TestChooseSolver(t *testing.T) {
+	t.Parallel()
+
+	pool, remote := namedSolver("pool"), namedSolver("remote")
+	rates := HashRates{algSha256: 1_000_000}
+
+	tt := []struct {
+		name     string
+		zeroBits uint8
+		deadline time.Duration
+		hints    SolverHints
+		want     Solver
+	}{
+		{name: "low bits", zeroBits: 2, hints: SolverHints{Pool: pool, Remote: remote}, want: SingleSolver},
+		{name: "medium bits", zeroBits: 5, hints: SolverHints{Pool: pool, Remote: remote}, want: pool},
+		{name: "high bits", zeroBits: 8, hints: SolverHints{Pool: pool, Remote: remote}, want: remote},
+		{name: "high bits without remote", zeroBits: 8, hints: SolverHints{Pool: pool}, want: pool},
+		{name: "custom thresholds", zeroBits: 3, hints: SolverHints{Pool: pool, Remote: remote, PoolZeroBits: 2, RemoteZeroBits: 3}, want: remote},
+		{name: "override", zeroBits: 8, hints: SolverHints{Pool: pool, Remote: remote, Override: SingleSolver}, want: SingleSolver},
+		{
+			name: "fits the deadline single threaded", zeroBits: 4, deadline: time.Second,
+			hints: SolverHints{Algorithm: algSha256, Rates: rates, Pool: pool, Remote: remote}, want: SingleSolver,
+		},
+		{
+			name: "beyond any deadline", zeroBits: 12, deadline: time.Second,
+			hints: SolverHints{Algorithm: algSha256, Rates: rates, Pool: pool, Remote: remote}, want: remote,
+		},
+		{
+			name: "unknown rate", zeroBits: 5, deadline: time.Second,
+			hints: SolverHints{Algorithm: algSha1, Rates: rates, Pool: pool, Remote: remote}, want: pool,
+		},
+	}
+
+	for _, tc := range tt {
+		assert.Equal(t, tc.want, ChooseSolver(tc.zeroBits, tc.deadline, tc.hints), tc.name)
+	}
+
+	h, err := New("127.0.0.1", 2, time.Minute)
+	require.NoError(t, err)
+	solved, err := ChooseSolver(h.ZeroBits, 0, SolverHints{}).Solve(context.Background(), h)
+	require.NoError(t, err)
+	assert.True(t, solved.Valid())
+}
+
+func TestRandDomain(t *testing.T) {
+	t.Parallel()
+
+	h, err := New("my.email@gmail.com", 2, time.Hour)
+	require.NoError(t, err)
+	h.Counter = 42
+
+	first, second := RandDomain(h, 0), RandDomain(h, 1)
+	assert.Equal(t, first, RandDomain(h, 0))
+	assert.NotEqual(t, first.Rand, second.Rand)
+	assert.NotEqual(t, h.Rand, first.Rand)
+	assert.Len(t, first.Rand, len(h.Rand))
+	assert.Zero(t, first.Counter)
+
+	solved, err := ShardSolver(1, SingleSolver).Solve(context.Background(), h)
+	require.NoError(t, err)
+	assert.True(t, solved.Valid())
+	assert.Equal(t, second.Rand, solved.Rand)
+}
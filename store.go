@@ -0,0 +1,214 @@
+package hashcache
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const defaultJanitorJitter = 0.1
+
+var ErrStampSpent = newError(CodeStampSpent, "stamp already spent")
+
+// SpentStampStore remembers accepted stamps until they expire,
+// protecting the verifier against replays
+type SpentStampStore interface {
+	// MarkSpent records the stamp key until expiresAt inclusive and reports
+	// whether it was not recorded before
+	MarkSpent(ctx context.Context, key string, expiresAt time.Time) (bool, error)
+
+	// IsSpent reports whether the stamp key is recorded and not expired
+	IsSpent(ctx context.Context, key string) (bool, error)
+
+	// Delete forgets the stamp key
+	Delete(ctx context.Context, key string) error
+}
+
+// BatchSpentStampStore is optionally implemented by stores able to mark
+// many stamps spent in a single round trip, reporting freshness per key
+type BatchSpentStampStore interface {
+	MarkSpentBatch(ctx context.Context, keys []string, expiresAt []time.Time) ([]bool, error)
+}
+
+func markSpentBatch(ctx context.Context, s SpentStampStore, keys []string, expiresAt []time.Time) ([]bool, error) {
+	if batch, ok := s.(BatchSpentStampStore); ok {
+		return batch.MarkSpentBatch(ctx, keys, expiresAt)
+	}
+
+	fresh := make([]bool, len(keys))
+	for i, key := range keys {
+		var err error
+		if fresh[i], err = s.MarkSpent(ctx, key, expiresAt[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return fresh, nil
+}
+
+// spentTTL is the time the store has to remember the stamp, false when
+// it is already expired: such stamps are never accepted, nothing to remember
+func spentTTL(expiresAt, now time.Time) (time.Duration, bool) {
+	ttl := expiresAt.Sub(now)
+	return ttl, ttl > 0
+}
+
+// StampKey identifies the stamp in a spent-stamp store
+func StampKey(h Header) string {
+	return h.Hash()
+}
+
+type MemoryStoreConfig struct {
+	// JanitorInterval between scans evicting expired entries,
+	// zero disables the janitor and entries are evicted on lookup only
+	JanitorInterval time.Duration
+
+	// JanitorJitter is the fraction of the interval the scans
+	// are randomly spread by
+	JanitorJitter float64
+}
+
+type MemoryStoreOption func(*MemoryStoreConfig)
+
+func WithJanitorInterval(d time.Duration) MemoryStoreOption {
+	return func(cfg *MemoryStoreConfig) {
+		cfg.JanitorInterval = d
+	}
+}
+
+func WithJanitorJitter(fraction float64) MemoryStoreOption {
+	return func(cfg *MemoryStoreConfig) {
+		cfg.JanitorJitter = fraction
+	}
+}
+
+// MemoryStore is a SpentStampStore of a single process
+type MemoryStore struct {
+	cfg MemoryStoreConfig
+
+	mu      sync.Mutex
+	entries map[string]time.Time
+
+	stop      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+func NewMemoryStore(opts ...MemoryStoreOption) *MemoryStore {
+	cfg := MemoryStoreConfig{JanitorJitter: defaultJanitorJitter}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	s := &MemoryStore{
+		cfg:     cfg,
+		entries: make(map[string]time.Time),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	if cfg.JanitorInterval > 0 {
+		go s.janitor()
+	} else {
+		close(s.stopped)
+	}
+
+	return s
+}
+
+func (s *MemoryStore) MarkSpent(_ context.Context, key string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if exp, ok := s.entries[key]; ok && !clock().After(exp) {
+		return false, nil
+	}
+
+	s.entries[key] = expiresAt
+	return true, nil
+}
+
+func (s *MemoryStore) IsSpent(_ context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exp, ok := s.entries[key]
+	if ok && clock().After(exp) {
+		delete(s.entries, key)
+		return false, nil
+	}
+
+	return ok, nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// Len is the number of entries including the expired ones
+// the janitor has not evicted yet
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.entries)
+}
+
+// Close stops the janitor, waiting for a running scan to finish
+// until the context is done
+func (s *MemoryStore) Close(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+
+	select {
+	case <-s.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *MemoryStore) janitor() {
+	defer close(s.stopped)
+
+	for {
+		timer := time.NewTimer(jittered(s.cfg.JanitorInterval, s.cfg.JanitorJitter))
+
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.evictExpired()
+		}
+	}
+}
+
+func (s *MemoryStore) evictExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := clock()
+	for key, exp := range s.entries {
+		if now.After(exp) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// jittered spreads d randomly by up to the fraction in both directions
+func jittered(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
+	}
+
+	spread := float64(d) * fraction
+	return d + time.Duration((rand.Float64()*2-1)*spread)
+}
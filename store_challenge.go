@@ -0,0 +1,138 @@
+package hashcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+const defaultRedisChallengePrefix = "hashcache:challenge:"
+
+var ErrUnknownChallenge = newError(CodeUnknownChallenge, "stamp does not answer an issued challenge")
+
+// IssuedChallengeStore records the outstanding challenges of a stateful
+// issuer, an alternative to signed challenges, see WithIssuedChallenges
+type IssuedChallengeStore interface {
+	// Record the challenge key until expiresAt inclusive
+	Record(ctx context.Context, key string, expiresAt time.Time) error
+
+	// Take forgets the challenge key and reports whether
+	// it was recorded and not expired, so that it is used once
+	Take(ctx context.Context, key string) (bool, error)
+}
+
+// ChallengeKey identifies the challenge a stamp answers by the fields
+// fixed by the issuer, leaving out the counter and the extension
+func ChallengeKey(h Header) string {
+	sum := sha256.Sum256([]byte(challengeFields(h)))
+	return hex.EncodeToString(sum[:])
+}
+
+// WithIssuedChallenges accepts only the stamps answering a challenge
+// recorded in the store, each of them once. The middleware records the
+// challenges it issues, other issuers call RecordChallenge.
+func WithIssuedChallenges(s IssuedChallengeStore) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.IssuedChallenges = s
+	}
+}
+
+// RecordChallenge issued for the tenant of the context
+// when the verifier accepts only issued challenges
+func (v *Verifier) RecordChallenge(ctx context.Context, h Header) error {
+	if v.cfg.IssuedChallenges == nil {
+		return nil
+	}
+
+	p := v.policyFor(TenantFromContext(ctx))
+	return v.cfg.IssuedChallenges.Record(ctx, tenantChallengeKey(TenantFromContext(ctx), h), p.spentUntil(h))
+}
+
+// takeChallenge answered by the stamp when the verifier
+// accepts only issued challenges
+func (v *Verifier) takeChallenge(ctx context.Context, tenant string, h Header) error {
+	if v.cfg.IssuedChallenges == nil {
+		return nil
+	}
+
+	ok, err := v.cfg.IssuedChallenges.Take(ctx, tenantChallengeKey(tenant, h))
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrUnknownChallenge
+	}
+
+	return nil
+}
+
+func tenantChallengeKey(tenant string, h Header) string {
+	if tenant == "" {
+		return ChallengeKey(h)
+	}
+
+	return tenant + ":" + ChallengeKey(h)
+}
+
+// MemoryChallengeStore is an IssuedChallengeStore of a single process
+type MemoryChallengeStore struct {
+	*MemoryStore
+}
+
+func NewMemoryChallengeStore(opts ...MemoryStoreOption) *MemoryChallengeStore {
+	return &MemoryChallengeStore{MemoryStore: NewMemoryStore(opts...)}
+}
+
+func (s *MemoryChallengeStore) Record(_ context.Context, key string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = expiresAt
+	return nil
+}
+
+func (s *MemoryChallengeStore) Take(_ context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exp, ok := s.entries[key]
+	delete(s.entries, key)
+	return ok && !clock().After(exp), nil
+}
+
+// RedisChallengeClient is the subset of a Redis client the challenge
+// store needs, e.g. a thin wrapper of github.com/redis/go-redis
+type RedisChallengeClient interface {
+	// SetNXPipeline as in RedisClient
+	SetNXPipeline(ctx context.Context, keys []string, ttls []time.Duration) ([]bool, error)
+
+	// DelExisted sends DEL key and reports whether the key was deleted
+	DelExisted(ctx context.Context, key string) (bool, error)
+}
+
+// RedisChallengeStore is an IssuedChallengeStore shared by all
+// the processes using the same Redis, Redis expires the challenges
+type RedisChallengeStore struct {
+	client RedisChallengeClient
+	prefix string
+}
+
+func NewRedisChallengeStore(client RedisChallengeClient) *RedisChallengeStore {
+	return &RedisChallengeStore{client: client, prefix: defaultRedisChallengePrefix}
+}
+
+func (s *RedisChallengeStore) Record(ctx context.Context, key string, expiresAt time.Time) error {
+	ttl := expiresAt.Sub(clock())
+	if ttl <= 0 {
+		return nil
+	}
+
+	_, err := s.client.SetNXPipeline(ctx, []string{s.prefix + key}, []time.Duration{max(ttl, time.Millisecond)})
+	return err
+}
+
+func (s *RedisChallengeStore) Take(ctx context.Context, key string) (bool, error) {
+	return s.client.DelExisted(ctx, s.prefix+key)
+}
@@ -0,0 +1,84 @@
+package hashcache
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	defaultDynamoDBKeyAttribute = "stamp"
+	defaultDynamoDBTTLAttribute = "expires_at"
+
+	// dynamoDBPutCondition lets the put overwrite items which are expired
+	// but not deleted yet, since DynamoDB deletes expired items lazily
+	dynamoDBPutCondition = "attribute_not_exists(#key) OR #ttl < :now"
+)
+
+// DynamoDBPut describes a conditional PutItem of an item made of the key
+// and the TTL attribute in unix seconds. The expression refers to the
+// attribute names as #key and #ttl and to the current time as :now.
+type DynamoDBPut struct {
+	TableName           string
+	KeyAttribute        string
+	Key                 string
+	TTLAttribute        string
+	ExpiresAt           int64
+	ConditionExpression string
+	Now                 int64
+}
+
+// DynamoDBClient is the subset of the DynamoDB API the store needs,
+// to be implemented on top of the AWS SDK
+type DynamoDBClient interface {
+	// ConditionalPut reports false when the condition check fails
+	ConditionalPut(ctx context.Context, put DynamoDBPut) (bool, error)
+
+	// GetExpiration returns the TTL attribute of the item by the key
+	GetExpiration(ctx context.Context, table, keyAttribute, key, ttlAttribute string) (int64, bool, error)
+
+	DeleteItem(ctx context.Context, table, keyAttribute, key string) error
+}
+
+// DynamoDBStore is a SpentStampStore on a DynamoDB table with native TTL
+// enabled on the TTL attribute, giving serverless deployments shared
+// replay protection
+type DynamoDBStore struct {
+	client       DynamoDBClient
+	table        string
+	keyAttribute string
+	ttlAttribute string
+}
+
+func NewDynamoDBStore(client DynamoDBClient, table string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client:       client,
+		table:        table,
+		keyAttribute: defaultDynamoDBKeyAttribute,
+		ttlAttribute: defaultDynamoDBTTLAttribute,
+	}
+}
+
+func (s *DynamoDBStore) MarkSpent(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	return s.client.ConditionalPut(ctx, DynamoDBPut{
+		TableName:           s.table,
+		KeyAttribute:        s.keyAttribute,
+		Key:                 key,
+		TTLAttribute:        s.ttlAttribute,
+		ExpiresAt:           expiresAt.Unix(),
+		ConditionExpression: dynamoDBPutCondition,
+		Now:                 clock().Unix(),
+	})
+}
+
+func (s *DynamoDBStore) IsSpent(ctx context.Context, key string) (bool, error) {
+	expiresAt, ok, err := s.client.GetExpiration(ctx, s.table, s.keyAttribute, key, s.ttlAttribute)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return expiresAt >= clock().Unix(), nil
+}
+
+func (s *DynamoDBStore) Delete(ctx context.Context, key string) error {
+	return s.client.DeleteItem(ctx, s.table, s.keyAttribute, key)
+}
@@ -0,0 +1,176 @@
+package hashcache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StoreOpMarkSpent = "mark_spent"
+	StoreOpIsSpent   = "is_spent"
+	StoreOpDelete    = "delete"
+)
+
+var defaultLatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+}
+
+// StoreObserver receives the outcome of every store operation. A hit is
+// a stamp found spent, i.e. a replay for MarkSpent.
+type StoreObserver interface {
+	ObserveStoreOp(op string, latency time.Duration, hit bool, err error)
+}
+
+// InstrumentedStore decorates any SpentStampStore with observations,
+// so that every backend gets the same metrics for free
+type InstrumentedStore struct {
+	store    SpentStampStore
+	observer StoreObserver
+}
+
+func NewInstrumentedStore(s SpentStampStore, o StoreObserver) *InstrumentedStore {
+	return &InstrumentedStore{store: s, observer: o}
+}
+
+func (s *InstrumentedStore) MarkSpent(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	start := time.Now()
+	fresh, err := s.store.MarkSpent(ctx, key, expiresAt)
+	s.observer.ObserveStoreOp(StoreOpMarkSpent, time.Since(start), err == nil && !fresh, err)
+	return fresh, err
+}
+
+func (s *InstrumentedStore) MarkSpentBatch(ctx context.Context, keys []string, expiresAt []time.Time) ([]bool, error) {
+	start := time.Now()
+	fresh, err := markSpentBatch(ctx, s.store, keys, expiresAt)
+	latency := time.Since(start)
+
+	if err != nil {
+		s.observer.ObserveStoreOp(StoreOpMarkSpent, latency, false, err)
+		return nil, err
+	}
+
+	// the round trip is shared, so is its latency
+	for _, f := range fresh {
+		s.observer.ObserveStoreOp(StoreOpMarkSpent, latency/time.Duration(len(fresh)), !f, nil)
+	}
+
+	return fresh, nil
+}
+
+func (s *InstrumentedStore) IsSpent(ctx context.Context, key string) (bool, error) {
+	start := time.Now()
+	spent, err := s.store.IsSpent(ctx, key)
+	s.observer.ObserveStoreOp(StoreOpIsSpent, time.Since(start), spent, err)
+	return spent, err
+}
+
+func (s *InstrumentedStore) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	err := s.store.Delete(ctx, key)
+	s.observer.ObserveStoreOp(StoreOpDelete, time.Since(start), false, err)
+	return err
+}
+
+// StoreOpStats are the counters of a single store operation. Latency
+// counts observations by the upper bounds of the buckets, the last
+// counter being for latencies above all the bounds.
+type StoreOpStats struct {
+	Calls   uint64
+	Hits    uint64
+	Misses  uint64
+	Errors  uint64
+	Latency []uint64
+}
+
+// StoreMetrics is an in-process StoreObserver
+type StoreMetrics struct {
+	mu      sync.Mutex
+	buckets []time.Duration
+	ops     map[string]*StoreOpStats
+}
+
+// NewStoreMetrics with latency histogram buckets given as upper bounds
+// in ascending order, defaults are used when none are given
+func NewStoreMetrics(buckets ...time.Duration) *StoreMetrics {
+	if len(buckets) == 0 {
+		buckets = defaultLatencyBuckets
+	}
+
+	return &StoreMetrics{buckets: buckets, ops: make(map[string]*StoreOpStats)}
+}
+
+func (m *StoreMetrics) ObserveStoreOp(op string, latency time.Duration, hit bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, ok := m.ops[op]
+	if !ok {
+		stats = &StoreOpStats{Latency: make([]uint64, len(m.buckets)+1)}
+		m.ops[op] = stats
+	}
+
+	stats.Calls++
+	switch {
+	case err != nil:
+		stats.Errors++
+	case hit:
+		stats.Hits++
+	default:
+		stats.Misses++
+	}
+
+	bucket := len(m.buckets)
+	for i, bound := range m.buckets {
+		if latency <= bound {
+			bucket = i
+			break
+		}
+	}
+	stats.Latency[bucket]++
+}
+
+// Buckets are the upper bounds of the latency histogram
+func (m *StoreMetrics) Buckets() []time.Duration {
+	return m.buckets
+}
+
+// Stats of the operation
+func (m *StoreMetrics) Stats(op string) StoreOpStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, ok := m.ops[op]
+	if !ok {
+		return StoreOpStats{Latency: make([]uint64, len(m.buckets)+1)}
+	}
+
+	cp := *stats
+	cp.Latency = append([]uint64(nil), stats.Latency...)
+	return cp
+}
+
+// ErrorRate of the operation as a fraction of its calls
+func (s StoreOpStats) ErrorRate() float64 {
+	if s.Calls == 0 {
+		return 0
+	}
+
+	return float64(s.Errors) / float64(s.Calls)
+}
+
+// Close the decorated store if it is a Closer
+func (s *InstrumentedStore) Close(ctx context.Context) error {
+	if c, ok := s.store.(Closer); ok {
+		return c.Close(ctx)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package hashcache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const defaultKVPrefix = "hashcache:"
+
+// KVStore is the minimal key-value contract to wire a custom system
+// (etcd, Consul, Aerospike...) in as a spent-stamp store
+type KVStore interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// SetNX sets the value with the ttl unless the key exists,
+	// reporting whether it did
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+
+	// CompareAndSwap sets the value with the ttl if the key still holds
+	// old, reporting whether it did
+	CompareAndSwap(ctx context.Context, key string, old, value []byte, ttl time.Duration) (bool, error)
+}
+
+// KVDeleter is optionally implemented by a KVStore to support Delete
+type KVDeleter interface {
+	Delete(ctx context.Context, key string) error
+}
+
+// KVSpentStore adapts a KVStore to a SpentStampStore. The values hold
+// the expiration, so that entries outliving their TTL in stores with
+// coarse or no expiration are not taken for spent, and are taken over
+// by the stamps marked afterwards.
+type KVSpentStore struct {
+	kv     KVStore
+	prefix string
+}
+
+func NewKVSpentStore(kv KVStore) *KVSpentStore {
+	return &KVSpentStore{kv: kv, prefix: defaultKVPrefix}
+}
+
+func (s *KVSpentStore) MarkSpent(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	ttl, ok := spentTTL(expiresAt, clock())
+	if !ok {
+		return true, nil
+	}
+
+	value := binary.BigEndian.AppendUint64(nil, uint64(expiresAt.UnixNano()))
+
+	// a second attempt covers the key expiring between SetNX and Get
+	for attempt := 0; attempt < 2; attempt++ {
+		set, err := s.kv.SetNX(ctx, s.prefix+key, value, ttl)
+		if err != nil || set {
+			return set, err
+		}
+
+		stored, ok, err := s.kv.Get(ctx, s.prefix+key)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			continue
+		}
+
+		until, err := kvExpiration(stored)
+		if err != nil || !clock().After(until) {
+			return false, err
+		}
+
+		// the entry outlived its expiration, it is taken over
+		// unless a concurrent mark did it first
+		return s.kv.CompareAndSwap(ctx, s.prefix+key, stored, value, ttl)
+	}
+
+	return false, nil
+}
+
+func (s *KVSpentStore) IsSpent(ctx context.Context, key string) (bool, error) {
+	value, ok, err := s.kv.Get(ctx, s.prefix+key)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	until, err := kvExpiration(value)
+	if err != nil {
+		return false, err
+	}
+
+	return !clock().After(until), nil
+}
+
+// kvExpiration decodes the expiration held by the value
+func kvExpiration(value []byte) (time.Time, error) {
+	if len(value) != 8 {
+		return time.Time{}, fmt.Errorf("invalid spent stamp value of %d bytes", len(value))
+	}
+
+	return time.Unix(0, int64(binary.BigEndian.Uint64(value))), nil
+}
+
+func (s *KVSpentStore) Delete(ctx context.Context, key string) error {
+	deleter, ok := s.kv.(KVDeleter)
+	if !ok {
+		return fmt.Errorf("%w: the key-value store does not implement delete", errors.ErrUnsupported)
+	}
+
+	return deleter.Delete(ctx, s.prefix+key)
+}
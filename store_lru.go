@@ -0,0 +1,115 @@
+package hashcache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type lruEntry struct {
+	key       string
+	expiresAt time.Time
+}
+
+// LRUStore is a SpentStampStore holding at most a fixed number of
+// entries, evicting the least recently used one when full. Memory stays
+// bounded under attack, at the price of forgetting stamps that are not
+// expired yet, which EvictionsBeforeExpiry counts, so that operators can
+// tell when the cap is eroding the replay protection.
+type LRUStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+
+	evictedBeforeExpiry uint64
+}
+
+func NewLRUStore(capacity int) *LRUStore {
+	return &LRUStore{
+		capacity: max(capacity, 1),
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (s *LRUStore) MarkSpent(_ context.Context, key string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := clock()
+	if el, ok := s.entries[key]; ok {
+		entry := el.Value.(*lruEntry)
+		if !now.After(entry.expiresAt) {
+			s.order.MoveToFront(el)
+			return false, nil
+		}
+
+		entry.expiresAt = expiresAt
+		s.order.MoveToFront(el)
+		return true, nil
+	}
+
+	s.entries[key] = s.order.PushFront(&lruEntry{key: key, expiresAt: expiresAt})
+
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		entry := oldest.Value.(*lruEntry)
+		if !now.After(entry.expiresAt) {
+			s.evictedBeforeExpiry++
+		}
+
+		s.order.Remove(oldest)
+		delete(s.entries, entry.key)
+	}
+
+	return true, nil
+}
+
+func (s *LRUStore) IsSpent(_ context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return false, nil
+	}
+
+	if clock().After(el.Value.(*lruEntry).expiresAt) {
+		s.order.Remove(el)
+		delete(s.entries, key)
+		return false, nil
+	}
+
+	s.order.MoveToFront(el)
+	return true, nil
+}
+
+func (s *LRUStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		s.order.Remove(el)
+		delete(s.entries, key)
+	}
+
+	return nil
+}
+
+func (s *LRUStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.order.Len()
+}
+
+// EvictionsBeforeExpiry is the number of entries evicted
+// to make room while they were still protecting against replays
+func (s *LRUStore) EvictionsBeforeExpiry() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.evictedBeforeExpiry
+}
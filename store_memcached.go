@@ -0,0 +1,56 @@
+package hashcache
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+const defaultMemcachedPrefix = "hashcache:"
+
+// MemcachedClient is the subset of a memcached client the store needs,
+// e.g. a thin wrapper of github.com/bradfitz/gomemcache, where Add maps
+// memcache.ErrNotStored to false and Exists maps memcache.ErrCacheMiss
+// to false.
+type MemcachedClient interface {
+	// Add stores the value unless the key exists, reporting whether it did.
+	// The ttl is in whole seconds as memcached expects it.
+	Add(ctx context.Context, key string, value []byte, ttlSeconds int32) (bool, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// MemcachedStore is a SpentStampStore shared by all the processes
+// using the same memcached, relying on its add-with-TTL semantics
+type MemcachedStore struct {
+	client MemcachedClient
+	prefix string
+}
+
+func NewMemcachedStore(client MemcachedClient) *MemcachedStore {
+	return &MemcachedStore{client: client, prefix: defaultMemcachedPrefix}
+}
+
+func (s *MemcachedStore) MarkSpent(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	remaining, ok := spentTTL(expiresAt, clock())
+	if !ok {
+		return true, nil
+	}
+
+	ttl := math.Ceil(remaining.Seconds())
+
+	// memcached takes expirations over 30 days as unix timestamps
+	if ttl > 30*24*60*60 {
+		ttl = float64(expiresAt.Unix()) + 1
+	}
+
+	return s.client.Add(ctx, s.prefix+key, []byte{1}, int32(min(ttl, math.MaxInt32)))
+}
+
+func (s *MemcachedStore) IsSpent(ctx context.Context, key string) (bool, error) {
+	return s.client.Exists(ctx, s.prefix+key)
+}
+
+func (s *MemcachedStore) Delete(ctx context.Context, key string) error {
+	return s.client.Delete(ctx, s.prefix+key)
+}
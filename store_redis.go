@@ -0,0 +1,91 @@
+package hashcache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const defaultRedisPrefix = "hashcache:"
+
+// RedisClient is the subset of a Redis client the store needs,
+// e.g. a thin wrapper of github.com/redis/go-redis
+type RedisClient interface {
+	// SetNXPipeline sends SET key 1 NX PX ttl for every key in a single
+	// pipeline, reporting per key whether it was set
+	SetNXPipeline(ctx context.Context, keys []string, ttls []time.Duration) ([]bool, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Del(ctx context.Context, key string) error
+}
+
+// RedisStore is a SpentStampStore shared by all the processes using the
+// same Redis, it checks batches of stamps in a single round trip
+type RedisStore struct {
+	client RedisClient
+	prefix string
+}
+
+func NewRedisStore(client RedisClient) *RedisStore {
+	return &RedisStore{client: client, prefix: defaultRedisPrefix}
+}
+
+func (s *RedisStore) MarkSpent(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	fresh, err := s.MarkSpentBatch(ctx, []string{key}, []time.Time{expiresAt})
+	if err != nil {
+		return false, err
+	}
+
+	return fresh[0], nil
+}
+
+func (s *RedisStore) MarkSpentBatch(ctx context.Context, keys []string, expiresAt []time.Time) ([]bool, error) {
+	if len(keys) != len(expiresAt) {
+		return nil, fmt.Errorf("got %d keys and %d expirations", len(keys), len(expiresAt))
+	}
+
+	now := clock()
+	fresh := make([]bool, len(keys))
+	prefixed := make([]string, 0, len(keys))
+	ttls := make([]time.Duration, 0, len(keys))
+	// positions of the keys sent to redis in the batch
+	sent := make([]int, 0, len(keys))
+
+	for i, key := range keys {
+		ttl, ok := spentTTL(expiresAt[i], now)
+		if !ok {
+			fresh[i] = true
+			continue
+		}
+
+		prefixed = append(prefixed, s.prefix+key)
+		ttls = append(ttls, max(ttl, time.Millisecond))
+		sent = append(sent, i)
+	}
+
+	if len(sent) == 0 {
+		return fresh, nil
+	}
+
+	set, err := s.client.SetNXPipeline(ctx, prefixed, ttls)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(set) != len(sent) {
+		return nil, fmt.Errorf("redis pipeline returned %d results for %d keys", len(set), len(sent))
+	}
+
+	for j, i := range sent {
+		fresh[i] = set[j]
+	}
+
+	return fresh, nil
+}
+
+func (s *RedisStore) IsSpent(ctx context.Context, key string) (bool, error) {
+	return s.client.Exists(ctx, s.prefix+key)
+}
+
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key)
+}
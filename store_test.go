@@ -0,0 +1,412 @@
+package hashcache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSpentStampStore is the behavior shared by all the store backends
+func testSpentStampStore(t *testing.T, s SpentStampStore) {
+	t.Helper()
+
+	ctx := context.Background()
+	live := clock().Add(time.Hour)
+
+	fresh, err := s.MarkSpent(ctx, "stamp", live)
+	require.NoError(t, err)
+	assert.True(t, fresh)
+
+	fresh, err = s.MarkSpent(ctx, "stamp", live)
+	require.NoError(t, err)
+	assert.False(t, fresh)
+
+	spent, err := s.IsSpent(ctx, "stamp")
+	require.NoError(t, err)
+	assert.True(t, spent)
+
+	spent, err = s.IsSpent(ctx, "unknown")
+	require.NoError(t, err)
+	assert.False(t, spent)
+
+	require.NoError(t, s.Delete(ctx, "stamp"))
+	spent, err = s.IsSpent(ctx, "stamp")
+	require.NoError(t, err)
+	assert.False(t, spent)
+}
+
+func TestSpentStampStores(t *testing.T) {
+	t.Parallel()
+
+	stores := map[string]SpentStampStore{
+		"memory":       NewMemoryStore(),
+		"lru":          NewLRUStore(10),
+		"memcached":    NewMemcachedStore(newFakeMemcached()),
+		"dynamodb":     NewDynamoDBStore(newFakeDynamoDB(), "stamps"),
+		"kv":           NewKVSpentStore(newFakeKV()),
+		"redis":        NewRedisStore(newFakeRedis()),
+		"instrumented": NewInstrumentedStore(NewMemoryStore(), NewStoreMetrics()),
+	}
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			testSpentStampStore(t, s)
+		})
+	}
+}
+
+func TestKVSpentStore_Expired(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	// the fake keeps the keys past their ttl like a store without expiration
+	ctx := context.Background()
+	s := NewKVSpentStore(newFakeKV())
+
+	fresh, err := s.MarkSpent(ctx, "stamp", now.Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, fresh)
+
+	now = now.Add(2 * time.Minute)
+	spent, err := s.IsSpent(ctx, "stamp")
+	require.NoError(t, err)
+	assert.False(t, spent)
+
+	fresh, err = s.MarkSpent(ctx, "stamp", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, fresh, "the expired entry is not a replay")
+
+	fresh, err = s.MarkSpent(ctx, "stamp", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, fresh)
+
+	spent, err = s.IsSpent(ctx, "stamp")
+	require.NoError(t, err)
+	assert.True(t, spent)
+}
+
+type fakeMemcached struct {
+	mu    sync.Mutex
+	items map[string][]byte
+}
+
+func newFakeMemcached() *fakeMemcached {
+	return &fakeMemcached{items: make(map[string][]byte)}
+}
+
+func (f *fakeMemcached) Add(_ context.Context, key string, value []byte, _ int32) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.items[key]; ok {
+		return false, nil
+	}
+
+	f.items[key] = value
+	return true, nil
+}
+
+func (f *fakeMemcached) Exists(_ context.Context, key string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, ok := f.items[key]
+	return ok, nil
+}
+
+func (f *fakeMemcached) Delete(_ context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.items, key)
+	return nil
+}
+
+type fakeDynamoDB struct {
+	mu    sync.Mutex
+	items map[string]int64
+}
+
+func newFakeDynamoDB() *fakeDynamoDB {
+	return &fakeDynamoDB{items: make(map[string]int64)}
+}
+
+func (f *fakeDynamoDB) ConditionalPut(_ context.Context, put DynamoDBPut) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if exp, ok := f.items[put.Key]; ok && exp >= put.Now {
+		return false, nil
+	}
+
+	f.items[put.Key] = put.ExpiresAt
+	return true, nil
+}
+
+func (f *fakeDynamoDB) GetExpiration(_ context.Context, _, _, key, _ string) (int64, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	exp, ok := f.items[key]
+	return exp, ok, nil
+}
+
+func (f *fakeDynamoDB) DeleteItem(_ context.Context, _, _, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.items, key)
+	return nil
+}
+
+type fakeKV struct {
+	mu    sync.Mutex
+	items map[string][]byte
+}
+
+func newFakeKV() *fakeKV {
+	return &fakeKV{items: make(map[string][]byte)}
+}
+
+func (f *fakeKV) Get(_ context.Context, key string) ([]byte, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	value, ok := f.items[key]
+	return value, ok, nil
+}
+
+func (f *fakeKV) SetNX(_ context.Context, key string, value []byte, _ time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.items[key]; ok {
+		return false, nil
+	}
+
+	f.items[key] = value
+	return true, nil
+}
+
+func (f *fakeKV) CompareAndSwap(_ context.Context, key string, old, value []byte, _ time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if current, ok := f.items[key]; !ok || !bytes.Equal(current, old) {
+		return false, nil
+	}
+
+	f.items[key] = value
+	return true, nil
+}
+
+func (f *fakeKV) Delete(_ context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.items, key)
+	return nil
+}
+
+type fakeRedis struct {
+	fakeKV
+	pipelines int
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{fakeKV: fakeKV{items: make(map[string][]byte)}}
+}
+
+func (f *fakeRedis) SetNXPipeline(ctx context.Context, keys []string, ttls []time.Duration) ([]bool, error) {
+	f.mu.Lock()
+	f.pipelines++
+	f.mu.Unlock()
+
+	set := make([]bool, len(keys))
+	for i, key := range keys {
+		set[i], _ = f.SetNX(ctx, key, []byte{1}, ttls[i])
+	}
+
+	return set, nil
+}
+
+func (f *fakeRedis) Exists(ctx context.Context, key string) (bool, error) {
+	_, ok, err := f.Get(ctx, key)
+	return ok, err
+}
+
+func (f *fakeRedis) Del(ctx context.Context, key string) error {
+	return f.Delete(ctx, key)
+}
+
+func (f *fakeRedis) DelExisted(ctx context.Context, key string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, ok := f.items[key]
+	delete(f.items, key)
+	return ok, nil
+}
+
+func TestVerifier_VerifyBatch(t *testing.T) {
+	t.Parallel()
+
+	headers := make([]Header, 3)
+	for i := range headers {
+		h, err := ChallengeTemplate{ZeroBits: 1, TTL: time.Hour}.Issue(fmt.Sprintf("127.0.0.%d", i))
+		require.NoError(t, err)
+		headers[i], err = Compute(context.Background(), h, 0)
+		require.NoError(t, err)
+	}
+
+	// a replay within the batch and an invalid proof
+	headers = append(headers, headers[0], Header{Algorithm: algSha1, Rand: headers[0].Rand})
+
+	redis := newFakeRedis()
+	v := NewVerifier(WithSpentStore(NewRedisStore(redis)))
+	errs := v.VerifyBatch(context.Background(), "client", headers)
+
+	require.Len(t, errs, len(headers))
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.NoError(t, errs[2])
+	assert.ErrorIs(t, errs[3], ErrStampSpent)
+	assert.Error(t, errs[4])
+	assert.Equal(t, 1, redis.pipelines)
+}
+
+func TestMemoryStore_Janitor(t *testing.T) {
+	t.Parallel()
+
+	s := NewMemoryStore(WithJanitorInterval(5 * time.Millisecond))
+	ctx := context.Background()
+	defer s.Close(ctx)
+
+	fresh, err := s.MarkSpent(ctx, "expired", clock().Add(-time.Second))
+	require.NoError(t, err)
+	assert.True(t, fresh)
+
+	fresh, err = s.MarkSpent(ctx, "live", clock().Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, fresh)
+
+	fresh, err = s.MarkSpent(ctx, "live", clock().Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, fresh)
+
+	assert.Eventually(t, func() bool { return s.Len() == 1 }, time.Second, time.Millisecond)
+
+	spent, err := s.IsSpent(ctx, "live")
+	require.NoError(t, err)
+	assert.True(t, spent)
+
+	require.NoError(t, s.Close(ctx))
+	require.NoError(t, s.Close(ctx))
+}
+
+func TestLRUStore(t *testing.T) {
+	t.Parallel()
+
+	s := NewLRUStore(2)
+	ctx := context.Background()
+	live := clock().Add(time.Hour)
+
+	for _, key := range []string{"a", "b"} {
+		fresh, err := s.MarkSpent(ctx, key, live)
+		require.NoError(t, err)
+		assert.True(t, fresh)
+	}
+
+	spent, err := s.IsSpent(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, spent)
+
+	fresh, err := s.MarkSpent(ctx, "c", live)
+	require.NoError(t, err)
+	assert.True(t, fresh)
+
+	assert.Equal(t, 2, s.Len())
+	assert.Equal(t, uint64(1), s.EvictionsBeforeExpiry())
+
+	spent, err = s.IsSpent(ctx, "b")
+	require.NoError(t, err)
+	assert.False(t, spent, "least recently used entry is evicted")
+}
+
+func TestInstrumentedStore(t *testing.T) {
+	t.Parallel()
+
+	metrics := NewStoreMetrics(time.Hour)
+	s := NewInstrumentedStore(NewMemoryStore(), metrics)
+	testSpentStampStore(t, s)
+
+	markSpent := metrics.Stats(StoreOpMarkSpent)
+	assert.Equal(t, uint64(2), markSpent.Calls)
+	assert.Equal(t, uint64(1), markSpent.Hits)
+	assert.Equal(t, uint64(1), markSpent.Misses)
+	assert.Equal(t, []uint64{2, 0}, markSpent.Latency)
+	assert.Zero(t, markSpent.ErrorRate())
+
+	isSpent := metrics.Stats(StoreOpIsSpent)
+	assert.Equal(t, uint64(3), isSpent.Calls)
+	assert.Equal(t, uint64(1), isSpent.Hits)
+}
+
+func TestCloseAll(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewMemoryStore(WithJanitorInterval(time.Millisecond))
+	m := NewMiner()
+
+	require.NoError(t, CloseAll(ctx, s, NewInstrumentedStore(NewMemoryStore(), NewStoreMetrics()), m, nil))
+
+	select {
+	case <-s.stopped:
+	default:
+		t.Fatal("janitor is still running")
+	}
+
+	job := m.Submit(ctx, Header{}, PriorityNormal)
+	<-job.Done()
+	_, err := job.Result()
+	assert.ErrorIs(t, err, ErrMinerClosed)
+}
+
+func TestIssuedChallengeStores(t *testing.T) {
+	stores := map[string]func() IssuedChallengeStore{
+		"memory": func() IssuedChallengeStore { return NewMemoryChallengeStore() },
+		"redis":  func() IssuedChallengeStore { return NewRedisChallengeStore(newFakeRedis()) },
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+			clock = func() time.Time { return now }
+
+			ctx := context.Background()
+			v := NewVerifier(WithIssuedChallenges(newStore()))
+
+			challenge, err := ChallengeTemplate{ZeroBits: 1, TTL: time.Hour}.Issue("127.0.0.1")
+			require.NoError(t, err)
+			h, err := Compute(ctx, challenge, 0)
+			require.NoError(t, err)
+
+			assert.ErrorIs(t, v.VerifyFor(ctx, "client", h), ErrUnknownChallenge)
+
+			require.NoError(t, v.RecordChallenge(ctx, challenge))
+			assert.ErrorIs(t, v.VerifyFor(ContextWithTenant(ctx, "other"), "client", h), ErrUnknownChallenge)
+			require.NoError(t, v.VerifyFor(ctx, "client", h))
+			assert.ErrorIs(t, v.VerifyFor(ctx, "client", h), ErrUnknownChallenge)
+
+			require.NoError(t, v.RecordChallenge(ctx, challenge))
+			assert.Equal(t, []error{nil, ErrUnknownChallenge}, v.VerifyBatch(ctx, "client", []Header{h, h}))
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package hashcache
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type SystemConfig struct {
+	// Logger of the verification decisions, none by default
+	Logger *slog.Logger
+
+	// VerifierOptions and MiddlewareOptions applied
+	// after the ones of the config
+	VerifierOptions   []VerifierOption
+	MiddlewareOptions []MiddlewareOption
+}
+
+type SystemOption func(*SystemConfig)
+
+// WithSystemLogger logs the verification decisions, see NewLogAuditor
+func WithSystemLogger(l *slog.Logger) SystemOption {
+	return func(cfg *SystemConfig) {
+		cfg.Logger = l
+	}
+}
+
+func WithSystemVerifierOptions(opts ...VerifierOption) SystemOption {
+	return func(cfg *SystemConfig) {
+		cfg.VerifierOptions = append(cfg.VerifierOptions, opts...)
+	}
+}
+
+func WithSystemMiddlewareOptions(opts ...MiddlewareOption) SystemOption {
+	return func(cfg *SystemConfig) {
+		cfg.MiddlewareOptions = append(cfg.MiddlewareOptions, opts...)
+	}
+}
+
+// System is the issuer and the verifier of a service wired together
+type System struct {
+	Store      SpentStampStore
+	Verifier   *Verifier
+	Middleware *Middleware
+	Histogram  *WorkHistogram
+
+	// Controller of the difficulty, nil when disabled by the config
+	Controller *DifficultyController
+}
+
+// NewSystem wires the store, the verifier, the middleware issuing the
+// challenges, the difficulty controller, the work histogram and the
+// logging of the decisions from the config, for the common case of a
+// service both issuing and verifying its stamps:
+//
+//	sys, err := hashcache.NewSystem(cfg, hashcache.WithSystemLogger(slog.Default()))
+//	mux.Handle("/challenge", sys.ChallengeHandler())
+//	mux.Handle("/", sys.Handler(app))
+//	adminMux.Handle("/admin/", http.StripPrefix("/admin", sys.AdminHandler()))
+//	defer sys.Close(ctx)
+//
+// The solve reports of the clients feed the controller, the difficulty of
+// which is the floor of the escalation of the middleware.
+func NewSystem(cfg Config, opts ...SystemOption) (*System, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	var sysCfg SystemConfig
+	for _, opt := range opts {
+		opt(&sysCfg)
+	}
+
+	sys := &System{
+		Store:      cfg.NewStore(),
+		Histogram:  NewWorkHistogram(),
+		Controller: cfg.NewDifficultyController(),
+	}
+
+	verifierOpts := []VerifierOption{WithWorkHistogram(sys.Histogram)}
+	if sys.Controller != nil {
+		verifierOpts = append(verifierOpts, WithSolveReports(sys.Controller))
+	}
+	if sysCfg.Logger != nil {
+		verifierOpts = append(verifierOpts, WithAuditor(NewLogAuditor(sysCfg.Logger)))
+	}
+	sys.Verifier = cfg.NewVerifier(sys.Store, append(verifierOpts, sysCfg.VerifierOptions...)...)
+
+	sys.Middleware = cfg.NewMiddleware(sys.Verifier, sysCfg.MiddlewareOptions...)
+	if sys.Controller != nil {
+		sys.Middleware.cfg.Escalation = controllerEscalation{sys.Middleware.cfg.Escalation, sys.Controller}
+	}
+
+	return sys, nil
+}
+
+// Handler guards the next handler, see Middleware.Handler
+func (s *System) Handler(next http.Handler) http.Handler {
+	return s.Middleware.Handler(next)
+}
+
+// ChallengeHandler issues the challenges, see Middleware.ChallengeHandler
+func (s *System) ChallengeHandler() http.Handler {
+	return s.Middleware.ChallengeHandler()
+}
+
+// AdminHandler serves the operator endpoints, see NewAdminHandler
+func (s *System) AdminHandler() http.Handler {
+	opts := []AdminOption{WithAdminMiddleware(s.Middleware)}
+	if s.Controller != nil {
+		opts = append(opts, WithAdminController(s.Controller))
+	}
+
+	return NewAdminHandler(s.Verifier, opts...)
+}
+
+// Close the store of the system
+func (s *System) Close(ctx context.Context) error {
+	closer, _ := s.Store.(Closer)
+	return CloseAll(ctx, closer)
+}
+
+// controllerEscalation raises the escalation to the difficulty of the controller
+type controllerEscalation struct {
+	EscalationPolicy
+	c *DifficultyController
+}
+
+func (e controllerEscalation) Required(clientKey string) Escalation {
+	esc := e.EscalationPolicy.Required(clientKey)
+	esc.ZeroBits = max(esc.ZeroBits, e.c.ZeroBits())
+	return esc
+}
+
+// NewLogAuditor logs the accepted stamps at the debug level
+// and the rejected ones at the info level
+func NewLogAuditor(l *slog.Logger) Auditor {
+	return AuditorFunc(func(rec AuditRecord) {
+		level := slog.LevelDebug
+		if rec.Decision == AuditReject {
+			level = slog.LevelInfo
+		}
+
+		l.LogAttrs(context.Background(), level, "hashcash "+string(rec.Decision),
+			slog.String("client", rec.ClientKey),
+			slog.String("resource", rec.Resource),
+			slog.String("tenant", rec.Tenant),
+			slog.String("reason", rec.Reason),
+			slog.Duration("latency", rec.Latency),
+			slog.Bool("shadow", rec.Shadow),
+		)
+	})
+}
@@ -0,0 +1,54 @@
+package hashcache
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// ChallengeTemplate holds the policy of issued challenges in one place,
+// so that servers stamp out consistent challenges and policy changes
+// are a one-line edit.
+type ChallengeTemplate struct {
+	// Algorithm of the challenges, DefaultAlgorithm when empty
+	Algorithm string
+	ZeroBits  uint8
+	TTL       time.Duration
+
+	// Ext is the default extension of the challenges
+	Ext string
+
+	// Hints for the solvers embedded in the extension when set
+	Hints *ChallengeHints
+
+	// Options passed to New
+	Options []HeaderOption
+}
+
+// Issue a challenge for the resource
+func (t ChallengeTemplate) Issue(resource string) (Header, error) {
+	opts := t.Options
+	if t.Algorithm != "" {
+		// the zero bits are validated against the algorithm
+		opts = append(slices.Clip(opts), WithAlgorithm(t.Algorithm))
+	}
+
+	h, err := New(resource, t.ZeroBits, t.TTL, opts...)
+	if err != nil {
+		return Header{}, err
+	}
+
+	h.Ext = t.Ext
+	if t.Hints != nil {
+		hints := *t.Hints
+		if hints.ExpectedIterations == 0 {
+			hints.ExpectedIterations = math.MaxUint64
+			if h.ZeroBits < 16 {
+				hints.ExpectedIterations = 1 << (4 * uint64(h.ZeroBits))
+			}
+		}
+		h.Ext = hints.withExt(h.Ext)
+	}
+
+	return h, nil
+}
@@ -0,0 +1,67 @@
+package hashcache
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChallengeTemplate_Issue(t *testing.T) {
+	t.Parallel()
+
+	tmpl := ChallengeTemplate{Algorithm: algSha512, ZeroBits: 4, TTL: time.Minute, Ext: "v=1"}
+
+	h, err := tmpl.Issue("127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, algSha512, h.Algorithm)
+	assert.Equal(t, uint8(4), h.ZeroBits)
+	assert.Equal(t, "v=1", h.Ext)
+
+	_, err = ChallengeTemplate{Algorithm: "md5"}.Issue("127.0.0.1")
+	assert.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+
+	// the zero bits are bounded by the algorithm of the template
+	_, err = ChallengeTemplate{Algorithm: algSha1, ZeroBits: 41, TTL: time.Minute}.Issue("127.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidZeroBits)
+	_, err = ChallengeTemplate{Algorithm: algSeqSha256, ZeroBits: 41, TTL: time.Minute}.Issue("127.0.0.1")
+	assert.ErrorIs(t, err, ErrInvalidZeroBits)
+}
+
+func TestChallengeTemplate_Hints(t *testing.T) {
+	t.Parallel()
+
+	tmpl := ChallengeTemplate{
+		ZeroBits: 4,
+		TTL:      time.Minute,
+		Ext:      "v=1",
+		Hints:    &ChallengeHints{Concurrency: 2, Algorithms: []string{algSha512, algSha256}},
+	}
+
+	h, err := tmpl.Issue("127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, "v=1;conc=2;iter=65536;algs=sha-512,sha-256", h.Ext)
+
+	hints := ParseHints(h.Ext)
+	assert.Equal(t, ChallengeHints{
+		Concurrency:        2,
+		ExpectedIterations: 65536,
+		Algorithms:         []string{algSha512, algSha256},
+	}, hints)
+	assert.Equal(t, []string{algSha512, algSha256, algSha1}, hints.PreferredOrder([]string{algSha1, algSha256, algSha512}))
+
+	assert.Equal(t, ChallengeHints{}, ParseHints("conc=many;iter=-1"))
+	assert.Equal(t, 0, ParseHints("conc=-3").concurrency())
+	assert.Equal(t, runtime.NumCPU(), ParseHints("conc=100000000").concurrency())
+
+	stamp, err := SolveChallenge(context.Background(), h.String(), 0)
+	require.NoError(t, err)
+
+	solved, err := Parse(stamp)
+	require.NoError(t, err)
+	assert.True(t, solved.Valid())
+	assert.Equal(t, h.Ext, solved.Ext)
+}
@@ -0,0 +1,82 @@
+package hashcache
+
+import (
+	"context"
+	"maps"
+)
+
+type tenantContextKey struct{}
+
+// ContextWithTenant makes VerifyFor and VerifyBatch apply the policy
+// and the spent stamp namespace of the tenant, e.g. an API key or a host
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+func TenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenant
+}
+
+// SetTenantPolicy swaps the policy of the tenant like SetPolicy does
+// for the default policy, which applies to the tenants without one
+func (v *Verifier) SetTenantPolicy(tenant string, p VerifierPolicy) {
+	p = p.clone()
+	p.MinRandBytes = max(p.MinRandBytes, MinRandBytes)
+
+	v.tenantsMu.Lock()
+	defer v.tenantsMu.Unlock()
+
+	tenants := make(map[string]*VerifierPolicy)
+	if current := v.tenants.Load(); current != nil {
+		tenants = maps.Clone(*current)
+	}
+	tenants[tenant] = &p
+	v.tenants.Store(&tenants)
+
+	if v.cfg.Revocations != nil {
+		v.cfg.Revocations.cover(&p)
+	}
+}
+
+// RemoveTenant makes the tenant fall back to the default policy
+func (v *Verifier) RemoveTenant(tenant string) {
+	v.tenantsMu.Lock()
+	defer v.tenantsMu.Unlock()
+
+	current := v.tenants.Load()
+	if current == nil {
+		return
+	}
+
+	tenants := maps.Clone(*current)
+	delete(tenants, tenant)
+	v.tenants.Store(&tenants)
+}
+
+// TenantPolicy is the policy applied to the tenant
+func (v *Verifier) TenantPolicy(tenant string) VerifierPolicy {
+	return v.policyFor(tenant).clone()
+}
+
+func (v *Verifier) policyFor(tenant string) *VerifierPolicy {
+	if tenant != "" {
+		if tenants := v.tenants.Load(); tenants != nil {
+			if p, ok := (*tenants)[tenant]; ok {
+				return p
+			}
+		}
+	}
+
+	return v.policy.Load()
+}
+
+// tenantStampKey namespaces the spent stamps of the tenants,
+// so that the stamps of one tenant are not spent for the others
+func tenantStampKey(tenant string, h Header) string {
+	if tenant == "" {
+		return StampKey(h)
+	}
+
+	return tenant + ":" + StampKey(h)
+}
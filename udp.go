@@ -0,0 +1,249 @@
+package hashcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// UDPChallengeSize is the size of the challenge packets, the server
+	// drops the packets without a valid stamp smaller than it, so that
+	// its responses to spoofed sources never amplify the traffic
+	UDPChallengeSize = 1200
+
+	// maxUDPPacket is the largest UDP payload
+	maxUDPPacket = 1<<16 - 1
+
+	defaultUDPChallengeTTL = 30 * time.Second
+)
+
+var ErrInvalidUDPPacket = newError(CodeInvalidUDPPacket, "invalid udp packet")
+
+type UDPConfig struct {
+	// Verifier of the stamps, it should have a spent store
+	// for the stamps not to be replayed
+	Verifier *Verifier
+
+	// ZeroBits required from the clients
+	ZeroBits uint8
+
+	// ChallengeTTL is the time the clients have to solve a challenge
+	ChallengeTTL time.Duration
+
+	// Key signs the challenges, a random one by default
+	Key []byte
+}
+
+type UDPOption func(*UDPConfig)
+
+func WithUDPVerifier(v *Verifier) UDPOption {
+	return func(cfg *UDPConfig) {
+		cfg.Verifier = v
+	}
+}
+
+func WithUDPZeroBits(zeroBits uint8) UDPOption {
+	return func(cfg *UDPConfig) {
+		cfg.ZeroBits = zeroBits
+	}
+}
+
+func WithUDPChallengeTTL(ttl time.Duration) UDPOption {
+	return func(cfg *UDPConfig) {
+		cfg.ChallengeTTL = ttl
+	}
+}
+
+// WithUDPKey signs the challenges with the key,
+// e.g. shared by the servers behind an anycast address
+func WithUDPKey(key []byte) UDPOption {
+	return func(cfg *UDPConfig) {
+		cfg.Key = key
+	}
+}
+
+// UDPHandler does the work of a packet carrying a valid stamp,
+// returning the response or nil for none
+type UDPHandler func(ctx context.Context, addr net.Addr, payload []byte) []byte
+
+// UDPServer guards a UDP protocol with proof of work. A packet is the
+// stamp followed by a newline and the payload. Packets without a valid
+// stamp are answered with a signed challenge of UDPChallengeSize bytes,
+// and only when they are at least as large, see UDPHello. The challenges
+// are bound to the source address of the packet, so that a stamp solved
+// for an address can not be replayed from, or reflected to, another one.
+type UDPServer struct {
+	cfg      UDPConfig
+	resource string
+	handler  UDPHandler
+}
+
+// NewUDPServer guards the handler of the resource, e.g. "dns.example.com"
+func NewUDPServer(resource string, handler UDPHandler, opts ...UDPOption) (*UDPServer, error) {
+	cfg := UDPConfig{
+		ZeroBits:     1,
+		ChallengeTTL: defaultUDPChallengeTTL,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.Verifier == nil {
+		cfg.Verifier = NewVerifier(WithMinZeroBits(cfg.ZeroBits), WithSpentStore(NewMemoryStore()))
+	}
+
+	if len(cfg.Key) == 0 {
+		cfg.Key = make([]byte, 32)
+		if _, err := rand.Read(cfg.Key); err != nil {
+			return nil, errors.Join(ErrRandomFailed, err)
+		}
+	}
+
+	return &UDPServer{cfg: cfg, resource: resource, handler: handler}, nil
+}
+
+// Serve the packets of the connection until ctx is done or reading fails
+func (s *UDPServer) Serve(ctx context.Context, conn net.PacketConn) error {
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	buf := make([]byte, maxUDPPacket)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		if resp := s.HandlePacket(ctx, addr, buf[:n]); resp != nil {
+			_, _ = conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+// HandlePacket returns the response to the packet, nil meaning none
+func (s *UDPServer) HandlePacket(ctx context.Context, addr net.Addr, packet []byte) []byte {
+	stamp, payload, _ := bytes.Cut(packet, []byte{'\n'})
+
+	if len(stamp) > 0 {
+		err := s.verify(ctx, addr, string(stamp))
+		if err == nil {
+			return s.handler(ctx, addr, payload)
+		}
+	}
+
+	if len(packet) < UDPChallengeSize {
+		return nil
+	}
+
+	challenge, err := s.challenge(addr)
+	if err != nil {
+		return nil
+	}
+
+	return challenge
+}
+
+func (s *UDPServer) challenge(addr net.Addr) ([]byte, error) {
+	tmpl := ChallengeTemplate{ZeroBits: s.cfg.ZeroBits, TTL: s.cfg.ChallengeTTL}
+	h, err := tmpl.Issue(s.addrResource(addr))
+	if err != nil {
+		return nil, err
+	}
+
+	h.Ext = withExtValue(h.Ext, challengeSignatureExtName,
+		base64.RawURLEncoding.EncodeToString(challengeSignature(s.cfg.Key, h)))
+
+	return padUDP([]byte(h.String() + "\n"))
+}
+
+// verify checks the cheap bindings of the stamp before its proof
+func (s *UDPServer) verify(ctx context.Context, addr net.Addr, raw string) error {
+	p := s.cfg.Verifier.Policy()
+	if err := p.prevalidate(raw, s.cfg.ZeroBits, s.cfg.Verifier.cfg.ResourceNormalizer); err != nil {
+		return err
+	}
+
+	h, err := parseWire(raw)
+	if err != nil {
+		return err
+	}
+
+	resource, err := h.rawResource()
+	if err != nil {
+		return err
+	}
+
+	if resource != s.addrResource(addr) {
+		return fmt.Errorf("%w: stamp for '%s'", ErrResourceMismatch, resource)
+	}
+
+	signed, _ := extValue(h.Ext, challengeSignatureExtName)
+	sig, err := base64.RawURLEncoding.DecodeString(signed)
+	if err != nil || !hmac.Equal(sig, challengeSignature(s.cfg.Key, h)) {
+		return ErrInvalidChallengeSignature
+	}
+
+	return s.cfg.Verifier.VerifyFor(ctx, addrHost(addr), h)
+}
+
+// addrResource binds the resource to the source address
+func (s *UDPServer) addrResource(addr net.Addr) string {
+	return s.resource + "@" + addr.String()
+}
+
+func addrHost(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return host
+}
+
+// UDPHello is the packet a client sends for a challenge,
+// padded to UDPChallengeSize
+func UDPHello() []byte {
+	hello, _ := padUDP([]byte("\n"))
+	return hello
+}
+
+// UDPRequest is the packet carrying the stamp and the payload
+func UDPRequest(stamp string, payload []byte) []byte {
+	packet := make([]byte, 0, len(stamp)+1+len(payload))
+	packet = append(packet, stamp...)
+	packet = append(packet, '\n')
+	return append(packet, payload...)
+}
+
+// ParseUDPChallenge parses the challenge packet of the server,
+// to be solved with SolveChallenge
+func ParseUDPChallenge(packet []byte) (string, error) {
+	challenge, _, ok := bytes.Cut(packet, []byte{'\n'})
+	if !ok || len(packet) != UDPChallengeSize {
+		return "", ErrInvalidUDPPacket
+	}
+
+	return string(challenge), nil
+}
+
+// padUDP pads the packet with zeros to UDPChallengeSize
+func padUDP(packet []byte) ([]byte, error) {
+	if len(packet) > UDPChallengeSize {
+		return nil, fmt.Errorf("%w: %d bytes exceed %d", ErrInvalidUDPPacket, len(packet), UDPChallengeSize)
+	}
+
+	return append(packet, make([]byte, UDPChallengeSize-len(packet))...), nil
+}
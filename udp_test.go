@@ -0,0 +1,93 @@
+package hashcache
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUDPServer(t *testing.T) {
+	t.Parallel()
+
+	echo := func(_ context.Context, _ net.Addr, payload []byte) []byte {
+		return append([]byte("echo "), payload...)
+	}
+
+	s, err := NewUDPServer("udp.example.com", echo, WithUDPZeroBits(2))
+	require.NoError(t, err)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ctx, conn) }()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	exchange := func(packet []byte) []byte {
+		require.NoError(t, client.SetDeadline(time.Now().Add(5*time.Second)))
+		_, err := client.Write(packet)
+		require.NoError(t, err)
+
+		buf := make([]byte, maxUDPPacket)
+		n, err := client.Read(buf)
+		require.NoError(t, err)
+		return buf[:n]
+	}
+
+	resp := exchange(UDPHello())
+	require.Len(t, resp, UDPChallengeSize, "the challenge is no larger than the hello")
+
+	challenge, err := ParseUDPChallenge(resp)
+	require.NoError(t, err)
+	stamp, err := SolveChallenge(context.Background(), challenge, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, "echo ping", string(exchange(UDPRequest(stamp, []byte("ping")))))
+
+	// a replayed stamp gets a challenge again
+	_, err = ParseUDPChallenge(exchange(append(UDPRequest(stamp, []byte("ping")), UDPHello()...)))
+	require.NoError(t, err)
+
+	cancel()
+	assert.ErrorIs(t, <-served, context.Canceled)
+}
+
+func TestUDPServer_HandlePacket(t *testing.T) {
+	t.Parallel()
+
+	handled := func(context.Context, net.Addr, []byte) []byte { return []byte("done") }
+	s, err := NewUDPServer("udp.example.com", handled, WithUDPKey([]byte("key")))
+	require.NoError(t, err)
+
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 53}
+	other := &net.UDPAddr{IP: net.IPv4(198, 51, 100, 7), Port: 53}
+	ctx := context.Background()
+
+	assert.Nil(t, s.HandlePacket(ctx, addr, []byte("\nsmall")), "small packets are dropped")
+
+	challenge, err := ParseUDPChallenge(s.HandlePacket(ctx, addr, UDPHello()))
+	require.NoError(t, err)
+	stamp, err := SolveChallenge(ctx, challenge, 0)
+	require.NoError(t, err)
+
+	assert.Nil(t, s.HandlePacket(ctx, other, UDPRequest(stamp, nil)), "stamps are bound to the source")
+	assert.ErrorIs(t, s.verify(ctx, other, stamp), ErrResourceMismatch)
+
+	// stamps for challenges the server did not sign are rejected
+	forged, err := New("udp.example.com@"+addr.String(), 1, time.Minute)
+	require.NoError(t, err)
+	forged, err = Compute(ctx, forged, 0)
+	require.NoError(t, err)
+	assert.ErrorIs(t, s.verify(ctx, addr, forged.String()), ErrInvalidChallengeSignature)
+
+	assert.Equal(t, "done", string(s.HandlePacket(ctx, addr, UDPRequest(stamp, nil))))
+}
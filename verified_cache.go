@@ -0,0 +1,99 @@
+package hashcache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+type verifiedEntry struct {
+	stamp string
+	hash  string
+}
+
+// verifiedCache remembers the digests of the headers with a valid proof
+// by their strings, at most capacity of them
+type verifiedCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+
+	hits uint64
+}
+
+// WithVerifiedCache keeps the digests of the last verified headers, so
+// that retries and duplicate deliveries of a request skip hashing the
+// stamp again. The policy still applies to them and the spent store
+// still rejects them as replays.
+func WithVerifiedCache(capacity int) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.VerifiedCache = capacity
+	}
+}
+
+func newVerifiedCache(capacity int) *verifiedCache {
+	return &verifiedCache{
+		capacity: max(capacity, 1),
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// lookup the digest of the header with a known valid proof
+func (c *verifiedCache) lookup(stamp string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[stamp]
+	if !ok {
+		return "", false
+	}
+
+	c.hits++
+	c.order.MoveToFront(el)
+	return el.Value.(*verifiedEntry).hash, true
+}
+
+func (c *verifiedCache) hitCount() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.hits
+}
+
+func (c *verifiedCache) add(stamp, hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[stamp]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[stamp] = c.order.PushFront(&verifiedEntry{stamp: stamp, hash: hash})
+
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*verifiedEntry).stamp)
+	}
+}
+
+// valid checks the proof of the header unless it is cached,
+// the returned header carries its digest
+func (c *verifiedCache) valid(ctx context.Context, h Header) (Header, bool) {
+	stamp := h.String()
+	if hash, ok := c.lookup(stamp); ok {
+		h.digest = digestMemo{of: h.fields(), hash: hash}
+		return h, true
+	}
+
+	h = h.memoized()
+	if !h.validContext(ctx) {
+		return h, false
+	}
+
+	c.add(stamp, h.Hash())
+	return h, true
+}
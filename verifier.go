@@ -0,0 +1,624 @@
+package hashcache
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrInvalidProof         = newError(CodeInvalidProof, "invalid proof of work")
+	ErrHeaderExpired        = newError(CodeStampExpired, "header expired")
+	ErrExpirationTooFar     = newError(CodeExpirationTooFar, "header expiration is too far in the future")
+	ErrInsufficientBits     = newError(CodeInsufficientBits, "insufficient zero bits")
+	ErrUnsupportedAlgorithm = newError(CodeUnsupportedAlgorithm, "unsupported algorithm")
+	ErrResourceMismatch     = newError(CodeResourceMismatch, "resource mismatch")
+)
+
+// VerifierPolicy is the part of the verifier configuration
+// which can be swapped at runtime with SetPolicy
+type VerifierPolicy struct {
+	MinZeroBits uint8
+
+	// AlgorithmMinZeroBits override MinZeroBits per algorithm,
+	// since the hash rates of the algorithms differ
+	AlgorithmMinZeroBits map[string]uint8
+
+	// MinRandBytes is the least number of decoded random bytes
+	MinRandBytes int
+
+	// MaxClockSkew tolerated between the clocks of the client and the verifier
+	MaxClockSkew time.Duration
+
+	// MaxTTL limits how far in the future the expiration can be set,
+	// so that stamps can not be minted with a huge replay window.
+	// Zero means no limit.
+	MaxTTL time.Duration
+
+	// Algorithms accepted by the verifier, empty accepts all the
+	// registered ones but the legacy and the sequential ones, which
+	// cost the verifier as much as the client
+	Algorithms []string
+
+	// MaxSequentialZeroBits of the sequential stamps recomputed
+	// by the verifier, zero means 20
+	MaxSequentialZeroBits uint8
+
+	// AllowLegacy accepts the legacy algorithms, i.e. sha-1, which are
+	// otherwise accepted only when listed in Algorithms
+	AllowLegacy bool
+
+	// ReplayGrace keeps the spent stamps past their expiration and the
+	// clock skew, covering the stores evicting on a clock of their own
+	ReplayGrace time.Duration
+
+	// ReplayWindow is the least time the spent stamps are remembered
+	// after being accepted, whatever their expiration.
+	// Zero remembers them for their expiration only.
+	ReplayWindow time.Duration
+
+	// AllowResources are the patterns of the resources accepted,
+	// empty accepts all of them, see WithAllowedResources
+	AllowResources []string
+
+	// DenyResources are the patterns of the resources rejected
+	// before the allowed ones, see WithDeniedResources
+	DenyResources []string
+}
+
+type VerifierConfig struct {
+	VerifierPolicy
+
+	ResourceNormalizer ResourceNormalizer
+
+	// SpentStore protects VerifyFor against replays
+	SpentStore SpentStampStore
+
+	Ledger      *Ledger
+	Chain       *Chain
+	Auditor     Auditor
+	Revocations *RevocationList
+	Histogram   *WorkHistogram
+
+	// IssuedChallenges accepted, see WithIssuedChallenges
+	IssuedChallenges IssuedChallengeStore
+
+	// SolveReports of the stamps feed the controller, see WithSolveReports
+	SolveReports *DifficultyController
+
+	// VerifiedCache is the capacity of the cache of the verified
+	// headers, see WithVerifiedCache
+	VerifiedCache int
+}
+
+type VerifierOption func(*VerifierConfig)
+
+// Verifier checks that headers received from clients carry enough
+// valid and unexpired proof of work.
+type Verifier struct {
+	cfg    VerifierConfig
+	policy atomic.Pointer[VerifierPolicy]
+
+	verified *verifiedCache
+
+	tenantsMu sync.Mutex
+	tenants   atomic.Pointer[map[string]*VerifierPolicy]
+
+	accepted atomic.Uint64
+	rejected atomic.Uint64
+}
+
+// VerifierStats count the decisions made on behalf of clients
+type VerifierStats struct {
+	Accepted uint64 `json:"accepted"`
+	Rejected uint64 `json:"rejected"`
+
+	// CacheHits of the verified cache, see WithVerifiedCache
+	CacheHits uint64 `json:"cache_hits,omitempty"`
+}
+
+func NewVerifier(opts ...VerifierOption) *Verifier {
+	cfg := VerifierConfig{VerifierPolicy: VerifierPolicy{MinRandBytes: MinRandBytes, ReplayGrace: DefaultReplayGrace}}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	v := &Verifier{cfg: cfg}
+	if cfg.VerifiedCache > 0 {
+		v.verified = newVerifiedCache(cfg.VerifiedCache)
+	}
+	v.SetPolicy(cfg.VerifierPolicy)
+	return v
+}
+
+func WithMinZeroBits(zeroBits uint8) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.MinZeroBits = zeroBits
+	}
+}
+
+// WithAlgorithmMinZeroBits requires the zero bits from the stamps
+// of the algorithm instead of the global minimum
+func WithAlgorithmMinZeroBits(alg string, zeroBits uint8) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		if cfg.AlgorithmMinZeroBits == nil {
+			cfg.AlgorithmMinZeroBits = make(map[string]uint8)
+		}
+		cfg.AlgorithmMinZeroBits[alg] = zeroBits
+	}
+}
+
+// WithMinRandBytes raises the minimal length of the random string,
+// values below MinRandBytes are ignored
+func WithMinRandBytes(n int) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.MinRandBytes = max(n, MinRandBytes)
+	}
+}
+
+func WithMaxClockSkew(d time.Duration) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.MaxClockSkew = d
+	}
+}
+
+// WithReplayGrace keeps the spent stamps for the grace
+// past their expiration and the clock skew
+func WithReplayGrace(d time.Duration) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.ReplayGrace = d
+	}
+}
+
+// WithReplayWindow remembers the spent stamps at least for the window
+// after they are accepted, independently from their ttl
+func WithReplayWindow(d time.Duration) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.ReplayWindow = d
+	}
+}
+
+func WithMaxTTL(d time.Duration) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.MaxTTL = d
+	}
+}
+
+// WithResourceNormalizer makes MatchResource compare resources
+// after normalizing both of them
+func WithResourceNormalizer(n ResourceNormalizer) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.ResourceNormalizer = n
+	}
+}
+
+// WithMaxSequentialZeroBits raises or lowers the zero bits of the
+// sequential stamps the verifier recomputes, up to 40
+func WithMaxSequentialZeroBits(zeroBits uint8) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.MaxSequentialZeroBits = zeroBits
+	}
+}
+
+// WithAlgorithms limits the algorithms accepted by the verifier
+func WithAlgorithms(algs ...string) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.Algorithms = algs
+	}
+}
+
+// AllowLegacyAlgorithms accepts the stamps of broken hashes, i.e. sha-1,
+// for deployments which still verify stamps of legacy clients or of the
+// formats of the hashcash specification
+func AllowLegacyAlgorithms() VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.AllowLegacy = true
+	}
+}
+
+// WithLedger makes the verifier credit accepted work to the client key
+// passed to VerifyFor.
+func WithLedger(l *Ledger) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.Ledger = l
+	}
+}
+
+func WithSpentStore(s SpentStampStore) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.SpentStore = s
+	}
+}
+
+// WithChain requires the stamps verified with VerifyFor to form
+// a hash chain per client key.
+func WithChain(c *Chain) VerifierOption {
+	return func(cfg *VerifierConfig) {
+		cfg.Chain = c
+	}
+}
+
+// Policy currently enforced by the verifier
+func (v *Verifier) Policy() VerifierPolicy {
+	return v.policy.Load().clone()
+}
+
+// SetPolicy swaps the policy atomically, verifications in flight
+// complete under the policy they started with. MinRandBytes below
+// the MinRandBytes constant are raised to it.
+func (v *Verifier) SetPolicy(p VerifierPolicy) {
+	p = p.clone()
+	p.MinRandBytes = max(p.MinRandBytes, MinRandBytes)
+	v.policy.Store(&p)
+
+	if v.cfg.Revocations != nil {
+		v.cfg.Revocations.cover(&p)
+	}
+}
+
+func (v *Verifier) Stats() VerifierStats {
+	stats := VerifierStats{Accepted: v.accepted.Load(), Rejected: v.rejected.Load()}
+	if v.verified != nil {
+		stats.CacheHits = v.verified.hitCount()
+	}
+
+	return stats
+}
+
+// Verify the header against the verifier policy
+func (v *Verifier) Verify(h Header) error {
+	_, err := v.verify(context.Background(), v.policy.Load(), h)
+	return err
+}
+
+// verify the header against the policy, the returned header
+// carries its digest
+func (v *Verifier) verify(ctx context.Context, p *VerifierPolicy, h Header) (Header, error) {
+	if err := p.check(h, v.cfg.ResourceNormalizer); err != nil {
+		return h, err
+	}
+
+	valid := false
+	if v.verified != nil {
+		h, valid = v.verified.valid(ctx, h)
+	} else {
+		h = h.memoized()
+		valid = h.validContext(ctx)
+	}
+
+	if !valid {
+		if ctx.Err() != nil {
+			return h, ctx.Err()
+		}
+		return h, ErrInvalidProof
+	}
+
+	return h, v.checkReport(h)
+}
+
+// VerifyString verifies the header string against the policy hashing its
+// bytes exactly as received rather than a re-serialization of the parsed
+// fields, so that stamps of implementations which serialize the fields
+// slightly differently verify as their authors hashed them. The parsed
+// header is returned along with the outcome.
+func VerifyString(raw string, p VerifierPolicy) (Header, error) {
+	h, err := Parse(raw)
+	if err != nil {
+		return Header{}, err
+	}
+
+	p.MinRandBytes = max(p.MinRandBytes, MinRandBytes)
+	if err := p.check(h, nil); err != nil {
+		return h, err
+	}
+
+	if !validRaw(raw, h) {
+		return h, ErrInvalidProof
+	}
+
+	return h, nil
+}
+
+// validRaw checks the work of the counter search on the raw bytes,
+// other work functions verify the parsed header
+func validRaw(raw string, h Header) bool {
+	if _, ok := resolveWorkFunction(h.Algorithm).(hashcashWork); !ok {
+		return h.Valid()
+	}
+
+	hasher := resolveHash(h.Algorithm)
+	hasher.Write([]byte(raw))
+	return VerifyDigest(hasher.Sum(nil), h.ZeroBits)
+}
+
+// check the header against the policy, leaving out its proof,
+// the resource being normalized by n when set
+func (p *VerifierPolicy) check(h Header, n ResourceNormalizer) error {
+	if err := p.checkResource(h, n); err != nil {
+		return err
+	}
+
+	if !p.AcceptsAlgorithm(h.Algorithm) {
+		return fmt.Errorf("%w: '%s'", ErrUnsupportedAlgorithm, h.Algorithm)
+	}
+
+	if minBits := p.MinZeroBitsFor(h.Algorithm); h.ZeroBits < minBits {
+		return fmt.Errorf("%w: got %d, want at least %d", ErrInsufficientBits, h.ZeroBits, minBits)
+	}
+
+	if err := p.checkMaxZeroBits(h.Algorithm, h.ZeroBits); err != nil {
+		return err
+	}
+
+	if err := p.checkRand(h); err != nil {
+		return err
+	}
+
+	return p.checkExpiration(h)
+}
+
+// MatchResource checks that the stamp resource is the expected one
+func (v *Verifier) MatchResource(resource, expected string) error {
+	if n := v.cfg.ResourceNormalizer; n != nil {
+		var err error
+		if resource, err = n(resource); err != nil {
+			return errors.Join(ErrResourceMismatch, err)
+		}
+
+		if expected, err = n(expected); err != nil {
+			return errors.Join(ErrResourceMismatch, err)
+		}
+	}
+
+	if resource != expected {
+		return fmt.Errorf("%w: got '%s', want '%s'", ErrResourceMismatch, resource, expected)
+	}
+
+	return nil
+}
+
+// clone the policy, so that the caller does not share
+// its slices and maps with the verifications in flight
+func (p VerifierPolicy) clone() VerifierPolicy {
+	p.Algorithms = slices.Clone(p.Algorithms)
+	p.AlgorithmMinZeroBits = maps.Clone(p.AlgorithmMinZeroBits)
+	p.AllowResources = slices.Clone(p.AllowResources)
+	p.DenyResources = slices.Clone(p.DenyResources)
+	return p
+}
+
+// MinZeroBitsFor the stamps of the algorithm
+func (p *VerifierPolicy) MinZeroBitsFor(alg string) uint8 {
+	if bits, ok := p.AlgorithmMinZeroBits[alg]; ok {
+		return bits
+	}
+
+	return p.MinZeroBits
+}
+
+// AcceptsAlgorithm tells whether the stamps of the algorithm are accepted
+func (p *VerifierPolicy) AcceptsAlgorithm(alg string) bool {
+	if !isSupportedAlgorithm(alg) {
+		return false
+	}
+
+	if len(p.Algorithms) > 0 {
+		return slices.Contains(p.Algorithms, alg)
+	}
+
+	if isCostlyAlgorithm(alg) {
+		return false
+	}
+
+	return p.AllowLegacy || !isLegacyAlgorithm(alg)
+}
+
+// checkMaxZeroBits bounds the zero bits by what the algorithm can prove
+// and, for the sequential work, by what the verifier recomputes
+func (p *VerifierPolicy) checkMaxZeroBits(alg string, bits uint8) error {
+	switch resolveWorkFunction(alg).(type) {
+	case hashcashWork:
+		// the zero bits are counted in hex digits of the hash
+		if digits := resolveHash(alg).Size() * 2; int(bits) > digits {
+			return fmt.Errorf("%w: %d, the %s hash has %d digits", ErrInvalidZeroBits, bits, alg, digits)
+		}
+	case sequentialWork:
+		if maxBits := p.maxSequentialZeroBits(); bits > maxBits {
+			return fmt.Errorf("%w: %d, at most %d verified for %s", ErrInvalidZeroBits, bits, maxBits, alg)
+		}
+	}
+
+	return nil
+}
+
+func (p *VerifierPolicy) maxSequentialZeroBits() uint8 {
+	if p.MaxSequentialZeroBits == 0 {
+		return defaultMaxSequentialZeroBits
+	}
+
+	return min(p.MaxSequentialZeroBits, maxSequentialBits)
+}
+
+func (p *VerifierPolicy) checkRand(h Header) error {
+	randByt, err := base64.StdEncoding.DecodeString(h.Rand)
+	if err != nil {
+		return fmt.Errorf("%w: invalid base64 encoded rand '%s'", ErrRandTooShort, h.Rand)
+	}
+
+	if len(randByt) < p.MinRandBytes {
+		return fmt.Errorf("%w: %d bytes, at least %d required", ErrRandTooShort, len(randByt), p.MinRandBytes)
+	}
+
+	return nil
+}
+
+func (p *VerifierPolicy) checkExpiration(h Header) error {
+	now := clock()
+	expiration := time.Unix(0, h.Expiration)
+
+	if now.Add(-p.MaxClockSkew).After(expiration) {
+		return fmt.Errorf("%w: at %s", ErrHeaderExpired, expiration.UTC().Format(time.RFC3339))
+	}
+
+	if p.MaxTTL > 0 && expiration.After(now.Add(p.MaxTTL+p.MaxClockSkew)) {
+		return fmt.Errorf("%w: expires at %s, max ttl is %s",
+			ErrExpirationTooFar, expiration.UTC().Format(time.RFC3339), p.MaxTTL)
+	}
+
+	return nil
+}
+
+// VerifyFor verifies the header on behalf of the given client key, marks
+// it spent, advances the client chain and credits the accepted work to
+// the client ledger when those are configured. The policy and the spent
+// stamps of the tenant of the context apply, see ContextWithTenant.
+func (v *Verifier) VerifyFor(ctx context.Context, clientKey string, h Header) error {
+	_, err := v.verifyAudited(ctx, clientKey, h)
+	return err
+}
+
+// verifyAudited is VerifyFor returning the verified header,
+// which carries its digest
+func (v *Verifier) verifyAudited(ctx context.Context, clientKey string, h Header) (Header, error) {
+	start := time.Now()
+	verified, err := v.verifyFor(ctx, clientKey, h)
+	v.audit(ctx, start, clientKey, h, err)
+	return verified, err
+}
+
+func (v *Verifier) verifyFor(ctx context.Context, clientKey string, h Header) (Header, error) {
+	tenant := TenantFromContext(ctx)
+	p := v.policyFor(tenant)
+	h, err := v.verify(ctx, p, h)
+	if err != nil {
+		return h, err
+	}
+
+	if err := v.checkRevoked(ctx, clientKey, h); err != nil {
+		return h, err
+	}
+
+	if err := v.takeChallenge(ctx, tenant, h); err != nil {
+		return h, err
+	}
+
+	if v.cfg.SpentStore != nil {
+		fresh, err := v.cfg.SpentStore.MarkSpent(ctx, tenantStampKey(tenant, h), p.spentUntil(h))
+		if err != nil {
+			return h, err
+		}
+
+		if !fresh {
+			return h, ErrStampSpent
+		}
+	}
+
+	return h, v.accept(clientKey, h)
+}
+
+// VerifyBatch verifies the headers on behalf of the client key like
+// VerifyFor does, returning an error per header, nil for accepted ones.
+// Stores implementing BatchSpentStampStore mark all the stamps spent
+// in a single round trip.
+func (v *Verifier) VerifyBatch(ctx context.Context, clientKey string, headers []Header) []error {
+	start := time.Now()
+	tenant := TenantFromContext(ctx)
+	p := v.policyFor(tenant)
+	errs := make([]error, len(headers))
+	verified := make([]Header, len(headers))
+
+	var keys []string
+	var expirations []time.Time
+	var pending []int
+	for i, h := range headers {
+		if h, errs[i] = v.verify(ctx, p, h); errs[i] != nil {
+			continue
+		}
+		verified[i] = h
+
+		if errs[i] = v.checkRevoked(ctx, clientKey, h); errs[i] != nil {
+			continue
+		}
+
+		if errs[i] = v.takeChallenge(ctx, tenant, h); errs[i] != nil {
+			continue
+		}
+
+		keys = append(keys, tenantStampKey(tenant, h))
+		expirations = append(expirations, p.spentUntil(h))
+		pending = append(pending, i)
+	}
+
+	if v.cfg.SpentStore != nil && len(pending) > 0 {
+		fresh, err := markSpentBatch(ctx, v.cfg.SpentStore, keys, expirations)
+		for j, i := range pending {
+			switch {
+			case err != nil:
+				errs[i] = err
+			case !fresh[j]:
+				errs[i] = ErrStampSpent
+			}
+		}
+	}
+
+	for _, i := range pending {
+		if errs[i] == nil {
+			errs[i] = v.accept(clientKey, verified[i])
+		}
+	}
+
+	for i, h := range headers {
+		v.audit(ctx, start, clientKey, h, errs[i])
+	}
+
+	return errs
+}
+
+// spentUntil is how long the stamp must be remembered as spent, which is
+// for as long as the skew allows it to be accepted after its expiration,
+// plus the grace, and at least for the replay window
+func (p *VerifierPolicy) spentUntil(h Header) time.Time {
+	until := time.Unix(0, h.Expiration).Add(p.MaxClockSkew + p.ReplayGrace)
+	if window := clock().Add(p.ReplayWindow); p.ReplayWindow > 0 && window.After(until) {
+		return window
+	}
+
+	return until
+}
+
+func (v *Verifier) checkRevoked(ctx context.Context, clientKey string, h Header) error {
+	if v.cfg.Revocations == nil {
+		return nil
+	}
+
+	return v.cfg.Revocations.Check(ctx, clientKey, h)
+}
+
+// accept advances the client chain and credits the client ledger
+func (v *Verifier) accept(clientKey string, h Header) error {
+	if v.cfg.Chain != nil {
+		if err := v.cfg.Chain.Accept(clientKey, h); err != nil {
+			return err
+		}
+	}
+
+	if v.cfg.Ledger != nil {
+		if _, err := v.cfg.Ledger.Credit(clientKey, h); err != nil {
+			return err
+		}
+	}
+
+	if v.cfg.Histogram != nil {
+		v.cfg.Histogram.ObserveZeroBits(h.ZeroBits)
+	}
+
+	v.observeReport(h)
+	return nil
+}
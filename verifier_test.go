@@ -0,0 +1,622 @@
+package hashcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifier_VerifyFor(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	h, err := New("my.email@gmail.com", 2, time.Hour)
+	require.NoError(t, err)
+	h, err = Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+
+	t.Run("credits accepted work to the ledger", func(t *testing.T) {
+		ledger := NewLedger(NewMemoryLedgerStore(), time.Hour)
+		v := NewVerifier(WithMinZeroBits(2), WithLedger(ledger))
+
+		require.NoError(t, v.VerifyFor(context.Background(), "client", h))
+
+		balance, err := ledger.Balance("client")
+		require.NoError(t, err)
+		assert.Equal(t, float64(256), balance)
+
+		require.NoError(t, ledger.Spend("client", 200))
+		assert.ErrorIs(t, ledger.Spend("client", 100), ErrInsufficientBalance)
+
+		now = now.Add(time.Hour)
+		balance, err = ledger.Balance("client")
+		require.NoError(t, err)
+		assert.InDelta(t, 28, balance, 0.001)
+	})
+
+	t.Run("credits a bonus for over-proof off-peak", func(t *testing.T) {
+		offPeak := true
+		ledger := NewLedger(NewMemoryLedgerStore(), 0, WithOverProofBonus(OverProofBonus{
+			Required:   1,
+			PerZeroBit: 0.5,
+			OffPeak:    func(time.Time) bool { return offPeak },
+		}))
+
+		achieved, ok := DigestZeroBits(h)
+		require.True(t, ok)
+
+		_, err := ledger.Credit("client", h)
+		require.NoError(t, err)
+		balance, err := ledger.Balance("client")
+		require.NoError(t, err)
+		assert.Equal(t, 256*(1+0.5*float64(achieved-1)), balance)
+
+		offPeak = false
+		_, err = ledger.Credit("peak", h)
+		require.NoError(t, err)
+		balance, err = ledger.Balance("peak")
+		require.NoError(t, err)
+		assert.Equal(t, float64(256), balance)
+	})
+
+	t.Run("requires stamps of a client to form a chain", func(t *testing.T) {
+		v := NewVerifier(WithChain(NewChain()))
+		require.NoError(t, v.VerifyFor(context.Background(), "client", h))
+
+		next, err := New("my.email@gmail.com", 2, time.Hour)
+		require.NoError(t, err)
+		next, err = Compute(context.Background(), next.ChainTo(h), 0)
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, v.VerifyFor(context.Background(), "other", next), ErrBrokenChain)
+		require.NoError(t, v.VerifyFor(context.Background(), "client", next))
+		assert.ErrorIs(t, v.VerifyFor(context.Background(), "client", next), ErrBrokenChain)
+	})
+
+	t.Run("rejects replays", func(t *testing.T) {
+		v := NewVerifier(WithSpentStore(NewMemoryStore()))
+		require.NoError(t, v.VerifyFor(context.Background(), "client", h))
+		assert.ErrorIs(t, v.VerifyFor(context.Background(), "client", h), ErrStampSpent)
+	})
+
+	t.Run("rejects insufficient bits", func(t *testing.T) {
+		v := NewVerifier(WithMinZeroBits(3))
+		assert.ErrorIs(t, v.Verify(h), ErrInsufficientBits)
+	})
+
+	t.Run("rejects short rand", func(t *testing.T) {
+		short := h
+		short.Rand = "c2hvcnQ="
+		assert.ErrorIs(t, NewVerifier().Verify(short), ErrRandTooShort)
+		assert.ErrorIs(t, NewVerifier(WithMinRandBytes(16)).Verify(h), ErrRandTooShort)
+
+		_, err := New("my.email@gmail.com", 2, time.Hour, WithRandBytes(4))
+		assert.ErrorIs(t, err, ErrRandTooShort)
+	})
+
+	t.Run("rejects expiration too far in the future", func(t *testing.T) {
+		far := h
+		far.Expiration = now.Add(time.Hour).UnixNano()
+
+		v := NewVerifier(WithMaxTTL(30*time.Minute), WithMaxClockSkew(time.Minute))
+		assert.ErrorIs(t, v.Verify(far), ErrExpirationTooFar)
+	})
+
+	t.Run("rejects expired header", func(t *testing.T) {
+		now = now.Add(2 * time.Hour)
+		assert.ErrorIs(t, NewVerifier().Verify(h), ErrHeaderExpired)
+		assert.NoError(t, NewVerifier(WithMaxClockSkew(2*time.Hour)).Verify(h))
+	})
+}
+
+func TestVerifier_SetPolicy(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	h, err := New("my.email@gmail.com", 2, time.Hour)
+	require.NoError(t, err)
+	h, err = Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+
+	v := NewVerifier(WithMinZeroBits(2))
+	require.NoError(t, v.Verify(h))
+
+	v.SetPolicy(VerifierPolicy{MinZeroBits: 3})
+	assert.ErrorIs(t, v.Verify(h), ErrInsufficientBits)
+	assert.Equal(t, MinRandBytes, v.Policy().MinRandBytes)
+
+	v.SetPolicy(VerifierPolicy{MinZeroBits: 2, Algorithms: []string{algSha512}})
+	assert.ErrorIs(t, v.Verify(h), ErrUnsupportedAlgorithm)
+
+	v.SetPolicy(VerifierPolicy{MinZeroBits: 2, MaxTTL: time.Minute})
+	assert.ErrorIs(t, v.Verify(h), ErrExpirationTooFar)
+
+	// the policy is not shared with the caller
+	minBits := map[string]uint8{algSha256: 2}
+	v.SetPolicy(VerifierPolicy{AlgorithmMinZeroBits: minBits})
+	minBits[algSha256] = 3
+	require.NoError(t, v.Verify(h))
+
+	p := v.Policy()
+	p.AlgorithmMinZeroBits[algSha256] = 3
+	require.NoError(t, v.Verify(h))
+
+	allowed := []string{"my.email@gmail.com"}
+	v.SetPolicy(VerifierPolicy{AllowResources: allowed})
+	allowed[0] = "other@gmail.com"
+	require.NoError(t, v.Verify(h))
+
+	p = v.Policy()
+	p.AllowResources[0] = "other@gmail.com"
+	require.NoError(t, v.Verify(h))
+
+	v.SetTenantPolicy("tenant", VerifierPolicy{AllowResources: allowed})
+	allowed[0] = "my.email@gmail.com"
+	ctx := ContextWithTenant(context.Background(), "tenant")
+	assert.ErrorIs(t, v.VerifyFor(ctx, "client", h), ErrResourceNotAllowed)
+
+	p = v.TenantPolicy("tenant")
+	p.AllowResources[0] = "my.email@gmail.com"
+	assert.ErrorIs(t, v.VerifyFor(ctx, "client", h), ErrResourceNotAllowed)
+}
+
+func TestVerifier_LegacyAlgorithms(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	_, err := New("my.email@gmail.com", 1, time.Hour, WithAlgorithm("md5"))
+	assert.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+
+	h, err := New("my.email@gmail.com", 1, time.Hour, WithAlgorithm(algSha1))
+	require.NoError(t, err)
+	h, err = Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, NewVerifier().Verify(h), ErrUnsupportedAlgorithm)
+	assert.NoError(t, NewVerifier(AllowLegacyAlgorithms()).Verify(h))
+	assert.NoError(t, NewVerifier(WithAlgorithms(algSha256, algSha1)).Verify(h))
+	assert.ErrorIs(t, NewVerifier(AllowLegacyAlgorithms(), WithAlgorithms(algSha256)).Verify(h), ErrUnsupportedAlgorithm)
+}
+
+func TestVerifier_Auditor(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	h, err := New("my.email@gmail.com", 2, time.Hour)
+	require.NoError(t, err)
+	h, err = Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+
+	var records []AuditRecord
+	v := NewVerifier(
+		WithSpentStore(NewMemoryStore()),
+		WithAuditor(AuditorFunc(func(rec AuditRecord) { records = append(records, rec) })),
+	)
+
+	require.NoError(t, v.VerifyFor(context.Background(), "client", h))
+	require.ErrorIs(t, v.VerifyFor(context.Background(), "client", h), ErrStampSpent)
+
+	require.Len(t, records, 2)
+	assert.Equal(t, AuditAccept, records[0].Decision)
+	assert.Equal(t, "my.email@gmail.com", records[0].Resource)
+	assert.Equal(t, "client", records[0].ClientKey)
+	assert.Equal(t, StampKey(h), records[0].StampKey)
+	assert.Empty(t, records[0].Reason)
+
+	assert.Equal(t, AuditReject, records[1].Decision)
+	assert.ErrorIs(t, records[1].Err, ErrStampSpent)
+	assert.Equal(t, ErrStampSpent.Error(), records[1].Reason)
+}
+
+func TestVerifier_Tenants(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	h, err := New("my.email@gmail.com", 2, time.Hour)
+	require.NoError(t, err)
+	h, err = Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+
+	v := NewVerifier(WithMinZeroBits(2), WithSpentStore(NewMemoryStore()))
+	v.SetTenantPolicy("premium", VerifierPolicy{MinZeroBits: 1})
+	v.SetTenantPolicy("strict", VerifierPolicy{MinZeroBits: 3})
+
+	premium := ContextWithTenant(context.Background(), "premium")
+	strict := ContextWithTenant(context.Background(), "strict")
+
+	assert.ErrorIs(t, v.VerifyFor(strict, "client", h), ErrInsufficientBits)
+	require.NoError(t, v.VerifyFor(premium, "client", h))
+	assert.ErrorIs(t, v.VerifyFor(premium, "client", h), ErrStampSpent)
+
+	// the stamps spent by a tenant are not spent for the others
+	require.NoError(t, v.VerifyFor(context.Background(), "client", h))
+
+	v.RemoveTenant("strict")
+	assert.Equal(t, uint8(2), v.TenantPolicy("strict").MinZeroBits)
+	require.NoError(t, v.VerifyFor(strict, "client", h))
+}
+
+func TestVerifier_Revocations(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	mint := func(resource string) Header {
+		h, err := New(resource, 1, time.Hour)
+		require.NoError(t, err)
+		h, err = Compute(context.Background(), h, 0)
+		require.NoError(t, err)
+		return h
+	}
+
+	ctx := context.Background()
+	revocations := NewRevocationList(NewMemoryStore())
+	v := NewVerifier(WithRevocationList(revocations))
+
+	leaked := mint("leaked@example.com")
+	require.NoError(t, revocations.RevokeStamp(ctx, leaked))
+	assert.ErrorIs(t, v.VerifyFor(ctx, "client", leaked), ErrRevoked)
+
+	sameRand := mint("rand@example.com")
+	require.NoError(t, revocations.RevokeRand(ctx, sameRand.Rand, now.Add(time.Hour)))
+	assert.ErrorIs(t, v.VerifyBatch(ctx, "client", []Header{sameRand})[0], ErrRevoked)
+
+	h := mint("client@example.com")
+	h.Rand = "b3RoZXItcmFuZA=="
+	h, err := Compute(ctx, h, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, revocations.RevokeClient(ctx, "thief", now.Add(time.Hour)))
+	assert.ErrorIs(t, v.VerifyFor(ctx, "thief", h), ErrRevoked)
+
+	require.NoError(t, revocations.ReinstateClient(ctx, "thief"))
+	require.NoError(t, v.VerifyFor(ctx, "thief", h))
+
+	resource := mint("resource@example.com")
+	require.NoError(t, revocations.RevokeResource(ctx, "resource@example.com", now.Add(time.Hour)))
+	assert.ErrorIs(t, v.VerifyFor(ctx, "client", resource), ErrRevoked)
+
+	// stamps minted with an hour of ttl between 10 and 20 minutes ago
+	issued := mint("issued@example.com")
+	now = now.Add(15 * time.Minute)
+	later := mint("later@example.com")
+	require.NoError(t, revocations.RevokeIssued(ctx, now.Add(-20*time.Minute), now.Add(-10*time.Minute), time.Hour))
+	assert.ErrorIs(t, v.VerifyFor(ctx, "client", issued), ErrRevoked)
+	require.NoError(t, v.VerifyFor(ctx, "client", later))
+
+	err = revocations.RevokeIssued(ctx, now, now.Add(48*time.Hour), time.Hour)
+	assert.ErrorIs(t, err, ErrRevocationWindowTooLarge)
+}
+
+func TestVerifier_RevocationsClockSkew(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	ctx := context.Background()
+	revocations := NewRevocationList(NewMemoryStore())
+	v := NewVerifier(WithRevocationList(revocations), WithMaxClockSkew(5*time.Minute))
+
+	h, err := New("leaked@example.com", 1, time.Hour)
+	require.NoError(t, err)
+	h, err = Compute(ctx, h, 0)
+	require.NoError(t, err)
+	require.NoError(t, revocations.RevokeStamp(ctx, h))
+
+	issued, err := New("issued@example.com", 1, time.Hour)
+	require.NoError(t, err)
+	issued, err = Compute(ctx, issued, 0)
+	require.NoError(t, err)
+	require.NoError(t, revocations.RevokeIssued(ctx, now.Add(-time.Minute), now.Add(time.Minute), time.Hour))
+
+	// the stamps are accepted within the skew past their expiration
+	now = now.Add(time.Hour + 4*time.Minute)
+	assert.ErrorIs(t, v.VerifyFor(ctx, "client", h), ErrRevoked)
+	assert.ErrorIs(t, v.VerifyFor(ctx, "client", issued), ErrRevoked)
+}
+
+func TestVerifier_RevocationsExtended(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	mint := func(resource string) Header {
+		h, err := New(resource, 1, 2*time.Hour)
+		require.NoError(t, err)
+		h, err = Compute(context.Background(), h, 0)
+		require.NoError(t, err)
+		return h
+	}
+
+	ctx := context.Background()
+	revocations := NewRevocationList(NewMemoryStore())
+	v := NewVerifier(WithRevocationList(revocations))
+
+	client := mint("client@example.com")
+	resource := mint("resource@example.com")
+	sameRand := mint("rand@example.com")
+
+	for _, until := range []time.Time{now.Add(time.Minute), now.Add(time.Hour)} {
+		require.NoError(t, revocations.RevokeClient(ctx, "thief", until))
+		require.NoError(t, revocations.RevokeResource(ctx, "resource@example.com", until))
+		require.NoError(t, revocations.RevokeRand(ctx, sameRand.Rand, until))
+	}
+
+	// the revocations last until the later time
+	now = now.Add(30 * time.Minute)
+	assert.ErrorIs(t, v.VerifyFor(ctx, "thief", client), ErrRevoked)
+	assert.ErrorIs(t, v.VerifyFor(ctx, "client", resource), ErrRevoked)
+	assert.ErrorIs(t, v.VerifyFor(ctx, "client", sameRand), ErrRevoked)
+
+	now = now.Add(time.Hour)
+	require.NoError(t, v.VerifyFor(ctx, "thief", client))
+	require.NoError(t, v.VerifyFor(ctx, "client", resource))
+	require.NoError(t, v.VerifyFor(ctx, "client", sameRand))
+}
+
+func TestVerifyString(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	// serialized by another implementation, with an upper case algorithm
+	// and a base64 counter, solved on that very string
+	prefix := fmt.Sprintf("1:2:%d:bG9jYWxob3N0:SHA-256:vZOxuoIgixP+hw==:", now.Add(time.Hour).UnixNano())
+	var raw string
+	for counter := uint64(0); ; counter++ {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], counter)
+		raw = prefix + base64.StdEncoding.EncodeToString(b[:])
+
+		hash := sha256.Sum256([]byte(raw))
+		if verify(hex.EncodeToString(hash[:]), 2) {
+			break
+		}
+	}
+
+	h, err := VerifyString(raw, VerifierPolicy{MinZeroBits: 2})
+	require.NoError(t, err)
+	assert.Equal(t, "localhost", h.Resource)
+	assert.Equal(t, algSha256, h.Algorithm)
+
+	_, err = VerifyString(raw, VerifierPolicy{MinZeroBits: 3})
+	assert.ErrorIs(t, err, ErrInsufficientBits)
+
+	_, err = VerifyString(strings.Replace(raw, ":2:", ":40:", 1), VerifierPolicy{MinZeroBits: 2})
+	assert.ErrorIs(t, err, ErrInvalidProof)
+}
+
+func TestPrevalidate(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	h, err := New("my.email@gmail.com", 2, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, Prevalidate(h.String()))
+
+	exp := now.Add(time.Hour).UnixNano()
+	tests := []struct {
+		name string
+		raw  string
+		err  error
+	}{
+		{name: "too long", raw: strings.Repeat("a", MaxStampLength+1), err: ErrInvalidHeaderString},
+		{name: "too few fields", raw: "1:2:3", err: ErrInvalidHeaderString},
+		{name: "invalid zero bits", raw: fmt.Sprintf("1:x:%d:bG9jYWxob3N0:sha-256:cmFuZA==:0", exp), err: ErrInvalidHeaderString},
+		{name: "unsolvable zero bits", raw: fmt.Sprintf("1:65:%d:bG9jYWxob3N0:sha-256:cmFuZA==:0", exp), err: ErrInvalidZeroBits},
+		{name: "unsupported algorithm", raw: fmt.Sprintf("1:2:%d:bG9jYWxob3N0:md5:cmFuZA==:0", exp), err: ErrInvalidHeaderString},
+		{name: "legacy algorithm", raw: fmt.Sprintf("1:2:%d:bG9jYWxob3N0:sha-1:cmFuZA==:0", exp), err: ErrUnsupportedAlgorithm},
+		{name: "expired", raw: fmt.Sprintf("1:2:%d:bG9jYWxob3N0:sha-256:cmFuZA==:0", now.Add(-time.Minute).UnixNano()), err: ErrHeaderExpired},
+		{name: "legacy v0", raw: "0:240103:localhost:cmFuZA==", err: ErrUnsupportedAlgorithm},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ErrorIs(t, Prevalidate(tc.raw), tc.err)
+		})
+	}
+
+	p := VerifierPolicy{MinZeroBits: 3}
+	assert.ErrorIs(t, p.prevalidate(h.String(), 0, nil), ErrInsufficientBits)
+	p = VerifierPolicy{AllowLegacy: true}
+	assert.ErrorIs(t, p.prevalidate(h.String(), 3, nil), ErrInsufficientBits)
+	assert.ErrorIs(t, p.prevalidate("0:240101:localhost:cmFuZA==", 0, nil), ErrHeaderExpired)
+}
+
+func TestVerifier_ReplayWindow(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	h, err := New("my.email@gmail.com", 1, time.Minute)
+	require.NoError(t, err)
+	h, err = Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+
+	expiration := now.Add(time.Minute)
+	p := NewVerifier(WithMaxClockSkew(time.Minute)).Policy()
+	assert.True(t, expiration.Add(time.Minute+DefaultReplayGrace).Equal(p.spentUntil(h)))
+
+	p = NewVerifier(WithReplayGrace(0), WithReplayWindow(time.Hour)).Policy()
+	assert.Equal(t, now.Add(time.Hour), p.spentUntil(h))
+
+	store := NewMemoryStore()
+	v := NewVerifier(WithSpentStore(store), WithReplayWindow(time.Hour))
+	require.NoError(t, v.VerifyFor(context.Background(), "client", h))
+
+	now = now.Add(30 * time.Minute)
+	spent, err := store.IsSpent(context.Background(), StampKey(h))
+	require.NoError(t, err)
+	assert.True(t, spent)
+}
+
+func TestVerifier_AlgorithmMinZeroBits(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	mint := func(alg string) Header {
+		h, err := New("my.email@gmail.com", 2, time.Hour, WithAlgorithm(alg))
+		require.NoError(t, err)
+		h, err = Compute(context.Background(), h, 0)
+		require.NoError(t, err)
+		return h
+	}
+
+	v := NewVerifier(WithMinZeroBits(2), WithAlgorithmMinZeroBits(algSha1, 3), AllowLegacyAlgorithms())
+	require.NoError(t, v.Verify(mint(algSha256)))
+	assert.ErrorIs(t, v.Verify(mint(algSha1)), ErrInsufficientBits)
+
+	v = NewVerifier(WithMinZeroBits(3), WithAlgorithmMinZeroBits(algSha512, 2))
+	require.NoError(t, v.Verify(mint(algSha512)))
+	assert.ErrorIs(t, v.Verify(mint(algSha256)), ErrInsufficientBits)
+
+	p := v.Policy()
+	assert.NoError(t, p.prevalidate(mint(algSha512).String(), 0, nil))
+	assert.ErrorIs(t, p.prevalidate(mint(algSha256).String(), 0, nil), ErrInsufficientBits)
+}
+
+func TestVerifier_Resources(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	mint := func(resource string) Header {
+		h, err := New(resource, 1, time.Hour)
+		require.NoError(t, err)
+		h, err = Compute(context.Background(), h, 0)
+		require.NoError(t, err)
+		return h
+	}
+
+	v := NewVerifier(
+		WithAllowedResources("api.example.com", "*.example.org", "/v1/*/search"),
+		WithDeniedResources("admin.example.org"),
+	)
+
+	for _, resource := range []string{"api.example.com", "www.example.org", "/v1/books/search"} {
+		h := mint(resource)
+		assert.NoError(t, v.Verify(h), resource)
+
+		p := v.Policy()
+		assert.NoError(t, p.prevalidate(h.String(), 0, nil), resource)
+	}
+
+	for _, resource := range []string{"example.com", "api.example.com.evil", "admin.example.org", "/v1/books/search/x"} {
+		h := mint(resource)
+		err := v.Verify(h)
+		assert.ErrorIs(t, err, ErrResourceNotAllowed, resource)
+		assert.Equal(t, CodeResourceNotAllowed, CodeOf(err))
+
+		p := v.Policy()
+		assert.ErrorIs(t, p.prevalidate(h.String(), 0, nil), ErrResourceNotAllowed, resource)
+	}
+
+	// the proof is not checked for the resources not allowed
+	h := mint("example.com")
+	h.Counter++
+	assert.ErrorIs(t, v.Verify(h), ErrResourceNotAllowed)
+
+	p := NewVerifier(WithDeniedResources("*.internal")).Policy()
+	assert.True(t, p.AcceptsResource("example.com"))
+	assert.False(t, p.AcceptsResource("db.internal"))
+
+	// the variants of a denied resource are denied in their normalized form
+	v = NewVerifier(WithDeniedResources("admin.example.org"), WithResourceNormalizer(NormalizeResource))
+	for _, resource := range []string{"ADMIN.Example.org", "admin.example.org."} {
+		h := mint(resource)
+		assert.ErrorIs(t, v.Verify(h), ErrResourceNotAllowed, resource)
+		assert.NoError(t, v.MatchResource(resource, "admin.example.org"), resource)
+
+		p := v.Policy()
+		assert.ErrorIs(t, p.prevalidate(h.String(), 0, v.cfg.ResourceNormalizer), ErrResourceNotAllowed, resource)
+	}
+}
+
+func TestVerifier_SequentialWork(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	forge := func(zeroBits uint8) Header {
+		h, err := New("127.0.0.1", zeroBits, time.Hour, WithAlgorithm(algSeqSha256))
+		require.NoError(t, err)
+		checkpoint := base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+		h.Ext = strings.TrimSuffix(strings.Repeat(checkpoint+checkpointSeparator, sequentialCheckpoints), checkpointSeparator)
+		return h
+	}
+
+	h, err := New("127.0.0.1", 4, time.Hour, WithAlgorithm(algSeqSha256))
+	require.NoError(t, err)
+	h, err = Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+
+	// the sequential work is accepted only when listed
+	v := NewVerifier()
+	assert.ErrorIs(t, v.Verify(h), ErrUnsupportedAlgorithm)
+	p := v.Policy()
+	assert.ErrorIs(t, p.prevalidate(h.String(), 0, nil), ErrUnsupportedAlgorithm)
+
+	v = NewVerifier(WithAlgorithms(algSeqSha256))
+	require.NoError(t, v.Verify(h))
+
+	// forged stamps beyond the bound are rejected before recomputing them
+	p = v.Policy()
+	assert.ErrorIs(t, v.Verify(forge(24)), ErrInvalidZeroBits)
+	assert.ErrorIs(t, p.prevalidate(forge(24).String(), 0, nil), ErrInvalidZeroBits)
+
+	// the recomputation stops with the request
+	v = NewVerifier(WithAlgorithms(algSeqSha256), WithMaxSequentialZeroBits(36))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, v.VerifyFor(ctx, "client", forge(36)), context.Canceled)
+}
+
+func TestVerifier_VerifiedCache(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	h, err := New("my.email@gmail.com", 2, time.Hour)
+	require.NoError(t, err)
+	h, err = Compute(context.Background(), h, 0)
+	require.NoError(t, err)
+
+	v := NewVerifier(WithVerifiedCache(1), WithSpentStore(NewMemoryStore()))
+	require.NoError(t, v.VerifyFor(context.Background(), "client", h))
+
+	// a duplicate delivery skips hashing but is still a replay
+	assert.ErrorIs(t, v.VerifyFor(context.Background(), "client", h), ErrStampSpent)
+	assert.Equal(t, VerifierStats{Accepted: 1, Rejected: 1, CacheHits: 1}, v.Stats())
+
+	invalid := h
+	for invalid.Valid() {
+		invalid.Counter++
+	}
+	assert.ErrorIs(t, v.Verify(invalid), ErrInvalidProof)
+	assert.ErrorIs(t, v.Verify(invalid), ErrInvalidProof)
+	assert.Equal(t, uint64(1), v.Stats().CacheHits)
+
+	// the policy still applies to the cached headers
+	now = now.Add(2 * time.Hour)
+	assert.ErrorIs(t, v.Verify(h), ErrHeaderExpired)
+}
+
+func TestCodeOf(t *testing.T) {
+	t.Parallel()
+
+	_, err := Parse("1:2:3")
+	assert.Equal(t, CodeMalformedStamp, CodeOf(err))
+
+	err = fmt.Errorf("%w: got %d, want at least %d", ErrInsufficientBits, 1, 2)
+	assert.Equal(t, CodeInsufficientBits, CodeOf(err))
+
+	var coded *Error
+	require.ErrorAs(t, errors.Join(context.Canceled, &IssueLimitError{RetryAfter: time.Second}), &coded)
+	assert.Equal(t, CodeIssueLimited, coded.Code)
+
+	assert.Equal(t, CodeUnknown, CodeOf(context.Canceled))
+	assert.Equal(t, CodeUnknown, CodeOf(nil))
+	assert.Equal(t, string(CodeStampExpired), problemCode(ErrHeaderExpired))
+}
@@ -0,0 +1,87 @@
+package hashcache
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// WorkFunction is the puzzle behind an algorithm of the header:
+// Solve finds a witness satisfying the header difficulty and
+// Verify checks it. This way puzzle families other than partial
+// hash pre-images (e.g. memory-bound Equihash or Cuckoo cycle) reuse
+// the header format, expiration and verifier policy as is.
+type WorkFunction interface {
+	Solve(ctx context.Context, h Header, maxIterations int) (Header, error)
+	Verify(h Header) bool
+}
+
+// ContextVerifier is optionally implemented by the work functions which
+// are costly to verify, so that the verification stops with the request
+type ContextVerifier interface {
+	VerifyContext(ctx context.Context, h Header) bool
+}
+
+var (
+	workFunctionsMu sync.RWMutex
+	workFunctions   = map[string]WorkFunction{
+		algSha1:      hashcashWork{},
+		algSha256:    hashcashWork{},
+		algSha512:    hashcashWork{},
+		algSeqSha256: sequentialWork{},
+	}
+)
+
+// RegisterWorkFunction makes the work function available under
+// the algorithm name, replacing any previously registered one.
+// The name must not contain the header separator.
+func RegisterWorkFunction(alg string, wf WorkFunction) {
+	workFunctionsMu.Lock()
+	defer workFunctionsMu.Unlock()
+
+	workFunctions[alg] = wf
+}
+
+// Algorithms are the names of the registered work functions, sorted
+func Algorithms() []string {
+	workFunctionsMu.RLock()
+	defer workFunctionsMu.RUnlock()
+
+	algs := make([]string, 0, len(workFunctions))
+	for alg := range workFunctions {
+		algs = append(algs, alg)
+	}
+
+	slices.Sort(algs)
+	return algs
+}
+
+func lookupWorkFunction(alg string) (WorkFunction, bool) {
+	workFunctionsMu.RLock()
+	defer workFunctionsMu.RUnlock()
+
+	wf, ok := workFunctions[alg]
+	return wf, ok
+}
+
+// resolveWorkFunction falls back to hashcash for unknown algorithms,
+// the same way resolveHash falls back to sha-1
+func resolveWorkFunction(alg string) WorkFunction {
+	if wf, ok := lookupWorkFunction(alg); ok {
+		return wf
+	}
+
+	return hashcashWork{}
+}
+
+// hashcashWork searches for a counter giving a hash
+// with the required number of leading zeros
+type hashcashWork struct{}
+
+func (hashcashWork) Solve(ctx context.Context, h Header, maxIterations int) (Header, error) {
+	return searchCounter(ctx, h, maxIterations)
+}
+
+func (hashcashWork) Verify(h Header) bool {
+	return verify(h.Hash(), h.ZeroBits)
+}